@@ -792,6 +792,12 @@ func (fb *filterBackend) ServiceFilter(ctx context.Context, ms *bloombits.Matche
 	panic("not supported")
 }
 
+func (fb *filterBackend) LogIndexStatus() (uint64, uint64) { return params.LogIndexBlocks, 0 }
+
+func (fb *filterBackend) LogIndexLookup(ctx context.Context, section uint64, term []byte) ([]core.LogPosition, error) {
+	panic("not supported")
+}
+
 func nullSubscription() event.Subscription {
 	return event.NewSubscription(func(quit <-chan struct{}) error {
 		<-quit
@@ -1030,6 +1030,51 @@ contract Reverter {
         }
     }
 }*/
+// Tests that contract transactions with an access list specified in the transact
+// options are created as EIP-2930 transactions.
+func TestSimulatedBackend_AccessListTransact(t *testing.T) {
+	testAddr := crypto.PubkeyToAddress(testKey.PublicKey)
+	sim := simTestBackend(testAddr)
+	defer sim.Close()
+	bgCtx := context.Background()
+
+	parsed, err := abi.JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatalf("could not parse abi: %v", err)
+	}
+	auth, _ := bind.NewKeyedTransactorWithChainID(testKey, big.NewInt(1337))
+	auth.AccessList = types.AccessList{{Address: testAddr, StorageKeys: []common.Hash{{0x01}}}}
+
+	addr, tx, contract, err := bind.DeployContract(auth, parsed, common.FromHex(abiBin), sim)
+	if err != nil {
+		t.Fatalf("could not deploy contract: %v", err)
+	}
+	if tx.Type() != types.AccessListTxType {
+		t.Fatalf("deploy transaction type mismatch: have %d, want %d", tx.Type(), types.AccessListTxType)
+	}
+	sim.Commit()
+
+	tx, err = contract.Transact(auth, "receive", []byte("X"))
+	if err != nil {
+		t.Fatalf("could not transact with contract: %v", err)
+	}
+	if tx.Type() != types.AccessListTxType {
+		t.Fatalf("call transaction type mismatch: have %d, want %d", tx.Type(), types.AccessListTxType)
+	}
+	if to := tx.To(); to == nil || *to != addr {
+		t.Fatalf("call transaction recipient mismatch: have %v, want %x", to, addr)
+	}
+	sim.Commit()
+
+	receipt, err := sim.TransactionReceipt(bgCtx, tx.Hash())
+	if err != nil {
+		t.Fatalf("could not get transaction receipt: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("transaction failed")
+	}
+}
+
 func TestSimulatedBackend_CallContractRevert(t *testing.T) {
 	testAddr := crypto.PubkeyToAddress(testKey.PublicKey)
 	sim := simTestBackend(testAddr)
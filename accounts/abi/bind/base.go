@@ -53,6 +53,8 @@ type TransactOpts struct {
 	GasPrice *big.Int // Gas price to use for the transaction execution (nil = gas price oracle)
 	GasLimit uint64   // Gas limit to set for the transaction execution (0 = estimate)
 
+	AccessList types.AccessList // EIP-2930 access list to attach to the transaction (nil = legacy transaction)
+
 	Context context.Context // Network context to support cancellation and timeouts (nil = no timeout)
 }
 
@@ -240,7 +242,7 @@ func (c *BoundContract) transact(opts *TransactOpts, contract *common.Address, i
 			}
 		}
 		// If the contract surely has code (or code is not needed), estimate the transaction
-		msg := ethereum.CallMsg{From: opts.From, To: contract, GasPrice: gasPrice, Value: value, Data: input}
+		msg := ethereum.CallMsg{From: opts.From, To: contract, GasPrice: gasPrice, Value: value, Data: input, AccessList: opts.AccessList}
 		gasLimit, err = c.transactor.EstimateGas(ensureContext(opts.Context), msg)
 		if err != nil {
 			return nil, fmt.Errorf("failed to estimate gas needed: %v", err)
@@ -248,9 +250,25 @@ func (c *BoundContract) transact(opts *TransactOpts, contract *common.Address, i
 	}
 	// Create the transaction, sign it and schedule it for execution
 	var rawTx *types.Transaction
-	if contract == nil {
+	switch {
+	case opts.AccessList != nil:
+		// The chain ID is filled in by the signer
+		var to *common.Address
+		if contract != nil {
+			to = &c.address
+		}
+		rawTx = types.NewTx(&types.AccessListTx{
+			Nonce:      nonce,
+			To:         to,
+			Value:      value,
+			Gas:        gasLimit,
+			GasPrice:   gasPrice,
+			Data:       input,
+			AccessList: opts.AccessList,
+		})
+	case contract == nil:
 		rawTx = types.NewContractCreation(nonce, value, gasLimit, gasPrice, input)
-	} else {
+	default:
 		rawTx = types.NewTransaction(nonce, c.address, value, gasLimit, gasPrice, input)
 	}
 	if opts.Signer == nil {
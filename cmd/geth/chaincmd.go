@@ -47,6 +47,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.StateSchemeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -54,6 +55,9 @@ The init command initializes a new genesis block and definition for the network.
 This is a destructive action and changes the network in which you will be
 participating.
 
+The scheme of the state trie nodes can be selected with --state.scheme, which
+is recorded in the database and can't be changed afterwards.
+
 It expects the genesis file as argument.`,
 	}
 	dumpGenesisCommand = cli.Command{
@@ -216,6 +220,12 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
+		// Light clients never store the state, so the scheme only matters for full nodes
+		if name == "chaindata" {
+			if _, err := core.SetupStateScheme(chaindb, ctx.GlobalString(utils.StateSchemeFlag.Name)); err != nil {
+				utils.Fatalf("Failed to set up state scheme: %v", err)
+			}
+		}
 		_, hash, err := core.SetupGenesisBlock(chaindb, genesis)
 		if err != nil {
 			utils.Fatalf("Failed to write genesis block: %v", err)
@@ -411,7 +421,13 @@ func copyDb(ctx *cli.Context) error {
 	dl := downloader.New(0, chainDb, syncBloom, new(event.TypeMux), chain, nil, nil)
 
 	// Create a source peer to satisfy downloader requests from
-	db, err := rawdb.NewLevelDBDatabaseWithFreezer(ctx.Args().First(), ctx.GlobalInt(utils.CacheFlag.Name)/2, 256, ctx.Args().Get(1), "")
+	db, err := rawdb.Open(rawdb.OpenOptions{
+		Type:              ctx.GlobalString(utils.DBEngineFlag.Name),
+		Directory:         ctx.Args().First(),
+		AncientsDirectory: ctx.Args().Get(1),
+		Cache:             ctx.GlobalInt(utils.CacheFlag.Name) / 2,
+		Handles:           256,
+	})
 	if err != nil {
 		return err
 	}
@@ -17,7 +17,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -27,10 +29,12 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/console/prompt"
 	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/ethdb"
-	"github.com/ethereum/go-ethereum/ethdb/leveldb"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/olekukonko/tablewriter"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -59,25 +63,38 @@ Remove blockchain and state databases`,
 			dbGetCmd,
 			dbDeleteCmd,
 			dbPutCmd,
+			dbPruneHistoryCmd,
+			dbFreezerMigrateCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
 		Action:    utils.MigrateFlags(inspect),
 		Name:      "inspect",
 		ArgsUsage: "<prefix> <start>",
+		Flags: []cli.Flag{
+			inspectContractsFlag,
+			inspectContractsTopFlag,
+			inspectContractsReportFlag,
+			inspectContractsCompareFlag,
+		},
+		Usage: "Inspect the storage size for each type of data in the database",
+		Description: `This commands iterates the entire database. If the optional 'prefix' and 'start' arguments are provided, then the iteration is limited to the given subset of data.
 
-		Usage:       "Inspect the storage size for each type of data in the database",
-		Description: `This commands iterates the entire database. If the optional 'prefix' and 'start' arguments are provided, then the iteration is limited to the given subset of data.`,
+With --contracts, the storage snapshot and trie usage is also broken down by
+contract, listing the largest contracts by slot count and bytes along with their
+code size. The breakdown can be saved as a JSON report with --contracts.report
+and compared against an earlier report with --contracts.compare to show which
+contracts grew in between.`,
 	}
 	dbStatCmd = cli.Command{
 		Action: dbStats,
 		Name:   "stats",
-		Usage:  "Print leveldb statistics",
+		Usage:  "Print database statistics",
 	}
 	dbCompactCmd = cli.Command{
 		Action: dbCompact,
 		Name:   "compact",
-		Usage:  "Compact leveldb database. WARNING: May take a very long time",
+		Usage:  "Compact the database. WARNING: May take a very long time",
 		Description: `This command performs a database compaction. 
 WARNING: This operation may take a very long time to finish, and may cause database
 corruption if it is aborted during execution'!`,
@@ -105,6 +122,55 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		Description: `This command sets a given database key to the given value. 
 WARNING: This is a low-level operation which may cause database corruption!`,
 	}
+	dbPruneHistoryCmd = cli.Command{
+		Action: dbPruneHistory,
+		Name:   "prune-history",
+		Usage:  "Delete the bodies and receipts of old blocks from the ancient store",
+		Flags: []cli.Flag{
+			historyKeepFlag,
+		},
+		Description: `This command deletes the bodies and receipts of all but the most recent
+blocks from the ancient store. Headers are retained. The data is hidden right
+away, but only deleted from disk in whole data files. Pruned history can't be
+served to peers or through the RPC API anymore.
+
+The transaction lookup entries of the pruned blocks are retained, so that the
+RPC API can report their transactions as pruned rather than unknown. Limit the
+transaction index with --txlookuplimit before pruning to delete them as well.`,
+	}
+	dbFreezerMigrateCmd = cli.Command{
+		Action:    freezerMigrate,
+		Name:      "freezer-migrate",
+		Usage:     "Recompress an ancient table with a different codec",
+		ArgsUsage: "<table> <none|snappy|zstd>",
+		Description: `This command rewrites all the items of the given ancient table (headers,
+hashes, bodies, receipts or diffs) compressed with the given codec. The codec is
+recorded along the table, the data is read back transparently afterwards. The
+node must not be running while the table is migrated, and a codec configured for
+the table with --datadir.ancient.codecs must be updated to match.`,
+	}
+	inspectContractsFlag = cli.BoolFlag{
+		Name:  "contracts",
+		Usage: "Break down the storage usage by contract",
+	}
+	inspectContractsTopFlag = cli.IntFlag{
+		Name:  "contracts.top",
+		Usage: "Number of largest contracts to report by slot count and by bytes",
+		Value: 20,
+	}
+	inspectContractsReportFlag = cli.StringFlag{
+		Name:  "contracts.report",
+		Usage: "File to save the contract breakdown into as JSON",
+	}
+	inspectContractsCompareFlag = cli.StringFlag{
+		Name:  "contracts.compare",
+		Usage: "Earlier JSON contract report to compute the growth against",
+	}
+	historyKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Usage: "Number of recent blocks to retain the bodies and receipts of",
+		Value: params.FullImmutabilityThreshold,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -118,13 +184,7 @@ func removeDB(ctx *cli.Context) error {
 		log.Info("Full node state database missing", "path", path)
 	}
 	// Remove the full node ancient database
-	path = config.Eth.DatabaseFreezer
-	switch {
-	case path == "":
-		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
-	case !filepath.IsAbs(path):
-		path = config.Node.ResolvePath(path)
-	}
+	path = ancientPath(stack, &config)
 	if common.FileExist(path) {
 		confirmAndRemoveDB(path, "full node ancient database")
 	} else {
@@ -140,6 +200,18 @@ func removeDB(ctx *cli.Context) error {
 	return nil
 }
 
+// ancientPath resolves the directory of the full node ancient database.
+func ancientPath(stack *node.Node, config *gethConfig) string {
+	path := config.Eth.DatabaseFreezer
+	switch {
+	case path == "":
+		path = filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	case !filepath.IsAbs(path):
+		path = config.Node.ResolvePath(path)
+	}
+	return path
+}
+
 // confirmAndRemoveDB prompts the user for a last confirmation and removes the
 // folder if accepted.
 func confirmAndRemoveDB(database string, kind string) {
@@ -195,7 +267,114 @@ func inspect(ctx *cli.Context) error {
 	_, chainDb := utils.MakeChain(ctx, stack, true)
 	defer chainDb.Close()
 
-	return rawdb.InspectDatabase(chainDb, prefix, start)
+	if err := rawdb.InspectDatabase(chainDb, prefix, start); err != nil {
+		return err
+	}
+	if ctx.Bool(inspectContractsFlag.Name) {
+		return inspectContracts(ctx, chainDb)
+	}
+	return nil
+}
+
+// inspectContracts breaks the storage usage down by contract, optionally saving
+// the breakdown and comparing it against an earlier one.
+func inspectContracts(ctx *cli.Context, db ethdb.Database) error {
+	// Load the earlier report first to fail early on a bad path
+	var prev *state.ContractReport
+	if path := ctx.String(inspectContractsCompareFlag.Name); path != "" {
+		blob, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		prev = new(state.ContractReport)
+		if err := json.Unmarshal(blob, prev); err != nil {
+			return fmt.Errorf("invalid contract report %s: %v", path, err)
+		}
+	}
+	report, err := state.InspectContracts(db, ctx.Int(inspectContractsTopFlag.Name))
+	if err != nil {
+		return err
+	}
+	var growth []*state.ContractGrowth
+	if prev != nil {
+		if growth, err = report.Growth(prev); err != nil {
+			return err
+		}
+	}
+	name := func(hash common.Hash, addr *common.Address) string {
+		if addr != nil {
+			return addr.Hex()
+		}
+		return hash.Hex()
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Contract", "Slots", "Snapshot size", "Trie nodes", "Trie size", "Code size"})
+	for _, u := range report.Largest {
+		table.Append([]string{
+			name(u.Hash, u.Address),
+			fmt.Sprint(u.Slots),
+			common.StorageSize(u.SnapshotBytes).String(),
+			fmt.Sprint(u.TrieNodes),
+			common.StorageSize(u.TrieBytes).String(),
+			common.StorageSize(u.CodeSize).String(),
+		})
+	}
+	table.SetFooter([]string{
+		fmt.Sprintf("%d contracts", report.Contracts),
+		fmt.Sprint(report.Slots),
+		common.StorageSize(report.SnapshotBytes).String(),
+		"",
+		common.StorageSize(report.TrieBytes).String(),
+		"",
+	})
+	table.Render()
+
+	if prev != nil {
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"Contract", "Slots", "Size", "Code size"})
+		for _, g := range growth {
+			if g.Unknown {
+				table.Append([]string{name(g.Hash, g.Address), "unknown", "unknown", "unknown"})
+				continue
+			}
+			table.Append([]string{
+				name(g.Hash, g.Address),
+				fmt.Sprintf("%+d", g.Slots),
+				fmt.Sprintf("%+d B", g.Bytes),
+				fmt.Sprintf("%+d B", g.CodeSize),
+			})
+		}
+		table.SetFooter([]string{
+			fmt.Sprintf("since %s", prev.Time.Format(time.RFC3339)),
+			fmt.Sprintf("%+d", int64(report.Slots)-int64(prev.Slots)),
+			fmt.Sprintf("%+d B", int64(report.SnapshotBytes+report.TrieBytes)-int64(prev.SnapshotBytes+prev.TrieBytes)),
+			"",
+		})
+		table.Render()
+	}
+	if path := ctx.String(inspectContractsReportFlag.Name); path != "" {
+		blob, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+			return err
+		}
+		log.Info("Saved contract report", "path", path)
+	}
+	return nil
+}
+
+// openChainKeyValueDatabase opens the key-value store of the chain database
+// directly, with the engine it was created with.
+func openChainKeyValueDatabase(ctx *cli.Context, stack *node.Node, readonly bool) (ethdb.KeyValueStore, error) {
+	return rawdb.OpenKeyValueDatabase(rawdb.OpenOptions{
+		Type:      ctx.GlobalString(utils.DBEngineFlag.Name),
+		Directory: stack.ResolvePath("chaindata"),
+		Cache:     ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100,
+		Handles:   utils.MakeDatabaseHandles(),
+		ReadOnly:  readonly,
+	})
 }
 
 func showLeveldbStats(db ethdb.Stater) {
@@ -214,10 +393,7 @@ func showLeveldbStats(db ethdb.Stater) {
 func dbStats(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
-	path := stack.ResolvePath("chaindata")
-	db, err := leveldb.NewCustom(path, "", func(options *opt.Options) {
-		options.ReadOnly = true
-	})
+	db, err := openChainKeyValueDatabase(ctx, stack, true)
 	if err != nil {
 		return err
 	}
@@ -232,13 +408,7 @@ func dbStats(ctx *cli.Context) error {
 func dbCompact(ctx *cli.Context) error {
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
-	path := stack.ResolvePath("chaindata")
-	cache := ctx.GlobalInt(utils.CacheFlag.Name) * ctx.GlobalInt(utils.CacheDatabaseFlag.Name) / 100
-	db, err := leveldb.NewCustom(path, "", func(options *opt.Options) {
-		options.OpenFilesCacheCapacity = utils.MakeDatabaseHandles()
-		options.BlockCacheCapacity = cache / 2 * opt.MiB
-		options.WriteBuffer = cache / 4 * opt.MiB // Two of these are used internally
-	})
+	db, err := openChainKeyValueDatabase(ctx, stack, false)
 	if err != nil {
 		return err
 	}
@@ -265,10 +435,7 @@ func dbGet(ctx *cli.Context) error {
 	}
 	stack, _ := makeConfigNode(ctx)
 	defer stack.Close()
-	path := stack.ResolvePath("chaindata")
-	db, err := leveldb.NewCustom(path, "", func(options *opt.Options) {
-		options.ReadOnly = true
-	})
+	db, err := openChainKeyValueDatabase(ctx, stack, true)
 	if err != nil {
 		return err
 	}
@@ -339,3 +506,61 @@ func dbPut(ctx *cli.Context) error {
 	}
 	return db.Put(key, value)
 }
+
+// dbPruneHistory deletes the bodies and receipts of old blocks from the ancient store
+func dbPruneHistory(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+	db := utils.MakeChainDatabase(ctx, stack)
+	defer db.Close()
+
+	head := rawdb.ReadHeadBlockHash(db)
+	number := rawdb.ReadHeaderNumber(db, head)
+	if number == nil {
+		return fmt.Errorf("head block %x unavailable", head)
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		return fmt.Errorf("ancient store unavailable: %v", err)
+	}
+	tail, err := db.AncientTail()
+	if err != nil {
+		return err
+	}
+	// Only frozen blocks can be pruned, the recent ones live in the key-value store
+	var (
+		keep   = ctx.Uint64(historyKeepFlag.Name)
+		target uint64
+	)
+	if *number+1 > keep {
+		target = *number + 1 - keep
+	}
+	if target > frozen {
+		target = frozen
+	}
+	if target <= tail {
+		log.Info("No history to prune", "head", *number, "tail", tail, "keep", keep)
+		return nil
+	}
+	start := time.Now()
+	if err := db.TruncateAncientTail(target); err != nil {
+		return err
+	}
+	log.Info("Pruned chain history", "head", *number, "tail", target, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// freezerMigrate recompresses an ancient table with the requested codec.
+func freezerMigrate(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("required arguments: %v", ctx.Command.ArgsUsage)
+	}
+	stack, config := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := ancientPath(stack, &config)
+	if !common.FileExist(path) {
+		return fmt.Errorf("ancient database missing: %s", path)
+	}
+	return rawdb.MigrateFreezerTable(path, ctx.Args().Get(0), ctx.Args().Get(1))
+}
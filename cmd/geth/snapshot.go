@@ -17,12 +17,16 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
@@ -95,6 +99,25 @@ geth snapshot verify-state <state-root>
 will traverse the whole accounts and storages set based on the specified
 snapshot and recalculate the root hash of state for verification.
 In other words, this command does the snapshot to trie conversion.
+`,
+			},
+			{
+				Name:      "check-dangling-storage",
+				Usage:     "Check that there is no 'dangling' snap storage",
+				ArgsUsage: "",
+				Action:    utils.MigrateFlags(checkDanglingStorage),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot check-dangling-storage
+will traverse the snapshot storage data, both in the disk layer and in the
+journalled diff layers, and check that every storage entry belongs to an
+existing account.
 `,
 			},
 			{
@@ -112,8 +135,9 @@ In other words, this command does the snapshot to trie conversion.
 				Description: `
 geth snapshot traverse-state <state-root>
 will traverse the whole state from the given state root and will abort if any
-referenced trie node or contract code is missing. This command can be used for
-state integrity verification. The default checking target is the HEAD state.
+referenced trie node or contract code is missing, reporting the hash and path of
+the missing trie node. This command can be used for state integrity verification.
+The default checking target is the HEAD state.
 
 It's also usable without snapshot enabled.
 `,
@@ -133,11 +157,54 @@ It's also usable without snapshot enabled.
 				Description: `
 geth snapshot traverse-rawstate <state-root>
 will traverse the whole state from the given root and will abort if any referenced
-trie node or contract code is missing. This command can be used for state integrity
-verification. The default checking target is the HEAD state. It's basically identical
-to traverse-state, but the check granularity is smaller. 
+trie node or contract code is missing, reporting the hash and path of the missing
+trie node. This command can be used for state integrity verification. The default
+checking target is the HEAD state. It's basically identical to traverse-state, but
+the check granularity is smaller. 
 
 It's also usable without snapshot enabled.
+`,
+			},
+			{
+				Name:      "dump",
+				Usage:     "Export the flat state snapshot into a portable file",
+				ArgsUsage: "<file> [<root>]",
+				Action:    utils.MigrateFlags(dumpSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot dump <file> [<state-root>]
+will stream the flat account and storage snapshot of the given state, together
+with the contract codes, into a versioned, chunked and checksummed file. The
+default exporting target is the HEAD state, otherwise the state must belong to
+one of the recent blocks retained by the snapshot.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import the flat state snapshot from a portable file",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot import <file>
+will rebuild the snapshot disk layer from a file created by 'geth snapshot dump',
+regenerate the state tries from it and verify the resulting state root. The
+database must not contain a snapshot yet, and is initialized with the genesis of
+the selected network if empty. Once the state is verified, the block of the
+dumped state, carried by the file, is written into the canonical chain and the
+head of the chain is moved to it, unless it is past it already.
 `,
 			},
 		},
@@ -200,10 +267,26 @@ func verifyState(ctx *cli.Context) error {
 		}
 	}
 	if err := snaptree.Verify(root); err != nil {
-		log.Error("Failed to verfiy state", "error", err)
+		log.Error("Failed to verfiy state", "root", root, "error", err)
+		return err
+	}
+	log.Info("Verified the state", "root", root)
+	return snapshot.CheckDanglingStorage(chaindb)
+}
+
+// checkDanglingStorage iterates the snap storage data, and verifies that all
+// storage also has corresponding account data.
+func checkDanglingStorage(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	if err := snapshot.CheckDanglingStorage(chaindb); err != nil {
+		log.Error("Failed to check dangling storage", "error", err)
 		return err
 	}
-	log.Info("Verified the state")
 	return nil
 }
 
@@ -264,7 +347,7 @@ func traverseState(ctx *cli.Context) error {
 			return err
 		}
 		if acc.Root != emptyRoot {
-			storageTrie, err := trie.NewSecure(acc.Root, triedb)
+			storageTrie, err := trie.NewSecureWithID(trie.StorageTrieID(root, common.BytesToHash(accIter.Key), acc.Root), triedb)
 			if err != nil {
 				log.Error("Failed to open storage trie", "root", acc.Root, "error", err)
 				return err
@@ -274,14 +357,14 @@ func traverseState(ctx *cli.Context) error {
 				slots += 1
 			}
 			if storageIter.Err != nil {
-				log.Error("Failed to traverse storage trie", "root", acc.Root, "error", storageIter.Err)
+				log.Error("Failed to traverse storage trie", append([]interface{}{"account", common.BytesToHash(accIter.Key), "root", acc.Root}, traversalErrorContext(storageIter.Err)...)...)
 				return storageIter.Err
 			}
 		}
 		if !bytes.Equal(acc.CodeHash, emptyCode) {
 			code := rawdb.ReadCode(chaindb, common.BytesToHash(acc.CodeHash))
 			if len(code) == 0 {
-				log.Error("Code is missing", "hash", common.BytesToHash(acc.CodeHash))
+				log.Error("Code is missing", "account", common.BytesToHash(accIter.Key), "hash", common.BytesToHash(acc.CodeHash))
 				return errors.New("missing code")
 			}
 			codes += 1
@@ -292,7 +375,7 @@ func traverseState(ctx *cli.Context) error {
 		}
 	}
 	if accIter.Err != nil {
-		log.Error("Failed to traverse state trie", "root", root, "error", accIter.Err)
+		log.Error("Failed to traverse state trie", append([]interface{}{"root", root}, traversalErrorContext(accIter.Err)...)...)
 		return accIter.Err
 	}
 	log.Info("State is complete", "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
@@ -359,7 +442,7 @@ func traverseRawState(ctx *cli.Context) error {
 			// have their own hash).
 			blob := rawdb.ReadTrieNode(chaindb, node)
 			if len(blob) == 0 {
-				log.Error("Missing trie node(account)", "hash", node)
+				log.Error("Missing trie node(account)", "hash", node, "path", fmt.Sprintf("%x", accIter.Path()))
 				return errors.New("missing account")
 			}
 		}
@@ -373,7 +456,7 @@ func traverseRawState(ctx *cli.Context) error {
 				return errors.New("invalid account")
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				storageTrie, err := trie.NewSecureWithID(trie.StorageTrieID(root, common.BytesToHash(accIter.LeafKey()), acc.Root), triedb)
 				if err != nil {
 					log.Error("Failed to open storage trie", "root", acc.Root, "error", err)
 					return errors.New("missing storage trie")
@@ -388,7 +471,7 @@ func traverseRawState(ctx *cli.Context) error {
 					if node != (common.Hash{}) {
 						blob := rawdb.ReadTrieNode(chaindb, node)
 						if len(blob) == 0 {
-							log.Error("Missing trie node(storage)", "hash", node)
+							log.Error("Missing trie node(storage)", "account", common.BytesToHash(accIter.LeafKey()), "hash", node, "path", fmt.Sprintf("%x", storageIter.Path()))
 							return errors.New("missing storage")
 						}
 					}
@@ -398,7 +481,7 @@ func traverseRawState(ctx *cli.Context) error {
 					}
 				}
 				if storageIter.Error() != nil {
-					log.Error("Failed to traverse storage trie", "root", acc.Root, "error", storageIter.Error())
+					log.Error("Failed to traverse storage trie", append([]interface{}{"account", common.BytesToHash(accIter.LeafKey()), "root", acc.Root}, traversalErrorContext(storageIter.Error())...)...)
 					return storageIter.Error()
 				}
 			}
@@ -417,13 +500,113 @@ func traverseRawState(ctx *cli.Context) error {
 		}
 	}
 	if accIter.Error() != nil {
-		log.Error("Failed to traverse state trie", "root", root, "error", accIter.Error())
+		log.Error("Failed to traverse state trie", append([]interface{}{"root", root}, traversalErrorContext(accIter.Error())...)...)
 		return accIter.Error()
 	}
 	log.Info("State is complete", "nodes", nodes, "accounts", accounts, "slots", slots, "codes", codes, "elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
 
+// dumpSnapshot exports the flat state snapshot of the given root into a file.
+func dumpSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		log.Error("Wrong number of arguments given")
+		return errors.New("wrong number of arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, chaindb := utils.MakeChain(ctx, stack, true)
+	defer chaindb.Close()
+
+	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, chain.CurrentBlock().Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "error", err)
+		return err
+	}
+	var header = chain.CurrentBlock().Header()
+	if ctx.NArg() == 2 {
+		root, err := parseRoot(ctx.Args()[1])
+		if err != nil {
+			log.Error("Failed to resolve state root", "error", err)
+			return err
+		}
+		// Find the block of the state among the ones retained by the snapshot
+		for i := 0; header != nil && header.Root != root; i++ {
+			if i == core.TriesInMemory {
+				header = nil
+				break
+			}
+			header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+		}
+		if header == nil {
+			log.Error("Failed to find the block of the state root", "root", root)
+			return errors.New("unknown state root")
+		}
+	}
+	file, err := os.Create(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	block := chain.GetBlock(header.Hash(), header.Number.Uint64())
+	if block == nil {
+		log.Error("Failed to load the block of the state", "number", header.Number, "hash", header.Hash())
+		return errors.New("missing block")
+	}
+	writer := bufio.NewWriter(file)
+	if err := snapshot.Export(writer, snaptree, block, chain.GetTd(block.Hash(), block.NumberU64()), chaindb); err != nil {
+		log.Error("Failed to export snapshot", "number", header.Number, "hash", header.Hash(), "root", header.Root, "error", err)
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// importSnapshot rebuilds the flat state snapshot and the state tries from a
+// file created by dumpSnapshot.
+func importSnapshot(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		log.Error("Wrong number of arguments given")
+		return errors.New("wrong number of arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack)
+	defer chaindb.Close()
+
+	if _, _, err := core.SetupGenesisBlock(chaindb, utils.MakeGenesis(ctx)); err != nil {
+		log.Error("Failed to initialize the genesis", "error", err)
+		return err
+	}
+	file, err := os.Open(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header, err := snapshot.Import(bufio.NewReader(file), chaindb)
+	if err != nil {
+		log.Error("Failed to import snapshot", "error", err)
+		return err
+	}
+	log.Info("Verified the imported state", "number", header.Number, "hash", header.Hash(), "root", header.Root)
+	return nil
+}
+
+// traversalErrorContext returns the log context of a trie traversal failure,
+// pointing out the hash and path of the missing trie node if that's the cause.
+func traversalErrorContext(err error) []interface{} {
+	if missing, ok := err.(*trie.MissingNodeError); ok {
+		return []interface{}{"hash", missing.NodeHash, "path", fmt.Sprintf("%x", missing.Path)}
+	}
+	return []interface{}{"error", err}
+}
+
 func parseRoot(input string) (common.Hash, error) {
 	var h common.Hash
 	if err := h.UnmarshalText([]byte(input)); err != nil {
@@ -0,0 +1,82 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that a traversal aborted by a missing trie node reports the hash and
+// path of the node, and that other failures are reported as is.
+func TestTraversalErrorContext(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		triedb = trie.NewDatabase(db)
+	)
+	tr, _ := trie.New(common.Hash{}, triedb)
+	for i := 0; i < 256; i++ {
+		tr.Update(crypto.Keccak256([]byte{byte(i)}), crypto.Keccak256([]byte{byte(i), 0x1}))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit trie database: %v", err)
+	}
+	// Delete an intermediate node of the trie
+	var (
+		hash common.Hash
+		path []byte
+	)
+	tr, _ = trie.New(root, trie.NewDatabase(db))
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) && len(it.Path()) > 0 {
+			hash, path = it.Hash(), append([]byte{}, it.Path()...)
+			break
+		}
+	}
+	if hash == (common.Hash{}) {
+		t.Fatal("no intermediate node found")
+	}
+	rawdb.DeleteTrieNode(db, hash)
+
+	// Traverse the trie again and check the reported context
+	tr, _ = trie.New(root, trie.NewDatabase(db))
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if it.Error() == nil {
+		t.Fatal("traversal succeeded despite the missing node")
+	}
+	ctx := traversalErrorContext(it.Error())
+	if want := []interface{}{"hash", hash, "path", fmt.Sprintf("%x", path)}; fmt.Sprint(ctx) != fmt.Sprint(want) {
+		t.Fatalf("missing node context mismatch: have %v, want %v", ctx, want)
+	}
+	// Other failures should be reported with the error itself
+	err = errors.New("boom")
+	if ctx := traversalErrorContext(err); len(ctx) != 2 || ctx[0] != "error" || ctx[1] != err {
+		t.Fatalf("error context mismatch: have %v", ctx)
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
@@ -207,6 +208,11 @@ type BlockChain struct {
 	processor  Processor // Block transaction processor interface
 	vmConfig   vm.Config
 
+	pruner    *pruner.OnlinePruner // Online state pruner of the last pruning, nil if never started
+	pruning   bool                 // Whether an online state pruning is running
+	pruneErr  error                // Failure of the last online state pruning
+	pruneLock sync.Mutex           // Lock protecting the online pruning fields
+
 	shouldPreserve     func(*types.Block) bool        // Function used to determine whether should preserve the given block.
 	terminateInsert    func(common.Hash, uint64) bool // Testing hook used to terminate ancient receipt chain insertion.
 	writeLegacyJournal bool                           // Testing flag used to flush the snapshot journal in legacy format.
@@ -521,6 +527,12 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
+					// States below the persisted one can be recovered in the path scheme
+					if triedb := bc.stateCache.TrieDB(); !bc.HasState(newHeadBlock.Root()) && triedb.Recoverable(newHeadBlock.Root()) {
+						if err := triedb.Recover(newHeadBlock.Root()); err != nil {
+							log.Error("Failed to recover state", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash(), "err", err)
+						}
+					}
 					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
@@ -691,6 +703,13 @@ func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
 	return state.New(root, bc.stateCache, bc.snaps)
 }
 
+// HistoricStateAt returns a new state for reading based on a particular point
+// in time. As opposed to StateAt, the states whose tries are gone but which are
+// still covered by the snapshot diff layers are served from the snapshot alone.
+func (bc *BlockChain) HistoricStateAt(root common.Hash) (*state.StateDB, error) {
+	return state.NewFromSnapshot(root, bc.stateCache, bc.snaps)
+}
+
 // StateCache returns the caching database underpinning the blockchain instance.
 func (bc *BlockChain) StateCache() state.Database {
 	return bc.stateCache
@@ -1017,9 +1036,15 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
-		triedb := bc.stateCache.TrieDB()
+	if triedb := bc.stateCache.TrieDB(); !bc.cacheConfig.TrieDirtyDisabled && triedb.Scheme() == rawdb.PathScheme {
+		// The path scheme retains a single state on disk, persist the head
+		recent := bc.CurrentBlock()
 
+		log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+		if err := triedb.Commit(recent.Root(), true, nil); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
 			if number := bc.CurrentBlock().NumberU64(); number > offset {
 				recent := bc.GetBlockByNumber(number - offset)
@@ -1538,6 +1563,17 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 		if err := triedb.Commit(root, false, nil); err != nil {
 			return NonStatTy, err
 		}
+	} else if triedb.Scheme() == rawdb.PathScheme {
+		// The path scheme retains the recent states of the canonical chain as
+		// in-memory layers, persisting the older ones in place. Sidechain blocks
+		// leave the persisted state alone, so that the ancestors rebuilt for them
+		// survive until the sidechain overtakes the canonical one.
+		if block.NumberU64() > TriesInMemory && externTd.Cmp(localTd) > 0 {
+			parent := bc.GetHeader(block.ParentHash(), block.NumberU64()-1)
+			if err := triedb.CapLayers(parent.Root, TriesInMemory); err != nil {
+				log.Warn("Failed to cap trie layers", "root", parent.Root, "err", err)
+			}
+		}
 	} else {
 		// Full but not archive node, do proper garbage collection
 		triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
@@ -2078,6 +2114,15 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 	)
 	parent := it.previous()
 	for parent != nil && !bc.HasState(parent.Root) {
+		// States below the persisted one can be rebuilt in memory in the path
+		// scheme, leaving the state of the current chain intact in case the
+		// sidechain turns out to be invalid
+		if triedb := bc.stateCache.TrieDB(); triedb.Recoverable(parent.Root) {
+			if err := triedb.Reconstruct(parent.Root); err != nil {
+				return it.index, err
+			}
+			break
+		}
 		hashes = append(hashes, parent.Hash())
 		numbers = append(numbers, parent.Number.Uint64())
 
@@ -2320,17 +2365,41 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	// where user might init Geth with an external ancient database. If so, we
 	// need to reindex all necessary transactions before starting to process any
 	// pruning requests.
+	// Blocks with pruned history have no bodies to index transactions from, so
+	// never attempt to reindex below the tail of the ancient store.
+	pruned := func() uint64 {
+		tail, _ := bc.db.AncientTail()
+		return tail
+	}
 	if ancients > 0 {
 		var from = uint64(0)
 		if bc.txLookupLimit != 0 && ancients > bc.txLookupLimit {
 			from = ancients - bc.txLookupLimit
 		}
+		if tail := pruned(); from < tail {
+			from = tail
+		}
 		rawdb.IndexTransactions(bc.db, from, ancients, bc.quit)
 	}
 	// indexBlocks reindexes or unindexes transactions depending on user configuration
 	indexBlocks := func(tail *uint64, head uint64, done chan struct{}) {
 		defer func() { done <- struct{}{} }()
 
+		historyTail := pruned()
+
+		// unindex removes the stale tx indices below the new tail. The indices of
+		// blocks with pruned history can't be found without their bodies, so they
+		// are left in place.
+		unindex := func(from, to uint64) {
+			if from < historyTail {
+				from = historyTail
+			}
+			if from < to {
+				rawdb.UnindexTransactions(bc.db, from, to, bc.quit)
+			} else {
+				rawdb.WriteTxIndexTail(bc.db, to)
+			}
+		}
 		// If the user just upgraded Geth to a new version which supports transaction
 		// index pruning, write the new tail and remove anything older.
 		if tail == nil {
@@ -2339,24 +2408,28 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 				rawdb.WriteTxIndexTail(bc.db, 0)
 			} else {
 				// Prune all stale tx indices and record the tx index tail
-				rawdb.UnindexTransactions(bc.db, 0, head-bc.txLookupLimit+1, bc.quit)
+				unindex(0, head-bc.txLookupLimit+1)
 			}
 			return
 		}
 		// If a previous indexing existed, make sure that we fill in any missing entries
 		if bc.txLookupLimit == 0 || head < bc.txLookupLimit {
-			if *tail > 0 {
-				rawdb.IndexTransactions(bc.db, 0, *tail, bc.quit)
+			if *tail > historyTail {
+				rawdb.IndexTransactions(bc.db, historyTail, *tail, bc.quit)
 			}
 			return
 		}
 		// Update the transaction index to the new chain state
 		if head-bc.txLookupLimit+1 < *tail {
 			// Reindex a part of missing indices and rewind index tail to HEAD-limit
-			rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+			from := head - bc.txLookupLimit + 1
+			if from < historyTail {
+				from = historyTail
+			}
+			rawdb.IndexTransactions(bc.db, from, *tail, bc.quit)
 		} else {
 			// Unindex a part of stale indices and forward index tail to HEAD-limit
-			rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
+			unindex(*tail, head-bc.txLookupLimit+1)
 		}
 	}
 	// Any reindexing done, start listening to chain events and moving the index window
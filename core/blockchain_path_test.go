@@ -0,0 +1,258 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that a chain storing its state in the path scheme retains the recent
+// states in memory, persists the head on shutdown and rewinds the persisted
+// state on SetHead.
+func TestPathSchemeChain(t *testing.T) {
+	var (
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+
+		// The contract CC stores the block number into the slot of the same number,
+		// while DD selfdestructs when called
+		cc = common.HexToAddress("0x000000000000000000000000000000000000cccc")
+		dd = common.HexToAddress("0x000000000000000000000000000000000000dddd")
+
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000000)},
+				cc:      {Code: []byte{byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE)}, Balance: big.NewInt(0)},
+				dd: {
+					Code:    []byte{byte(vm.PC), byte(vm.SELFDESTRUCT)},
+					Storage: map[common.Hash]common.Hash{common.HexToHash("01"): common.HexToHash("01")},
+					Balance: big.NewInt(0),
+				},
+			},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, gendb, 2*TriesInMemory, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), cc, big.NewInt(0), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		b.AddTx(tx)
+		if i == 10 {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), dd, big.NewInt(0), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+			b.AddTx(tx)
+		}
+	})
+	db := rawdb.NewMemoryDatabase()
+	if _, err := SetupStateScheme(db, rawdb.PathScheme); err != nil {
+		t.Fatalf("failed to set up state scheme: %v", err)
+	}
+	gspec.MustCommit(db)
+
+	if _, err := SetupStateScheme(db, rawdb.HashScheme); err == nil {
+		t.Fatal("state scheme changed after initialization")
+	}
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	// The recent states must be available in memory, the older ones overwritten
+	for i := 0; i < TriesInMemory; i++ {
+		if block := blocks[len(blocks)-1-i]; !chain.HasState(block.Root()) {
+			t.Fatalf("recent state %d missing", block.NumberU64())
+		}
+	}
+	if block := blocks[len(blocks)-TriesInMemory-3]; chain.HasState(block.Root()) {
+		t.Fatalf("stale state %d available", block.NumberU64())
+	}
+	chain.Stop()
+
+	// The storage of the destructed contract must be wiped from disk
+	it := rawdb.IterateStorageTrieNodes(db, crypto.Keccak256Hash(dd[:]))
+	if it.Next() {
+		t.Fatalf("storage trie node of destructed contract retained: %x", it.Key())
+	}
+	it.Release()
+
+	// Reopen the chain and rewind it beyond the persisted state
+	chain, err = NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	head := blocks[len(blocks)-1]
+	if chain.CurrentBlock().Hash() != head.Hash() {
+		t.Fatalf("head mismatch after restart: have %d, want %d", chain.CurrentBlock().NumberU64(), head.NumberU64())
+	}
+	target := blocks[TriesInMemory-1]
+	if err := chain.SetHead(target.NumberU64()); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if chain.CurrentBlock().Hash() != target.Hash() {
+		t.Fatalf("head mismatch after rewind: have %d, want %d", chain.CurrentBlock().NumberU64(), target.NumberU64())
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open rewound state: %v", err)
+	}
+	for n := uint64(1); n <= target.NumberU64()+1; n++ {
+		want := common.BigToHash(new(big.Int).SetUint64(n))
+		if n > target.NumberU64() {
+			want = common.Hash{}
+		}
+		if have := statedb.GetState(cc, common.BigToHash(new(big.Int).SetUint64(n))); have != want {
+			t.Fatalf("slot %d mismatch: have %x, want %x", n, have, want)
+		}
+	}
+	// Ensure the chain can be extended again on top of the rewound state
+	if n, err := chain.InsertChain(blocks[TriesInMemory:]); err != nil {
+		t.Fatalf("block %d: failed to reinsert into chain: %v", n, err)
+	}
+	if chain.CurrentBlock().Hash() != head.Hash() {
+		t.Fatalf("head mismatch after reimport: have %d, want %d", chain.CurrentBlock().NumberU64(), head.NumberU64())
+	}
+}
+
+// Tests that a sidechain forking off below the persisted state can be imported
+// in the path scheme by rebuilding the state of the fork point, and that the
+// state of the canonical chain survives if the sidechain turns out invalid.
+func TestPathSchemeDeepReorg(t *testing.T)        { testPathSchemeDeepReorg(t, false) }
+func TestPathSchemeDeepReorgInvalid(t *testing.T) { testPathSchemeDeepReorg(t, true) }
+
+func testPathSchemeDeepReorg(t *testing.T, invalid bool) {
+	var (
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		cc      = common.HexToAddress("0x000000000000000000000000000000000000cccc")
+		miner   = common.HexToAddress("0x000000000000000000000000000000000000beef")
+
+		gspec = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000000000000)},
+				cc:      {Code: []byte{byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE)}, Balance: big.NewInt(0)},
+			},
+		}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	call := func(b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), cc, big.NewInt(0), 50000, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		b.AddTx(tx)
+	}
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, gendb, 2*TriesInMemory, func(i int, b *BlockGen) {
+		call(b)
+	})
+	// Fork off below the persisted state, skipping the contract calls on the
+	// sidechain and crediting a different miner
+	fork := blocks[9]
+	forks, _ := GenerateChain(params.TestChainConfig, fork, engine, gendb, 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(miner)
+	})
+	if invalid {
+		// Corrupt the state root of a sidechain block before the sidechain
+		// overtakes the canonical one, relinking the descendants on top
+		header := forks[TriesInMemory].Header()
+		header.Root = common.Hash{0x1}
+		forks[TriesInMemory] = types.NewBlockWithHeader(header)
+		for i := TriesInMemory + 1; i < len(forks); i++ {
+			header := forks[i].Header()
+			header.ParentHash = forks[i-1].Hash()
+			forks[i] = types.NewBlockWithHeader(header)
+		}
+	}
+	db := rawdb.NewMemoryDatabase()
+	if _, err := SetupStateScheme(db, rawdb.PathScheme); err != nil {
+		t.Fatalf("failed to set up state scheme: %v", err)
+	}
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	if chain.HasState(fork.Root()) {
+		t.Fatalf("fork point state %d available in memory", fork.NumberU64())
+	}
+	if invalid {
+		if n, err := chain.InsertChain(forks); err == nil {
+			t.Fatal("invalid sidechain imported")
+		} else if n != TriesInMemory {
+			t.Fatalf("failing block mismatch: have %d, want %d", n, TriesInMemory)
+		}
+		head := blocks[len(blocks)-1]
+		if chain.CurrentBlock().Hash() != head.Hash() {
+			t.Fatalf("head mismatch after failed reorg: have %d, want %d", chain.CurrentBlock().NumberU64(), head.NumberU64())
+		}
+		for i := 0; i < TriesInMemory; i++ {
+			if block := blocks[len(blocks)-1-i]; !chain.HasState(block.Root()) {
+				t.Fatalf("canonical state %d lost after failed reorg", block.NumberU64())
+			}
+		}
+		statedb, err := chain.State()
+		if err != nil {
+			t.Fatalf("failed to open canonical state: %v", err)
+		}
+		slot := common.BigToHash(head.Number())
+		if have := statedb.GetState(cc, slot); have != slot {
+			t.Fatalf("canonical slot mismatch: have %x, want %x", have, slot)
+		}
+		return
+	}
+	if n, err := chain.InsertChain(forks); err != nil {
+		t.Fatalf("block %d: failed to insert sidechain: %v", n, err)
+	}
+	head := forks[len(forks)-1]
+	if chain.CurrentBlock().Hash() != head.Hash() {
+		t.Fatalf("head mismatch after reorg: have %d, want %d", chain.CurrentBlock().NumberU64(), head.NumberU64())
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("failed to open reorged state: %v", err)
+	}
+	for n := uint64(1); n <= fork.NumberU64()+1; n++ {
+		want := common.BigToHash(new(big.Int).SetUint64(n))
+		if n > fork.NumberU64() {
+			want = common.Hash{}
+		}
+		if have := statedb.GetState(cc, common.BigToHash(new(big.Int).SetUint64(n))); have != want {
+			t.Fatalf("slot %d mismatch: have %x, want %x", n, have, want)
+		}
+	}
+	if statedb.GetBalance(miner).Sign() == 0 {
+		t.Fatal("sidechain miner not credited")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errPruningRunning is returned if an online state pruning is requested
+	// while another one is still running.
+	errPruningRunning = errors.New("state pruning already running")
+
+	// errPruningNoSnapshot is returned if an online state pruning is requested
+	// without the snapshots being enabled.
+	errPruningNoSnapshot = errors.New("state pruning requires snapshots")
+
+	// errPruningArchive is returned if an online state pruning is requested on
+	// an archive node.
+	errPruningArchive = errors.New("state pruning is not supported in archive mode")
+)
+
+// StatePruningStatus is the progress of the last online state pruning.
+type StatePruningStatus struct {
+	pruner.OnlineStatus
+	Running bool   `json:"running"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PruneState starts deleting all state not belonging to the given root, the
+// recent live states or the genesis in the background, while the chain keeps
+// importing blocks. The root defaults to the current head if empty, and must
+// be available both in the snapshot and in the trie database.
+func (bc *BlockChain) PruneState(root common.Hash, config pruner.OnlineConfig) error {
+	if bc.snaps == nil {
+		return errPruningNoSnapshot
+	}
+	if bc.cacheConfig.TrieDirtyDisabled {
+		return errPruningArchive
+	}
+	bc.pruneLock.Lock()
+	defer bc.pruneLock.Unlock()
+
+	if bc.pruning {
+		return errPruningRunning
+	}
+	if root == (common.Hash{}) {
+		root = bc.CurrentBlock().Root()
+	}
+	if bc.snaps.Snapshot(root) == nil {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	// Pin the target state in the trie database before checking its presence, so
+	// that it can't be garbage collected while marking the live states.
+	triedb := bc.stateCache.TrieDB()
+	triedb.Reference(root, common.Hash{})
+	if !bc.HasState(root) {
+		triedb.Dereference(root)
+		return fmt.Errorf("state [%#x] missing", root)
+	}
+	p, err := pruner.NewOnlinePruner(bc.db, root, config)
+	if err != nil {
+		triedb.Dereference(root)
+		return err
+	}
+	// Stop the snapshot from flattening the layer of the target while it's being
+	// iterated, and mark every node flushed from now on.
+	release, err := bc.snaps.Pin(root)
+	if err != nil {
+		triedb.Dereference(root)
+		return err
+	}
+	triedb.SetFlushHook(p.Mark)
+
+	bc.pruner, bc.pruning, bc.pruneErr = p, true, nil
+
+	bc.wg.Add(1)
+	go bc.pruneState(p, release)
+	return nil
+}
+
+// pruneState runs an online state pruning, marking all the live trie nodes and
+// sweeping the rest.
+func (bc *BlockChain) pruneState(p *pruner.OnlinePruner, release func()) {
+	defer bc.wg.Done()
+
+	var (
+		start  = time.Now()
+		triedb = bc.stateCache.TrieDB()
+		root   = p.Status().Root
+	)
+	log.Info("Started online state pruning", "root", root)
+
+	err := func() error {
+		defer triedb.Dereference(root)
+
+		err := p.MarkState(bc.snaps, bc.quit)
+		release()
+		if err != nil {
+			return err
+		}
+		// Mark all the nodes of the recent states which are not part of the target.
+		// Any state created later is derived from these, with all the new nodes
+		// marked by the flush hook.
+		head := bc.CurrentBlock().NumberU64()
+		for number := head; number+TriesInMemory > head && number > 0; number-- {
+			for _, hash := range rawdb.ReadAllHashes(bc.db, number) {
+				header := bc.GetHeader(hash, number)
+				if header == nil {
+					continue
+				}
+				triedb.Reference(header.Root, common.Hash{})
+				if !bc.HasState(header.Root) {
+					triedb.Dereference(header.Root)
+					continue // Garbage collected in the meantime
+				}
+				err := p.MarkLive(triedb, header.Root, bc.quit)
+				triedb.Dereference(header.Root)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		// Persist the current head state so that there's always a complete state
+		// on disk to recover from if the node crashes after the sweep.
+		bc.chainmu.Lock()
+		err = triedb.Commit(bc.CurrentBlock().Root(), false, nil)
+		bc.chainmu.Unlock()
+		if err != nil {
+			return err
+		}
+		return p.Sweep(bc.quit)
+	}()
+	triedb.SetFlushHook(nil)
+
+	bc.pruneLock.Lock()
+	bc.pruning, bc.pruneErr = false, err
+	bc.pruneLock.Unlock()
+
+	if err != nil {
+		log.Error("Online state pruning failed", "root", root, "err", err)
+		return
+	}
+	status := p.Status()
+	log.Info("Finished online state pruning", "root", root, "nodes", status.Swept, "size", status.Size, "elapsed", common.PrettyDuration(time.Since(start)))
+}
+
+// PruningStatus returns the progress of the current or last online state pruning,
+// or nil if none was started yet.
+func (bc *BlockChain) PruningStatus() *StatePruningStatus {
+	bc.pruneLock.Lock()
+	defer bc.pruneLock.Unlock()
+
+	if bc.pruner == nil {
+		return nil
+	}
+	status := &StatePruningStatus{
+		OnlineStatus: bc.pruner.Status(),
+		Running:      bc.pruning,
+	}
+	if bc.pruneErr != nil {
+		status.Error = bc.pruneErr.Error()
+	}
+	return status
+}
@@ -0,0 +1,171 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that online state pruning deletes the stale state persisted on disk,
+// while retaining the head, the recent and the genesis states.
+func TestOnlineStatePruning(t *testing.T) {
+	engine := ethash.NewFaker()
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 2*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0: byte(i), 19: byte(i)})
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	// Import a few blocks and persist a state which will go stale
+	if _, err := chain.InsertChain(blocks[:16]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	stale := blocks[15].Root()
+	if err := chain.stateCache.TrieDB().Commit(stale, false, nil); err != nil {
+		t.Fatalf("failed to commit stale state: %v", err)
+	}
+	if _, err := chain.InsertChain(blocks[16:]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	if err := chain.PruneState(common.Hash{}, pruner.OnlineConfig{}); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	if err := chain.PruneState(common.Hash{}, pruner.OnlineConfig{}); err != errPruningRunning {
+		t.Fatalf("concurrent pruning error mismatch: have %v, want %v", err, errPruningRunning)
+	}
+	for chain.PruningStatus().Running {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := chain.PruningStatus()
+	if status.Error != "" {
+		t.Fatalf("pruning failed: %v", status.Error)
+	}
+	if status.Root != blocks[len(blocks)-1].Root() {
+		t.Fatalf("pruning root mismatch: have %x, want %x", status.Root, blocks[len(blocks)-1].Root())
+	}
+	if status.Swept == 0 {
+		t.Fatal("no stale state pruned")
+	}
+	if ok, _ := diskdb.Has(stale[:]); ok {
+		t.Fatal("stale state root not pruned")
+	}
+	// Ensure the retained states are fully present on disk
+	for _, root := range []common.Hash{genesis.Root(), blocks[len(blocks)-1].Root()} {
+		statedb, err := state.New(root, state.NewDatabase(diskdb), nil)
+		if err != nil {
+			t.Fatalf("failed to open state %x: %v", root, err)
+		}
+		it := state.NewNodeIterator(statedb)
+		for it.Next() {
+		}
+		if it.Error != nil {
+			t.Fatalf("state %x corrupted: %v", root, it.Error)
+		}
+	}
+	for i := 1; i < TriesInMemory; i++ {
+		if root := blocks[len(blocks)-1-i].Root(); !chain.HasState(root) {
+			t.Fatalf("recent state %d missing", len(blocks)-i)
+		}
+	}
+}
+
+// Tests that blocks can be imported while an online state pruning is running,
+// without the pruning deleting any of the states they create.
+func TestOnlineStatePruningDuringImport(t *testing.T) {
+	engine := ethash.NewFaker()
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := new(Genesis).MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 4*TriesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.Address{0: byte(i), 19: byte(i >> 8)})
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	new(Genesis).MustCommit(diskdb)
+
+	chain, err := NewBlockChain(diskdb, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks[:2*TriesInMemory]); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	target := blocks[2*TriesInMemory-1].Root()
+	if err := chain.PruneState(common.Hash{}, pruner.OnlineConfig{}); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	// Keep importing blocks one by one, beyond the snapshot layer limit, while
+	// the pruning is running in the background
+	for i := 2 * TriesInMemory; i < len(blocks); i++ {
+		if _, err := chain.InsertChain(blocks[i : i+1]); err != nil {
+			t.Fatalf("failed to insert block %d during pruning: %v", i, err)
+		}
+	}
+	for chain.PruningStatus().Running {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := chain.PruningStatus()
+	if status.Error != "" {
+		t.Fatalf("pruning failed: %v", status.Error)
+	}
+	if status.Root != target {
+		t.Fatalf("pruning root mismatch: have %x, want %x", status.Root, target)
+	}
+	if head := chain.CurrentBlock().Hash(); head != blocks[len(blocks)-1].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, blocks[len(blocks)-1].Hash())
+	}
+	// Ensure the recent states, all created during the pruning, are complete
+	for i := 0; i < TriesInMemory; i++ {
+		root := blocks[len(blocks)-1-i].Root()
+		statedb, err := state.New(root, chain.stateCache, nil)
+		if err != nil {
+			t.Fatalf("failed to open recent state %d: %v", len(blocks)-i, err)
+		}
+		it := state.NewNodeIterator(statedb)
+		for it.Next() {
+		}
+		if it.Error != nil {
+			t.Fatalf("recent state %d corrupted: %v", len(blocks)-i, it.Error)
+		}
+	}
+	// Ensure the snapshot kept up with the chain after the target was released
+	if snap := chain.snaps.Snapshot(blocks[len(blocks)-1].Root()); snap == nil {
+		t.Fatal("head snapshot missing")
+	}
+	if err := chain.snaps.Verify(blocks[len(blocks)-1].Root()); err != nil {
+		t.Fatalf("head snapshot corrupted: %v", err)
+	}
+}
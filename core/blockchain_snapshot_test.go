@@ -23,16 +23,19 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 )
@@ -1021,3 +1024,74 @@ func TestRecoverSnapshotFromWipingCrash(t *testing.T) {
 	test.test(t)
 	test.teardown()
 }
+
+// Tests that the states of recent blocks remain readable through the snapshot
+// diff layers after a restart, even though their tries were never persisted.
+func TestHistoricalStateFromSnapshot(t *testing.T) {
+	var (
+		engine  = ethash.NewFaker()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: big.NewInt(1000000000000000000)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	// Every block credits a fresh account with the block number in wei
+	recipient := func(n uint64) common.Address { return common.BigToAddress(new(big.Int).SetUint64(0x1000 + n)) }
+
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, gendb, 64, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), recipient(b.Number().Uint64()), b.Number(), params.TxGas, big.NewInt(1), nil), types.HomesteadSigner{}, key)
+		b.AddTx(tx)
+	})
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	chain.Stop()
+
+	// Restart the chain, only the head states are persisted, the rest is
+	// available via the journalled snapshot diff layers
+	chain, err = NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	target := blocks[len(blocks)-50]
+	if chain.HasState(target.Root()) {
+		t.Fatalf("state trie of block %d unexpectedly persisted", target.NumberU64())
+	}
+	if _, err := chain.StateAt(target.Root()); err == nil {
+		t.Fatalf("state of block %d opened without its trie", target.NumberU64())
+	}
+	statedb, err := chain.HistoricStateAt(target.Root())
+	if err != nil {
+		t.Fatalf("failed to open historical state: %v", err)
+	}
+	for n := uint64(1); n <= target.NumberU64()+1; n++ {
+		want := new(big.Int).SetUint64(n)
+		if n > target.NumberU64() {
+			want = new(big.Int)
+		}
+		if have := statedb.GetBalance(recipient(n)); have.Cmp(want) != 0 {
+			t.Fatalf("account %d balance mismatch: have %v, want %v", n, have, want)
+		}
+	}
+	if have, want := statedb.GetNonce(address), target.NumberU64(); have != want {
+		t.Fatalf("sender nonce mismatch: have %d, want %d", have, want)
+	}
+	// States covered by neither the tries nor the snapshot must still fail
+	// Iterating the snapshot-only state needs the trie and must fail loudly
+	if dump := statedb.RawDump(true, true, false); len(dump.Accounts) != 0 || statedb.Error() == nil {
+		t.Fatalf("snapshot-only state dumped: %d accounts, error %v", len(dump.Accounts), statedb.Error())
+	}
+	if _, err := chain.HistoricStateAt(common.Hash{0x01}); err == nil {
+		t.Fatal("unknown state opened")
+	}
+}
@@ -139,6 +139,27 @@ func (e *GenesisMismatchError) Error() string {
 	return fmt.Sprintf("database contains incompatible genesis (have %x, new %x)", e.Stored, e.New)
 }
 
+// SetupStateScheme validates the requested scheme of the state trie nodes against
+// the one recorded in the database, recording it if the database is still empty.
+// An empty scheme accepts whatever is recorded. The scheme in use is returned.
+func SetupStateScheme(db ethdb.Database, scheme string) (string, error) {
+	switch scheme {
+	case "", rawdb.HashScheme, rawdb.PathScheme:
+	default:
+		return "", fmt.Errorf("unknown state scheme %q", scheme)
+	}
+	stored := rawdb.ReadStateScheme(db)
+	if scheme == "" || scheme == stored {
+		return stored, nil
+	}
+	// The scheme can only be changed before any state is written
+	if rawdb.ReadCanonicalHash(db, 0) != (common.Hash{}) {
+		return "", fmt.Errorf("incompatible state scheme, stored: %s, provided: %s", stored, scheme)
+	}
+	rawdb.WriteStateScheme(db, scheme)
+	return scheme, nil
+}
+
 // SetupGenesisBlock writes or updates the genesis block in db.
 // The block that will be used is:
 //
@@ -176,9 +197,10 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		return genesis.Config, block.Hash(), nil
 	}
 	// We have the genesis block in database(perhaps in ancient database)
-	// but the corresponding state is missing.
+	// but the corresponding state is missing. The path scheme only retains
+	// the latest state, so the genesis state is expected to be gone there.
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil {
+	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil && rawdb.ReadStateScheme(db) != rawdb.PathScheme {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
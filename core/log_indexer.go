@@ -0,0 +1,171 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// logIndexThrottling is the time to wait between processing two consecutive
+	// log index sections, preventing the backfill from overloading the disk.
+	logIndexThrottling = 100 * time.Millisecond
+)
+
+// LogPosition is the location of a log in the chain.
+type LogPosition struct {
+	Block   uint64 // Number of the block containing the log
+	TxIndex uint   // Index of the transaction emitting the log within the block
+	Index   uint   // Index of the log within the block
+}
+
+// LogAddressTerm returns the log index term of the logs emitted by the given
+// contract.
+func LogAddressTerm(addr common.Address) []byte {
+	return append([]byte{0}, addr.Bytes()...)
+}
+
+// LogTopicTerm returns the log index term of the logs having the given topic at
+// the given position.
+func LogTopicTerm(position int, topic common.Hash) []byte {
+	return append([]byte{byte(position + 1)}, topic.Bytes()...)
+}
+
+// LogIndexer implements a core.ChainIndexer, mapping the addresses and the
+// positional topics of the logs in the canonical chain to the positions of the
+// logs, permitting log filtering without bloom false positives.
+//
+// The index data of a section is keyed by the section head, so the sections
+// rolled back by a reorg are reindexed without clashing with the stale data,
+// which is deleted once the section is committed again.
+type LogIndexer struct {
+	size    uint64                   // section size to generate the log index for
+	chainDb ethdb.Database           // database instance to read the receipts from
+	indexDb ethdb.Database           // dedicated database instance to write index data into
+	section uint64                   // Section is the section number being processed currently
+	head    common.Hash              // Head is the hash of the last header processed
+	terms   map[string][]LogPosition // Positions of the logs of the section by term
+}
+
+// NewLogIndexer returns a chain indexer that generates the log index of the
+// canonical chain into a dedicated database. As the progress is tracked per
+// section, the backfill of an existing chain resumes after restarts.
+func NewLogIndexer(chainDb, indexDb ethdb.Database, size, confirms uint64) *ChainIndexer {
+	backend := &LogIndexer{
+		chainDb: chainDb,
+		indexDb: indexDb,
+		size:    size,
+	}
+	table := rawdb.NewTable(indexDb, string(rawdb.LogIndexPrefix))
+
+	return NewChainIndexer(chainDb, table, backend, size, confirms, logIndexThrottling, "logindex")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new log index section.
+func (b *LogIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	b.section, b.head, b.terms = section, common.Hash{}, make(map[string][]LogPosition)
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding the logs of a new header
+// into the index. Blocks with pruned history are skipped.
+func (b *LogIndexer) Process(ctx context.Context, header *types.Header) error {
+	hash, number := header.Hash(), header.Number.Uint64()
+
+	receipts := rawdb.ReadRawReceipts(b.chainDb, hash, number)
+	if receipts == nil && header.ReceiptHash != types.EmptyRootHash {
+		// The receipts below the ancient tail were pruned and won't come back, so
+		// leave the block out of the index instead of retrying forever. Queries
+		// of pruned blocks are rejected by the filters.
+		if tail, err := b.chainDb.AncientTail(); err != nil || number >= tail {
+			return fmt.Errorf("receipts of block #%d [%x…] not found", number, hash[:4])
+		}
+	}
+	var index uint
+	for i, receipt := range receipts {
+		for _, log := range receipt.Logs {
+			pos := LogPosition{Block: number, TxIndex: uint(i), Index: index}
+
+			b.add(LogAddressTerm(log.Address), pos)
+			for j, topic := range log.Topics {
+				b.add(LogTopicTerm(j, topic), pos)
+			}
+			index++
+		}
+	}
+	b.head = hash
+	return nil
+}
+
+// add appends a log position to the positions of a term.
+func (b *LogIndexer) add(term []byte, pos LogPosition) {
+	b.terms[string(term)] = append(b.terms[string(term)], pos)
+}
+
+// Commit implements core.ChainIndexerBackend, finalizing the log index section
+// and writing it out into the database. The data of the section indexed for a
+// previous section head is deleted in the same batch.
+func (b *LogIndexer) Commit() error {
+	batch := b.indexDb.NewBatch()
+	rawdb.DeleteStaleLogIndex(b.indexDb, batch, b.section, b.head)
+
+	for term, positions := range b.terms {
+		blob, err := rlp.EncodeToBytes(positions)
+		if err != nil {
+			return err
+		}
+		rawdb.WriteLogIndex(batch, []byte(term), b.section, b.head, blob)
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	return batch.Write()
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (b *LogIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// ReadLogIndex retrieves the positions of the logs matching the given term
+// within a section of the canonical chain indexed by a log indexer.
+func ReadLogIndex(chainDb ethdb.Reader, indexDb ethdb.KeyValueReader, size, section uint64, term []byte) ([]LogPosition, error) {
+	head := rawdb.ReadCanonicalHash(chainDb, (section+1)*size-1)
+	if head == (common.Hash{}) {
+		return nil, fmt.Errorf("canonical block #%d unknown", (section+1)*size-1)
+	}
+	blob := rawdb.ReadLogIndex(indexDb, term, section, head)
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	var positions []LogPosition
+	if err := rlp.DecodeBytes(blob, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
@@ -0,0 +1,204 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the log indexer maps the addresses and topics of the logs to their
+// positions, and that reorged sections are reindexed replacing their stale data.
+func TestLogIndexer(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		indexDb = rawdb.NewMemoryDatabase()
+		genesis = new(Genesis).MustCommit(db)
+		addr1   = common.Address{0x1}
+		addr2   = common.Address{0x2}
+		topic   = common.Hash{0x1}
+	)
+	// makeChain generates and writes canonical blocks with a log of the first
+	// address in each of them, and one of the second address in every fourth.
+	// The second topic of the logs identifies the fork.
+	makeChain := func(parent *types.Block, n int, fork byte) []*types.Block {
+		blocks, receipts := GenerateChain(params.TestChainConfig, parent, ethash.NewFaker(), db, n, func(i int, gen *BlockGen) {
+			addrs := []common.Address{addr1}
+			if gen.Number().Uint64()%4 == 0 {
+				addrs = append(addrs, addr2)
+			}
+			for j, addr := range addrs {
+				receipt := types.NewReceipt(nil, false, 0)
+				receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{topic, {fork}}}}
+				gen.AddUncheckedReceipt(receipt)
+				gen.AddUncheckedTx(types.NewTransaction(uint64(j), common.Address{fork}, big.NewInt(1), 1, big.NewInt(1), nil))
+			}
+		})
+		for i, block := range blocks {
+			rawdb.WriteBlock(db, block)
+			rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+			rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		}
+		return blocks
+	}
+	chain := makeChain(genesis, 48, 0)
+
+	indexer := NewLogIndexer(db, indexDb, 16, 0)
+	defer indexer.Close()
+
+	// waitHead waits until the indexer covers the given section head
+	waitHead := func(head *types.Block) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if sections, _, hash := indexer.Sections(); sections == (head.NumberU64()+1)/16 && hash == head.Hash() {
+				return
+			}
+		}
+		t.Fatalf("section head %d not indexed", head.NumberU64())
+	}
+	// check verifies the positions of the logs matching a term in a section
+	check := func(section uint64, term []byte, want []LogPosition) {
+		t.Helper()
+		have, err := ReadLogIndex(db, indexDb, 16, section, term)
+		if err != nil {
+			t.Fatalf("failed to read log index: %v", err)
+		}
+		if len(have) != len(want) {
+			t.Fatalf("section %d, term %x: position count mismatch: have %d, want %d", section, term, len(have), len(want))
+		}
+		for i := range have {
+			if have[i] != want[i] {
+				t.Fatalf("section %d, term %x: position %d mismatch: have %v, want %v", section, term, i, have[i], want[i])
+			}
+		}
+	}
+	// positions returns the expected positions of the logs of an address or of
+	// a fork in the given block range
+	positions := func(from, to uint64, addr *common.Address) []LogPosition {
+		var res []LogPosition
+		for n := from; n <= to; n++ {
+			if addr == nil || *addr == addr1 {
+				res = append(res, LogPosition{Block: n})
+			}
+			if n%4 == 0 && (addr == nil || *addr == addr2) {
+				res = append(res, LogPosition{Block: n, TxIndex: 1, Index: 1})
+			}
+		}
+		return res
+	}
+	indexer.newHead(chain[len(chain)-1].NumberU64(), false)
+	waitHead(chain[46])
+
+	check(0, LogAddressTerm(addr1), positions(1, 15, &addr1))
+	check(1, LogAddressTerm(addr2), positions(16, 31, &addr2))
+	check(2, LogTopicTerm(0, topic), positions(32, 47, nil))
+	check(2, LogTopicTerm(1, common.Hash{0}), positions(32, 47, nil))
+	check(1, LogTopicTerm(1, topic), nil)
+
+	// Reorg the chain in the middle of the second section and ensure that the
+	// reorged sections are reindexed
+	fork := makeChain(chain[19], 28, 1)
+
+	indexer.newHead(chain[19].NumberU64(), true)
+	indexer.newHead(fork[len(fork)-1].NumberU64(), false)
+	waitHead(fork[26])
+
+	check(0, LogAddressTerm(addr1), positions(1, 15, &addr1))
+	check(1, LogTopicTerm(1, common.Hash{0}), positions(16, 20, nil))
+	check(1, LogTopicTerm(1, common.Hash{1}), positions(21, 31, nil))
+	check(2, LogTopicTerm(1, common.Hash{0}), nil)
+	check(2, LogTopicTerm(1, common.Hash{1}), positions(32, 47, nil))
+
+	// Ensure that only the index data of the current section heads is retained
+	heads := map[common.Hash]bool{chain[14].Hash(): true, fork[10].Hash(): true, fork[26].Hash(): true}
+	it := indexDb.NewIterator([]byte("L"), nil)
+	defer it.Release()
+	for it.Next() {
+		if head := common.BytesToHash(it.Key()[len(it.Key())-common.HashLength:]); !heads[head] {
+			t.Fatalf("stale log index data retained: %x", it.Key())
+		}
+	}
+}
+
+// Tests that the log indexer skips the blocks whose receipts were pruned from
+// the ancient store instead of stalling on them.
+func TestLogIndexerPrunedHistory(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		indexDb = rawdb.NewMemoryDatabase()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = new(Genesis).MustCommit(gendb)
+		addr    = common.Address{0x1}
+	)
+	blocks, receipts := GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 31, func(i int, gen *BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr}}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(0, common.Address{0x2}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	blocks = append([]*types.Block{genesis}, blocks...)
+	receipts = append([]types.Receipts{nil}, receipts...)
+	for i, block := range blocks {
+		rawdb.WriteAncientBlock(db, block, receipts[i], big.NewInt(int64(i)))
+	}
+	if err := db.TruncateAncientTail(20); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	indexer := NewLogIndexer(db, indexDb, 16, 0)
+	defer indexer.Close()
+
+	indexer.newHead(blocks[len(blocks)-1].NumberU64(), false)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if sections, _, _ := indexer.Sections(); sections == 2 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("sections with pruned history not indexed")
+		}
+	}
+	for section, want := range []int{0, 12} {
+		positions, err := ReadLogIndex(db, indexDb, 16, uint64(section), LogAddressTerm(addr))
+		if err != nil {
+			t.Fatalf("section %d: failed to read log index: %v", section, err)
+		}
+		if len(positions) != want {
+			t.Fatalf("section %d: position count mismatch: have %d, want %d", section, len(positions), want)
+		}
+		if want > 0 && positions[0].Block != 20 {
+			t.Fatalf("section %d: first indexed block mismatch: have %d, want 20", section, positions[0].Block)
+		}
+	}
+}
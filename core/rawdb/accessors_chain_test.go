@@ -29,6 +29,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
@@ -440,7 +441,7 @@ func TestAncientStorage(t *testing.T) {
 	}
 	defer os.Remove(frdir)
 
-	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "")
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil)
 	if err != nil {
 		t.Fatalf("failed to create database with ancient backend")
 	}
@@ -496,6 +497,64 @@ func TestAncientStorage(t *testing.T) {
 	}
 }
 
+func TestAncientTailTruncation(t *testing.T) {
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+
+	db, err := NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend")
+	}
+	var blocks []*types.Block
+	for i := 0; i < 4; i++ {
+		block := types.NewBlockWithHeader(&types.Header{
+			Number:      big.NewInt(int64(i)),
+			Extra:       []byte("test block"),
+			UncleHash:   types.EmptyUncleHash,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		})
+		WriteAncientBlock(db, block, nil, big.NewInt(100))
+		blocks = append(blocks, block)
+	}
+	if err := db.TruncateAncientTail(5); err == nil {
+		t.Fatalf("truncated tail above the frozen blocks")
+	}
+	if err := db.TruncateAncientTail(2); err != nil {
+		t.Fatalf("failed to truncate tail: %v", err)
+	}
+	check := func(db ethdb.Database) {
+		t.Helper()
+		if tail, err := db.AncientTail(); err != nil || tail != 2 {
+			t.Fatalf("tail mismatch: have %d, want %d (err %v)", tail, 2, err)
+		}
+		for _, block := range blocks {
+			hash, number := block.Hash(), block.NumberU64()
+			if blob := ReadHeaderRLP(db, hash, number); len(blob) == 0 {
+				t.Fatalf("block %d: no header returned", number)
+			}
+			if blob := ReadBodyRLP(db, hash, number); (len(blob) == 0) != (number < 2) {
+				t.Fatalf("block %d: body presence mismatch", number)
+			}
+			if blob := ReadReceiptsRLP(db, hash, number); (len(blob) == 0) != (number < 2) {
+				t.Fatalf("block %d: receipts presence mismatch", number)
+			}
+		}
+	}
+	check(db)
+	db.Close()
+
+	// Reopen the database and ensure the tail is persisted
+	if db, err = NewDatabaseWithFreezer(NewMemoryDatabase(), frdir, "", nil); err != nil {
+		t.Fatalf("failed to reopen database with ancient backend")
+	}
+	defer db.Close()
+	check(db)
+}
+
 func TestCanonicalHashIteration(t *testing.T) {
 	var cases = []struct {
 		from, to uint64
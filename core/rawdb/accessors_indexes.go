@@ -106,7 +106,10 @@ func ReadTransaction(db ethdb.Reader, hash common.Hash) (*types.Transaction, com
 	}
 	body := ReadBody(db, blockHash, *blockNumber)
 	if body == nil {
-		log.Error("Transaction referenced missing", "number", blockNumber, "hash", blockHash)
+		// The index of transactions in blocks with pruned history is retained
+		if tail, err := db.AncientTail(); err != nil || *blockNumber >= tail {
+			log.Error("Transaction referenced missing", "number", blockNumber, "hash", blockHash)
+		}
 		return nil, common.Hash{}, 0, 0
 	}
 	for txIndex, tx := range body.Transactions {
@@ -175,3 +178,42 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// ReadLogIndex retrieves the RLP encoded positions of the logs matching the
+// given term within a section of the log index.
+func ReadLogIndex(db ethdb.KeyValueReader, term []byte, section uint64, head common.Hash) []byte {
+	data, _ := db.Get(logIndexKey(term, section, head))
+	return data
+}
+
+// WriteLogIndex stores the RLP encoded positions of the logs matching the given
+// term within a section of the log index.
+func WriteLogIndex(db ethdb.KeyValueWriter, term []byte, section uint64, head common.Hash, positions []byte) {
+	if err := db.Put(logIndexKey(term, section, head), positions); err != nil {
+		log.Crit("Failed to store log index", "err", err)
+	}
+}
+
+// DeleteStaleLogIndex removes the log index data of the given section that was
+// generated for any other section head than the given one, i.e. the leftovers
+// of sections reindexed after a reorg. The deletions are written into the batch.
+func DeleteStaleLogIndex(db ethdb.Iteratee, batch ethdb.KeyValueWriter, section uint64, head common.Hash) {
+	it := db.NewIterator(logIndexSectionKey(section), nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) < len(logIndexPrefix)+8+common.HashLength {
+			continue
+		}
+		if common.BytesToHash(key[len(key)-common.HashLength:]) == head {
+			continue
+		}
+		if err := batch.Delete(key); err != nil {
+			log.Crit("Failed to delete stale log index", "err", err)
+		}
+	}
+	if it.Error() != nil {
+		log.Crit("Failed to iterate log index", "err", it.Error())
+	}
+}
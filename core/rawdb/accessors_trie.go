@@ -0,0 +1,188 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// The schemes the state trie nodes can be stored in.
+const (
+	// HashScheme stores the trie nodes keyed by their hash. It's the legacy
+	// scheme which retains every state ever persisted until pruned.
+	HashScheme = "hash"
+
+	// PathScheme stores the trie nodes keyed by the owner account and the
+	// path in the trie. New nodes overwrite stale ones in place, so only a
+	// single state is retained on disk.
+	PathScheme = "path"
+)
+
+// ReadStateScheme retrieves the scheme of the trie nodes in the database. The
+// hash scheme is reported if none was recorded yet.
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	if len(data) == 0 {
+		return HashScheme
+	}
+	return string(data)
+}
+
+// WriteStateScheme stores the scheme of the trie nodes in the database.
+func WriteStateScheme(db ethdb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
+
+// ReadAccountTrieNode retrieves the account trie node at the given path.
+func ReadAccountTrieNode(db ethdb.KeyValueReader, path []byte) []byte {
+	data, _ := db.Get(accountTrieNodeKey(path))
+	return data
+}
+
+// WriteAccountTrieNode writes the provided account trie node into database.
+func WriteAccountTrieNode(db ethdb.KeyValueWriter, path []byte, node []byte) {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		log.Crit("Failed to store account trie node", "err", err)
+	}
+}
+
+// DeleteAccountTrieNode deletes the account trie node at the given path.
+func DeleteAccountTrieNode(db ethdb.KeyValueWriter, path []byte) {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		log.Crit("Failed to delete account trie node", "err", err)
+	}
+}
+
+// ReadStorageTrieNode retrieves the storage trie node of an account at the
+// given path.
+func ReadStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte) []byte {
+	data, _ := db.Get(storageTrieNodeKey(accountHash, path))
+	return data
+}
+
+// WriteStorageTrieNode writes the provided storage trie node into database.
+func WriteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		log.Crit("Failed to store storage trie node", "err", err)
+	}
+}
+
+// DeleteStorageTrieNode deletes the storage trie node of an account at the
+// given path.
+func DeleteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte) {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		log.Crit("Failed to delete storage trie node", "err", err)
+	}
+}
+
+// IterateStorageTrieNodes returns an iterator for walking all the storage trie
+// nodes of an account. The path of a node is the key without the prefix of the
+// account.
+func IterateStorageTrieNodes(db ethdb.Iteratee, accountHash common.Hash) ethdb.Iterator {
+	return db.NewIterator(storageTrieNodesKey(accountHash), nil)
+}
+
+// ReadPersistentStateRoot retrieves the root of the state persisted in the path
+// scheme.
+func ReadPersistentStateRoot(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(persistentStateRootKey)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WritePersistentStateRoot stores the root of the state persisted in the path
+// scheme.
+func WritePersistentStateRoot(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Put(persistentStateRootKey, root.Bytes()); err != nil {
+		log.Crit("Failed to store persistent state root", "err", err)
+	}
+}
+
+// ReadReverseDiff retrieves the RLP encoded reverse diff of the given id.
+func ReadReverseDiff(db ethdb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(reverseDiffKey(id))
+	return data
+}
+
+// WriteReverseDiff stores the RLP encoded reverse diff of the given id.
+func WriteReverseDiff(db ethdb.KeyValueWriter, id uint64, blob []byte) {
+	if err := db.Put(reverseDiffKey(id), blob); err != nil {
+		log.Crit("Failed to store reverse diff", "err", err)
+	}
+}
+
+// DeleteReverseDiff deletes the reverse diff of the given id.
+func DeleteReverseDiff(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Delete(reverseDiffKey(id)); err != nil {
+		log.Crit("Failed to delete reverse diff", "err", err)
+	}
+}
+
+// HasReverseDiff reports whether the reverse diff of the given id is stored.
+func HasReverseDiff(db ethdb.KeyValueReader, id uint64) bool {
+	ok, _ := db.Has(reverseDiffKey(id))
+	return ok
+}
+
+// ReadReverseDiffLookup retrieves the id of the latest reverse diff rewinding
+// the persisted state to the given state root.
+func ReadReverseDiffLookup(db ethdb.KeyValueReader, root common.Hash) (uint64, bool) {
+	data, _ := db.Get(reverseDiffLookupKey(root))
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteReverseDiffLookup stores the id of the latest reverse diff rewinding the
+// persisted state to the given state root.
+func WriteReverseDiffLookup(db ethdb.KeyValueWriter, root common.Hash, id uint64) {
+	if err := db.Put(reverseDiffLookupKey(root), encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store reverse diff lookup", "err", err)
+	}
+}
+
+// DeleteReverseDiffLookup deletes the reverse diff lookup of the given state root.
+func DeleteReverseDiffLookup(db ethdb.KeyValueWriter, root common.Hash) {
+	if err := db.Delete(reverseDiffLookupKey(root)); err != nil {
+		log.Crit("Failed to delete reverse diff lookup", "err", err)
+	}
+}
+
+// ReadReverseDiffHead retrieves the id of the latest reverse diff, zero if none.
+func ReadReverseDiffHead(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(reverseDiffHeadKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteReverseDiffHead stores the id of the latest reverse diff.
+func WriteReverseDiffHead(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Put(reverseDiffHeadKey, encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store reverse diff head", "err", err)
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -30,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/olekukonko/tablewriter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 // freezerdb is a database wrapper that enabled freezer data retrievals.
@@ -95,6 +99,11 @@ func (db *nofreezedb) AncientSize(kind string) (uint64, error) {
 	return 0, errNotSupported
 }
 
+// AncientTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) AncientTail() (uint64, error) {
+	return 0, errNotSupported
+}
+
 // AppendAncient returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
 	return errNotSupported
@@ -105,6 +114,11 @@ func (db *nofreezedb) TruncateAncients(items uint64) error {
 	return errNotSupported
 }
 
+// TruncateAncientTail returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) TruncateAncientTail(tail uint64) error {
+	return errNotSupported
+}
+
 // Sync returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) Sync() error {
 	return errNotSupported
@@ -120,10 +134,10 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 
 // NewDatabaseWithFreezer creates a high level database on top of a given key-
 // value data store with a freezer moving immutable chain segments into cold
-// storage.
-func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string) (ethdb.Database, error) {
+// storage. The codecs override the compression codec of the named ancient tables.
+func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, codecs map[string]string) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace)
+	frdb, err := newFreezer(freezer, namespace, codecs)
 	if err != nil {
 		return nil, err
 	}
@@ -230,7 +244,52 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	if err != nil {
 		return nil, err
 	}
-	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace)
+	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace, nil)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
+const (
+	// DBLeveldb is the identifier of the LevelDB key-value engine.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the identifier of the Pebble key-value engine.
+	DBPebble = "pebble"
+
+	// dbEngineFile is the name of the file recording the key-value engine of a
+	// database, placed within its directory.
+	dbEngineFile = "ENGINE"
+)
+
+// OpenOptions contains the options to apply when opening a persistent database.
+type OpenOptions struct {
+	Type              string // Key-value engine, empty to use the existing one (or leveldb)
+	Directory         string // Directory of the key-value store
+	AncientsDirectory string // Directory of the freezer, empty to open without one
+	Namespace         string // Prefix of the database metrics
+	Cache             int    // Amount of memory in megabytes to allocate to caching
+	Handles           int    // Number of files handles to allocate to the open database files
+	ReadOnly          bool   // Whether to open the database in read only mode
+
+	AncientCodecs map[string]string // Compression codecs of the ancient tables by name, existing ones must match
+}
+
+// Open creates a persistent database with the configured key-value engine,
+// attaching a freezer to it if an ancients directory is set. The engine of a
+// new database is recorded in its directory, and reopening it with a different
+// one is refused.
+func Open(o OpenOptions) (ethdb.Database, error) {
+	kvdb, err := OpenKeyValueDatabase(o)
+	if err != nil {
+		return nil, err
+	}
+	if o.AncientsDirectory == "" {
+		return NewDatabase(kvdb), nil
+	}
+	frdb, err := NewDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.AncientCodecs)
 	if err != nil {
 		kvdb.Close()
 		return nil, err
@@ -238,6 +297,84 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+// OpenKeyValueDatabase opens the persistent key-value store of a database with
+// the configured engine, without any freezer attached.
+func OpenKeyValueDatabase(o OpenOptions) (ethdb.KeyValueStore, error) {
+	existing, err := ReadDatabaseEngine(o.Directory)
+	if err != nil {
+		return nil, err
+	}
+	engine := o.Type
+	if engine == "" {
+		engine = existing
+	}
+	if engine == "" {
+		engine = DBLeveldb
+	}
+	if existing != "" && engine != existing {
+		return nil, fmt.Errorf("db.engine choice was %v but found pre-existing %v database in %s", engine, existing, o.Directory)
+	}
+	var db ethdb.KeyValueStore
+	switch engine {
+	case DBLeveldb:
+		log.Info("Using leveldb as the backing database")
+		if o.ReadOnly {
+			db, err = leveldb.NewCustom(o.Directory, o.Namespace, func(options *opt.Options) {
+				options.ReadOnly = true
+			})
+		} else {
+			db, err = leveldb.New(o.Directory, o.Cache, o.Handles, o.Namespace)
+		}
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		db, err = newPebbleKeyValueStore(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown db.engine %q", engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Record the engine of databases created before it was tracked too
+	if !o.ReadOnly && !common.FileExist(filepath.Join(o.Directory, dbEngineFile)) {
+		if err := ioutil.WriteFile(filepath.Join(o.Directory, dbEngineFile), []byte(engine), 0644); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// ReadDatabaseEngine returns the key-value engine of the database in the given
+// directory, or the empty string if there's no database yet. The engine of
+// databases predating its recording is deduced from their files.
+func ReadDatabaseEngine(dir string) (string, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, dbEngineFile))
+	if err == nil {
+		return strings.TrimSpace(string(blob)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	if !common.FileExist(filepath.Join(dir, "CURRENT")) {
+		return "", nil
+	}
+	// Both engines keep a CURRENT file, but only pebble has OPTIONS files
+	if matches, err := filepath.Glob(filepath.Join(dir, "OPTIONS*")); len(matches) > 0 || err != nil {
+		return DBPebble, err
+	}
+	return DBLeveldb, nil
+}
+
+// NewPebbleDBDatabase creates a persistent key-value database backed by pebble
+// without a freezer moving immutable chain segments into cold storage.
+func NewPebbleDBDatabase(file string, cache int, handles int, namespace string, readonly bool) (ethdb.Database, error) {
+	db, err := newPebbleKeyValueStore(file, cache, handles, namespace, readonly)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(db), nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -287,6 +424,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		numHashPairings stat
 		hashNumPairings stat
 		tries           stat
+		pathTries       stat
+		reverseDiffs    stat
 		codes           stat
 		txLookups       stat
 		accountSnaps    stat
@@ -334,8 +473,14 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			numHashPairings.Add(size)
 		case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
 			hashNumPairings.Add(size)
+		case IsTrieNodePathKey(key):
+			pathTries.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
+		case bytes.HasPrefix(key, reverseDiffPrefix) && len(key) == len(reverseDiffPrefix)+8:
+			reverseDiffs.Add(size)
+		case bytes.HasPrefix(key, reverseDiffLookupPrefix) && len(key) == len(reverseDiffLookupPrefix)+common.HashLength:
+			reverseDiffs.Add(size)
 		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
@@ -368,7 +513,7 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotRootKey, snapshotJournalKey, snapshotGeneratorKey,
 				snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey, uncleanShutdownKey,
-				badBlockKey,
+				badBlockKey, stateSchemeKey, persistentStateRootKey, reverseDiffHeadKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
@@ -411,6 +556,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Bloombit index", bloomBits.Size(), bloomBits.Count()},
 		{"Key-Value store", "Contract codes", codes.Size(), codes.Count()},
 		{"Key-Value store", "Trie nodes", tries.Size(), tries.Count()},
+		{"Key-Value store", "Path trie nodes", pathTries.Size(), pathTries.Count()},
+		{"Key-Value store", "Reverse diffs", reverseDiffs.Size(), reverseDiffs.Count()},
 		{"Key-Value store", "Trie preimages", preimages.Size(), preimages.Count()},
 		{"Key-Value store", "Account snapshot", accountSnaps.Size(), accountSnaps.Count()},
 		{"Key-Value store", "Storage snapshot", storageSnaps.Size(), storageSnaps.Count()},
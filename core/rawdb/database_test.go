@@ -0,0 +1,106 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/ethdb/leveldb"
+)
+
+// Tests that the key-value engine of a database is persisted, and that opening
+// it with another engine is refused.
+func TestDatabaseEngine(t *testing.T) {
+	engines := []string{DBLeveldb}
+	if PebbleEnabled {
+		engines = append(engines, DBPebble)
+	}
+	for _, engine := range engines {
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		db, err := Open(OpenOptions{Type: engine, Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("%s: failed to write: %v", engine, err)
+		}
+		db.Close()
+
+		if have, err := ReadDatabaseEngine(dir); have != engine || err != nil {
+			t.Fatalf("%s: persisted engine mismatch: have %q, err %v", engine, have, err)
+		}
+		// Reopening without an explicit engine should pick the persisted one
+		db, err = Open(OpenOptions{Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if val, err := db.Get([]byte("key")); string(val) != "value" || err != nil {
+			t.Fatalf("%s: value mismatch after reopen: have %q, err %v", engine, val, err)
+		}
+		db.Close()
+
+		// Reopening with another engine should fail
+		for _, other := range []string{DBLeveldb, DBPebble} {
+			if other == engine {
+				continue
+			}
+			if _, err := Open(OpenOptions{Type: other, Directory: dir}); err == nil {
+				t.Fatalf("%s: database opened with %s engine", engine, other)
+			}
+		}
+	}
+}
+
+// Tests that databases created before the engine was persisted are detected
+// as leveldb ones.
+func TestDatabaseEngineLegacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := leveldb.New(dir, 0, 0, "")
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if have, err := ReadDatabaseEngine(dir); have != DBLeveldb || err != nil {
+		t.Fatalf("legacy engine mismatch: have %q, err %v", have, err)
+	}
+	if _, err := Open(OpenOptions{Type: DBPebble, Directory: dir}); err == nil {
+		t.Fatalf("legacy leveldb database opened with pebble engine")
+	}
+	db2, err := Open(OpenOptions{Directory: dir})
+	if err != nil {
+		t.Fatalf("failed to open legacy database: %v", err)
+	}
+	db2.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, dbEngineFile)); err != nil {
+		t.Fatalf("engine of legacy database not persisted: %v", err)
+	}
+}
@@ -67,11 +67,12 @@ const (
 //   reserving it for go-ethereum. This would also reduce the memory requirements
 //   of Geth, and thus also GC overhead.
 type freezer struct {
-	// WARNING: The `frozen` field is accessed atomically. On 32 bit platforms, only
-	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
+	// WARNING: The `frozen` and `tail` fields are accessed atomically. On 32 bit platforms,
+	// only 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
 	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
 	frozen    uint64 // Number of blocks already frozen
 	threshold uint64 // Number of recent blocks not to freeze (params.FullImmutabilityThreshold apart from tests)
+	tail      uint64 // Number of blocks whose prunable data was deleted from the tail
 
 	tables       map[string]*freezerTable // Data tables for storing everything
 	instanceLock fileutil.Releaser        // File-system lock to prevent double opens
@@ -83,14 +84,27 @@ type freezer struct {
 }
 
 // newFreezer creates a chain freezer that moves ancient chain data into
-// append-only flat file containers.
-func newFreezer(datadir string, namespace string) (*freezer, error) {
+// append-only flat file containers. The codecs override the default compression
+// codec of the named tables, existing tables compressed differently are refused.
+func newFreezer(datadir string, namespace string, codecs map[string]string) (*freezer, error) {
 	// Create the initial freezer object
 	var (
 		readMeter  = metrics.NewRegisteredMeter(namespace+"ancient/read", nil)
 		writeMeter = metrics.NewRegisteredMeter(namespace+"ancient/write", nil)
 		sizeGauge  = metrics.NewRegisteredGauge(namespace+"ancient/size", nil)
 	)
+	// Resolve the configured codecs before touching anything on disk
+	configured := make(map[string]freezerCodec)
+	for name, codec := range codecs {
+		if _, ok := freezerCodecs[name]; !ok {
+			return nil, fmt.Errorf("unknown ancient table %q", name)
+		}
+		parsed, err := parseFreezerCodec(codec)
+		if err != nil {
+			return nil, err
+		}
+		configured[name] = parsed
+	}
 	// Ensure the datadir is not a symbolic link if it exists.
 	if info, err := os.Lstat(datadir); !os.IsNotExist(err) {
 		if info.Mode()&os.ModeSymlink != 0 {
@@ -112,8 +126,16 @@ func newFreezer(datadir string, namespace string) (*freezer, error) {
 		trigger:      make(chan chan struct{}),
 		quit:         make(chan struct{}),
 	}
-	for name, disableSnappy := range freezerNoSnappy {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy)
+	for name, codec := range freezerCodecs {
+		want, ok := configured[name]
+		if ok {
+			codec = want
+		}
+		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, codec)
+		if err == nil && ok && table.codec != want {
+			table.Close()
+			err = fmt.Errorf("ancient table %s compressed with %v instead of %v, migrate it with 'geth db freezer-migrate'", name, table.codec, want)
+		}
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
@@ -245,6 +267,31 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// AncientTail returns the number of the first block whose prunable data (body
+// and receipts) is still available in the freezer.
+func (f *freezer) AncientTail() (uint64, error) {
+	return atomic.LoadUint64(&f.tail), nil
+}
+
+// TruncateAncientTail discards the prunable data of all blocks below the given
+// number. The data is hidden right away, but only deleted from disk in whole
+// data files.
+func (f *freezer) TruncateAncientTail(tail uint64) error {
+	if frozen := atomic.LoadUint64(&f.frozen); tail > frozen {
+		return fmt.Errorf("truncating tail above the frozen blocks: %d > %d", tail, frozen)
+	}
+	if atomic.LoadUint64(&f.tail) >= tail {
+		return nil
+	}
+	for _, name := range freezerPrunableTables {
+		if err := f.tables[name].truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.tail, tail)
+	return nil
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
@@ -468,5 +515,20 @@ func (f *freezer) repair() error {
 		}
 	}
 	atomic.StoreUint64(&f.frozen, min)
+
+	// Bring the tails of the prunable tables in sync after an interrupted tail
+	// truncation, the items already hidden in any table are lost for good
+	var tail uint64
+	for _, name := range freezerPrunableTables {
+		if hidden := atomic.LoadUint64(&f.tables[name].itemHidden); tail < hidden {
+			tail = hidden
+		}
+	}
+	for _, name := range freezerPrunableTables {
+		if err := f.tables[name].truncateTail(tail); err != nil {
+			return err
+		}
+	}
+	atomic.StoreUint64(&f.tail, tail)
 	return nil
 }
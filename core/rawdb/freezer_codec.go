@@ -0,0 +1,245 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/tsdb/fileutil"
+)
+
+// freezerCodec is the compression algorithm applied to the items of a freezer
+// table. The codec of a table is recorded in its metadata, so it can be read
+// back regardless of the codec configured for new tables.
+type freezerCodec uint8
+
+const (
+	freezerCodecNone   freezerCodec = iota // Items are stored uncompressed
+	freezerCodecSnappy                     // Items are compressed with snappy
+	freezerCodecZstd                       // Items are compressed with zstd
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// initZstd creates the shared zstd encoder and decoder on first use. Both are
+// safe for concurrent use through EncodeAll and DecodeAll.
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+}
+
+// parseFreezerCodec converts the name of a codec into its identifier.
+func parseFreezerCodec(name string) (freezerCodec, error) {
+	for _, codec := range []freezerCodec{freezerCodecNone, freezerCodecSnappy, freezerCodecZstd} {
+		if codec.String() == name {
+			return codec, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown freezer codec %q", name)
+}
+
+// String implements fmt.Stringer.
+func (c freezerCodec) String() string {
+	switch c {
+	case freezerCodecNone:
+		return "none"
+	case freezerCodecSnappy:
+		return "snappy"
+	case freezerCodecZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// tag returns the letter marking the index and data files of a table compressed
+// with the codec. The tags of uncompressed and snappy tables are retained from
+// the time the compression could only be switched on or off.
+func (c freezerCodec) tag() string {
+	switch c {
+	case freezerCodecNone:
+		return "r"
+	case freezerCodecSnappy:
+		return "c"
+	default:
+		return "z"
+	}
+}
+
+// indexName returns the name of the index file of the given table.
+func (c freezerCodec) indexName(table string) string {
+	return fmt.Sprintf("%s.%sidx", table, c.tag())
+}
+
+// dataName returns the name of the numbered data file of the given table.
+func (c freezerCodec) dataName(table string, num uint32) string {
+	return fmt.Sprintf("%s.%04d.%sdat", table, num, c.tag())
+}
+
+// encode compresses a blob for storing it in a data file.
+func (c freezerCodec) encode(blob []byte) []byte {
+	switch c {
+	case freezerCodecSnappy:
+		return snappy.Encode(nil, blob)
+	case freezerCodecZstd:
+		initZstd()
+		return zstdEncoder.EncodeAll(blob, nil)
+	default:
+		return blob
+	}
+}
+
+// decode decompresses a blob read from a data file.
+func (c freezerCodec) decode(blob []byte) ([]byte, error) {
+	switch c {
+	case freezerCodecSnappy:
+		return snappy.Decode(nil, blob)
+	case freezerCodecZstd:
+		initZstd()
+		return zstdDecoder.DecodeAll(blob, nil)
+	default:
+		return blob, nil
+	}
+}
+
+// MigrateFreezerTable recompresses all the items of an ancient table with the
+// given codec. The table is rebuilt in a temporary directory and swapped in by
+// recording the new codec in its metadata, so an interrupted migration leaves
+// the original table intact. The freezer must not be opened concurrently.
+func MigrateFreezerTable(datadir string, name string, codecName string) error {
+	codec, err := parseFreezerCodec(codecName)
+	if err != nil {
+		return err
+	}
+	config, ok := freezerCodecs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnknownTable, name)
+	}
+	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	src, err := newTable(datadir, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, config)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if src.codec == codec {
+		log.Info("Freezer table already migrated", "table", name, "codec", codec)
+		return nil
+	}
+	// Create the new table in a temporary directory, skipping over the items
+	// hidden from the tail of the original one
+	var (
+		hidden = atomic.LoadUint64(&src.itemHidden)
+		items  = atomic.LoadUint64(&src.items)
+		tmpdir = filepath.Join(datadir, "migrate")
+	)
+	if err := os.RemoveAll(tmpdir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpdir, 0755); err != nil {
+		return err
+	}
+	head := indexEntry{offset: uint32(hidden)}
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, codec.indexName(name)), head.marshallBinary(), 0644); err != nil {
+		return err
+	}
+	if err := writeFreezerTableMeta(filepath.Join(tmpdir, fmt.Sprintf("%s.meta", name)), &freezerTableMeta{Version: freezerTableMetaVersion, Tail: hidden, Codec: codec}); err != nil {
+		return err
+	}
+	dst, err := newCustomTable(tmpdir, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, src.maxFileSize, codec)
+	if err != nil {
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for item := hidden; item < items; item++ {
+		blob, err := src.Retrieve(item)
+		if err != nil {
+			dst.Close()
+			return err
+		}
+		if err := dst.Append(item, blob); err != nil {
+			dst.Close()
+			return err
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Migrating freezer table", "table", name, "item", item, "items", items, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	var (
+		oldFiles = []string{src.index.Name()}
+		newFiles = []string{codec.indexName(name)}
+	)
+	for num := src.tailId; num <= src.headId; num++ {
+		oldFiles = append(oldFiles, src.fileName(num))
+	}
+	for num := dst.tailId; num <= dst.headId; num++ {
+		newFiles = append(newFiles, codec.dataName(name, num))
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := src.Close(); err != nil {
+		return err
+	}
+	// Move the new files next to the original ones. They are only used after the
+	// codec is switched in the metadata, after which the old files are dropped.
+	for _, file := range newFiles {
+		if err := os.Rename(filepath.Join(tmpdir, file), filepath.Join(datadir, file)); err != nil {
+			return err
+		}
+	}
+	if err := writeFreezerTableMeta(src.meta, &freezerTableMeta{Version: freezerTableMetaVersion, Tail: hidden, Codec: codec}); err != nil {
+		return err
+	}
+	for _, file := range oldFiles {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	log.Info("Migrated freezer table", "table", name, "from", src.codec, "to", codec, "items", items-hidden, "elapsed", common.PrettyDuration(time.Since(start)))
+	return os.RemoveAll(tmpdir)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// freezerTableMetaVersion is the current version of the freezer table metadata.
+const freezerTableMetaVersion = 1
+
+// freezerTableMeta is the metadata of a freezer table, stored next to its index
+// file. It tracks the items hidden from the tail of the table, which can't be
+// derived from the index alone as the data files are only deleted in bulk, and
+// the codec the items of the table are compressed with.
+type freezerTableMeta struct {
+	Version uint16       // Version of the metadata format
+	Tail    uint64       // Number of items hidden from the tail of the table
+	Codec   freezerCodec // Compression codec of the table items
+}
+
+// readFreezerTableMeta loads the metadata of a freezer table from the given file.
+// A missing file is treated as a table without any hidden items. The returned
+// flag reports whether the metadata exists, which is not the case for tables
+// created before it was introduced, so their codec is not recorded either.
+func readFreezerTableMeta(path string) (*freezerTableMeta, bool, error) {
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &freezerTableMeta{Version: freezerTableMetaVersion}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var meta freezerTableMeta
+	if err := rlp.DecodeBytes(blob, &meta); err != nil {
+		return nil, false, err
+	}
+	if meta.Version != freezerTableMetaVersion {
+		return nil, false, fmt.Errorf("unsupported freezer metadata version %d", meta.Version)
+	}
+	return &meta, true, nil
+}
+
+// writeFreezerTableMeta atomically replaces the metadata of a freezer table by
+// writing it into a temporary file first and renaming it afterwards.
+func writeFreezerTableMeta(path string, meta *freezerTableMeta) error {
+	blob, err := rlp.EncodeToBytes(meta)
+	if err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	f, err := openFreezerFileTruncated(temp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
@@ -23,13 +23,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"sync/atomic"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
-	"github.com/golang/snappy"
 )
 
 var (
@@ -55,6 +55,9 @@ type indexEntry struct {
 
 const indexEntrySize = 6
 
+// freezerTableSize is the maximum size of the data files of a freezer table.
+const freezerTableSize = 2 * 1000 * 1000 * 1000
+
 // unmarshallBinary deserializes binary b into the rawIndex entry.
 func (i *indexEntry) unmarshalBinary(b []byte) error {
 	i.filenum = uint32(binary.BigEndian.Uint16(b[:2]))
@@ -71,18 +74,19 @@ func (i *indexEntry) marshallBinary() []byte {
 }
 
 // freezerTable represents a single chained data table within the freezer (e.g. blocks).
-// It consists of a data file (snappy encoded arbitrary data blobs) and an indexEntry
-// file (uncompressed 64 bit indices into the data file).
+// It consists of a data file (arbitrary data blobs, optionally compressed) and an
+// indexEntry file (uncompressed 64 bit indices into the data file).
 type freezerTable struct {
-	// WARNING: The `items` field is accessed atomically. On 32 bit platforms, only
-	// 64-bit aligned fields can be atomic. The struct is guaranteed to be so aligned,
-	// so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
-	items uint64 // Number of items stored in the table (including items removed from tail)
+	// WARNING: The `items` and `itemHidden` fields are accessed atomically. On 32 bit
+	// platforms, only 64-bit aligned fields can be atomic. The struct is guaranteed to
+	// be so aligned, so take advantage of that (https://golang.org/pkg/sync/atomic/#pkg-note-BUG).
+	items      uint64 // Number of items stored in the table (including items removed from tail)
+	itemHidden uint64 // Number of items hidden from the tail, they may still be on disk
 
-	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
-	maxFileSize   uint32 // Max file size for data-files
-	name          string
-	path          string
+	codec       freezerCodec // Compression codec of the items, recorded in the metadata
+	maxFileSize uint32       // Max file size for data-files
+	name        string
+	path        string
 
 	head   *os.File            // File descriptor for the data head of the table
 	files  map[uint32]*os.File // open files
@@ -93,6 +97,7 @@ type freezerTable struct {
 	// In the case that old items are deleted (from the tail), we use itemOffset
 	// to count how many historic items have gone missing.
 	itemOffset uint32 // Offset (number of discarded items)
+	meta       string // Path of the metadata file tracking the hidden tail items
 
 	headBytes  uint32        // Number of bytes written to the head file
 	readMeter  metrics.Meter // Meter for measuring the effective amount of data read
@@ -103,14 +108,19 @@ type freezerTable struct {
 	lock   sync.RWMutex // Mutex protecting the data file descriptors
 }
 
-// NewFreezerTable opens the given path as a freezer table.
+// NewFreezerTable opens the given path as a freezer table. The compression flag
+// only applies to newly created tables, existing ones retain their codec.
 func NewFreezerTable(path, name string, disableSnappy bool) (*freezerTable, error) {
-	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, disableSnappy)
+	codec := freezerCodecSnappy
+	if disableSnappy {
+		codec = freezerCodecNone
+	}
+	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, codec)
 }
 
 // newTable opens a freezer table with default settings - 2G files
-func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, disableSnappy bool) (*freezerTable, error) {
-	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, disableSnappy)
+func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, codec freezerCodec) (*freezerTable, error) {
+	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, freezerTableSize, codec)
 }
 
 // openFreezerFileForAppend opens a freezer table file and seeks to the end
@@ -153,41 +163,53 @@ func truncateFreezerFile(file *os.File, size int64) error {
 
 // newCustomTable opens a freezer table, creating the data and index files if they are
 // non existent. Both files are truncated to the shortest common length to ensure
-// they don't go out of sync.
-func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
-	// Ensure the containing directory exists and open the indexEntry file
+// they don't go out of sync. The codec is only used if the table doesn't exist
+// yet, existing tables are read with the codec recorded in their metadata.
+func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, codec freezerCodec) (*freezerTable, error) {
+	// Ensure the containing directory exists and determine the codec of the table
 	if err := os.MkdirAll(path, 0755); err != nil {
 		return nil, err
 	}
-	var idxName string
-	if noCompression {
-		// Raw idx
-		idxName = fmt.Sprintf("%s.ridx", name)
+	metaPath := filepath.Join(path, fmt.Sprintf("%s.meta", name))
+	meta, known, err := readFreezerTableMeta(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	if known {
+		codec = meta.Codec
 	} else {
-		// Compressed idx
-		idxName = fmt.Sprintf("%s.cidx", name)
+		codec = detectFreezerCodec(path, name, codec)
 	}
-	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
+	offsets, err := openFreezerFileForAppend(filepath.Join(path, codec.indexName(name)))
 	if err != nil {
 		return nil, err
 	}
 	// Create the table and repair any past inconsistency
 	tab := &freezerTable{
-		index:         offsets,
-		files:         make(map[uint32]*os.File),
-		readMeter:     readMeter,
-		writeMeter:    writeMeter,
-		sizeGauge:     sizeGauge,
-		name:          name,
-		path:          path,
-		logger:        log.New("database", path, "table", name),
-		noCompression: noCompression,
-		maxFileSize:   maxFilesize,
+		index:       offsets,
+		files:       make(map[uint32]*os.File),
+		readMeter:   readMeter,
+		writeMeter:  writeMeter,
+		sizeGauge:   sizeGauge,
+		name:        name,
+		path:        path,
+		meta:        metaPath,
+		logger:      log.New("database", path, "table", name),
+		codec:       codec,
+		maxFileSize: maxFilesize,
 	}
 	if err := tab.repair(); err != nil {
 		tab.Close()
 		return nil, err
 	}
+	// Record the codec of new and legacy tables, so that it's not affected by any
+	// configuration change afterwards
+	if !known {
+		if err := tab.writeMeta(atomic.LoadUint64(&tab.itemHidden)); err != nil {
+			tab.Close()
+			return nil, err
+		}
+	}
 	// Initialize the starting size counter
 	size, err := tab.sizeNolock()
 	if err != nil {
@@ -199,6 +221,28 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 	return tab, nil
 }
 
+// detectFreezerCodec determines the codec of a table created before the codec
+// was recorded in the metadata. Such tables are either uncompressed or snappy
+// compressed, which is told apart by the name of the index file. If the index
+// file is missing, the table is new and uses the configured codec.
+func detectFreezerCodec(path string, name string, codec freezerCodec) freezerCodec {
+	if common.FileExist(filepath.Join(path, codec.indexName(name))) {
+		return codec
+	}
+	for _, legacy := range []freezerCodec{freezerCodecNone, freezerCodecSnappy} {
+		if common.FileExist(filepath.Join(path, legacy.indexName(name))) {
+			return legacy
+		}
+	}
+	return codec
+}
+
+// writeMeta persists the metadata of the table with the given number of hidden
+// tail items.
+func (t *freezerTable) writeMeta(tail uint64) error {
+	return writeFreezerTableMeta(t.meta, &freezerTableMeta{Version: freezerTableMetaVersion, Tail: tail, Codec: t.codec})
+}
+
 // repair cross checks the head and the index file and truncates them to
 // be in sync with each other after a potential crash / data loss.
 func (t *freezerTable) repair() error {
@@ -242,6 +286,9 @@ func (t *freezerTable) repair() error {
 
 	t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 	lastIndex.unmarshalBinary(buffer)
+	if offsetsSize == indexEntrySize {
+		lastIndex.offset = 0 // The first entry holds the item offset, not a data offset
+	}
 	t.head, err = t.openFile(lastIndex.filenum, openFreezerFileForAppend)
 	if err != nil {
 		return err
@@ -273,6 +320,9 @@ func (t *freezerTable) repair() error {
 			t.index.ReadAt(buffer, offsetsSize-indexEntrySize)
 			var newLastIndex indexEntry
 			newLastIndex.unmarshalBinary(buffer)
+			if offsetsSize == indexEntrySize {
+				newLastIndex.offset = 0
+			}
 			// We might have slipped back into an earlier head-file here
 			if newLastIndex.filenum != lastIndex.filenum {
 				// Release earlier opened file
@@ -303,6 +353,30 @@ func (t *freezerTable) repair() error {
 	t.headBytes = uint32(contentSize)
 	t.headId = lastIndex.filenum
 
+	// Load the hidden tail items. The index may have been rewritten without the
+	// metadata catching up, so the discarded items are always hidden too.
+	meta, _, err := readFreezerTableMeta(t.meta)
+	if err != nil {
+		return err
+	}
+	t.itemHidden = meta.Tail
+	if t.itemHidden < uint64(t.itemOffset) {
+		t.itemHidden = uint64(t.itemOffset)
+	}
+	if t.itemHidden > t.items {
+		t.itemHidden = t.items
+	}
+	// Delete any data files left behind by an interrupted tail truncation
+	for num := t.tailId; num > 0; num-- {
+		name := t.fileName(num - 1)
+		if _, err := os.Stat(name); err != nil {
+			break
+		}
+		t.logger.Warn("Removing dangling tail file", "file", name)
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
 	// Close opened files and preopen all files
 	if err := t.preopen(); err != nil {
 		return err
@@ -350,16 +424,34 @@ func (t *freezerTable) truncate(items uint64) error {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+
+	// The data of items deleted from the tail is gone for good, refuse to go
+	// below them as it would leave the table without a valid index
+	if items < uint64(t.itemOffset) {
+		return fmt.Errorf("truncating below the table tail: %d < %d", items, t.itemOffset)
+	}
+	// Items below the truncation point can't be hidden any more than removed
+	if atomic.LoadUint64(&t.itemHidden) > items {
+		if err := t.writeMeta(items); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&t.itemHidden, items)
+	}
+	// The index is relative to the first item that was not deleted from the tail
+	position := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(position+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
 	expected.unmarshalBinary(buffer)
+	if position == 0 {
+		expected.offset = 0 // The first entry holds the item offset, not a data offset
+	}
 
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
@@ -393,6 +485,137 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards any data below the provided threshold number. The items
+// are hidden right away, but their data is only deleted once whole data files
+// consist of hidden items.
+func (t *freezerTable) truncateTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if atomic.LoadUint64(&t.items) < items {
+		return fmt.Errorf("truncating tail above the table head: %d > %d", items, atomic.LoadUint64(&t.items))
+	}
+	// Hide the items first and persist the marker, so they stay inaccessible
+	// even if the deletion below fails or gets interrupted
+	if atomic.LoadUint64(&t.itemHidden) < items {
+		if err := t.writeMeta(items); err != nil {
+			return err
+		}
+		atomic.StoreUint64(&t.itemHidden, items)
+	}
+	items = atomic.LoadUint64(&t.itemHidden)
+
+	// Find the data file containing the first retained item, all the ones before
+	// it only contain hidden items and can be deleted
+	var (
+		count   = atomic.LoadUint64(&t.items) - uint64(t.itemOffset)
+		newTail = t.headId
+		entry   indexEntry
+	)
+	if items < atomic.LoadUint64(&t.items) {
+		var err error
+		if entry, err = t.readIndex(items - uint64(t.itemOffset) + 1); err != nil {
+			return err
+		}
+		newTail = entry.filenum
+	}
+	if newTail == t.tailId {
+		return nil
+	}
+	// Find the first item stored in the new tail file, which becomes the new
+	// item offset of the table
+	var err error
+	first := uint64(sort.Search(int(count), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var entry indexEntry
+		entry, err = t.readIndex(uint64(i) + 1)
+		return entry.filenum >= newTail
+	}))
+	if err != nil {
+		return err
+	}
+	// We need to truncate, save the old size for metrics tracking
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Debug("Truncating freezer table tail", "hidden", items, "files", newTail-t.tailId)
+
+	// Rewrite the index without the entries of the deleted files. The first entry
+	// carries the new tail file and the number of deleted items.
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	var (
+		name = t.index.Name()
+		temp = name + ".tmp"
+		head = indexEntry{filenum: newTail, offset: t.itemOffset + uint32(first)}
+	)
+	index, err := openFreezerFileTruncated(temp)
+	if err != nil {
+		return err
+	}
+	if _, err := index.Write(head.marshallBinary()); err != nil {
+		index.Close()
+		return err
+	}
+	offset := int64(first+1) * indexEntrySize
+	if _, err := io.Copy(index, io.NewSectionReader(t.index, offset, stat.Size()-offset)); err != nil {
+		index.Close()
+		return err
+	}
+	if err := index.Sync(); err != nil {
+		index.Close()
+		return err
+	}
+	index.Close()
+
+	if err := t.index.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, name); err != nil {
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(name); err != nil {
+		return err
+	}
+	// Delete the data files that only contain hidden items
+	for num := t.tailId; num < newTail; num++ {
+		t.releaseFile(num)
+		if err := os.Remove(t.fileName(num)); err != nil {
+			return err
+		}
+	}
+	t.tailId = newTail
+	t.itemOffset = head.offset
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+
+	return nil
+}
+
+// readIndex reads the index entry at the given position, counted from the first
+// entry of the index file.
+func (t *freezerTable) readIndex(position uint64) (indexEntry, error) {
+	var (
+		buffer = make([]byte, indexEntrySize)
+		entry  indexEntry
+	)
+	if _, err := t.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
+		return entry, err
+	}
+	entry.unmarshalBinary(buffer)
+	return entry, nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -421,13 +644,7 @@ func (t *freezerTable) Close() error {
 func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error)) (f *os.File, err error) {
 	var exist bool
 	if f, exist = t.files[num]; !exist {
-		var name string
-		if t.noCompression {
-			name = fmt.Sprintf("%s.%04d.rdat", t.name, num)
-		} else {
-			name = fmt.Sprintf("%s.%04d.cdat", t.name, num)
-		}
-		f, err = opener(filepath.Join(t.path, name))
+		f, err = opener(t.fileName(num))
 		if err != nil {
 			return nil, err
 		}
@@ -436,6 +653,11 @@ func (t *freezerTable) openFile(num uint32, opener func(string) (*os.File, error
 	return f, err
 }
 
+// fileName returns the path of the data file with the given number.
+func (t *freezerTable) fileName(num uint32) string {
+	return filepath.Join(t.path, t.codec.dataName(t.name, num))
+}
+
 // releaseFile closes a file, and removes it from the open file cache.
 // Assumes that the caller holds the write lock
 func (t *freezerTable) releaseFile(num uint32) {
@@ -478,9 +700,7 @@ func (t *freezerTable) Append(item uint64, blob []byte) error {
 		return fmt.Errorf("appending unexpected item: want %d, have %d", t.items, item)
 	}
 	// Encode the blob and write it into the data file
-	if !t.noCompression {
-		blob = snappy.Encode(nil, blob)
-	}
+	blob = t.codec.encode(blob)
 	bLen := uint32(len(blob))
 	if t.headBytes+bLen < bLen ||
 		t.headBytes+bLen > t.maxFileSize {
@@ -572,8 +792,8 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 		t.lock.RUnlock()
 		return nil, errOutOfBounds
 	}
-	// Ensure the item was not deleted from the tail either
-	if uint64(t.itemOffset) > item {
+	// Ensure the item was not deleted or hidden from the tail either
+	if atomic.LoadUint64(&t.itemHidden) > item {
 		t.lock.RUnlock()
 		return nil, errOutOfBounds
 	}
@@ -596,16 +816,13 @@ func (t *freezerTable) Retrieve(item uint64) ([]byte, error) {
 	t.lock.RUnlock()
 	t.readMeter.Mark(int64(len(blob) + 2*indexEntrySize))
 
-	if t.noCompression {
-		return blob, nil
-	}
-	return snappy.Decode(nil, blob)
+	return t.codec.decode(blob)
 }
 
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && atomic.LoadUint64(&t.itemHidden) <= number
 }
 
 // size returns the total data size in the freezer table.
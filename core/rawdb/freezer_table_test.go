@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -48,7 +49,7 @@ func TestFreezerBasics(t *testing.T) {
 	// set cutoff at 50 bytes
 	f, err := newCustomTable(os.TempDir(),
 		fmt.Sprintf("unittest-%d", rand.Uint64()),
-		metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+		metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, freezerCodecNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -95,7 +96,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 		f          *freezerTable
 		err        error
 	)
-	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -104,7 +105,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 		data := getChunk(15, x)
 		f.Append(uint64(x), data)
 		f.Close()
-		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -121,7 +122,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 			t.Fatalf("test %d, got \n%x != \n%x", y, got, exp)
 		}
 		f.Close()
-		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -135,7 +136,7 @@ func TestFreezerRepairDanglingHead(t *testing.T) {
 	fname := fmt.Sprintf("dangling_headtest-%d", rand.Uint64())
 
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -164,7 +165,7 @@ func TestFreezerRepairDanglingHead(t *testing.T) {
 	idxFile.Close()
 	// Now open it again
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -186,7 +187,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	fname := fmt.Sprintf("dangling_headtest-%d", rand.Uint64())
 
 	{ // Fill a table and close it
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -212,7 +213,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	idxFile.Close()
 	// Now open it again
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -233,7 +234,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	}
 	// And if we open it, we should now be able to read all of them (new values)
 	{
-		f, _ := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, _ := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		for y := 1; y < 255; y++ {
 			exp := getChunk(15, ^y)
 			got, err := f.Retrieve(uint64(y))
@@ -247,50 +248,147 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	}
 }
 
-// TestSnappyDetection tests that we fail to open a snappy database and vice versa
-func TestSnappyDetection(t *testing.T) {
+// TestCodecDetection tests that tables are read with the codec they were created
+// with, regardless of the codec configured when reopening them.
+func TestCodecDetection(t *testing.T) {
 	t.Parallel()
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
-	fname := fmt.Sprintf("snappytest-%d", rand.Uint64())
-	// Open with snappy
-	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
-		if err != nil {
-			t.Fatal(err)
+	for _, codec := range []freezerCodec{freezerCodecNone, freezerCodecSnappy, freezerCodecZstd} {
+		fname := fmt.Sprintf("codectest-%s-%d", codec, rand.Uint64())
+		// Open with the tested codec
+		{
+			f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, codec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Write 15 bytes 255 times
+			for x := 0; x < 0xff; x++ {
+				data := getChunk(15, x)
+				f.Append(uint64(x), data)
+			}
+			f.Close()
 		}
-		// Write 15 bytes 255 times
-		for x := 0; x < 0xff; x++ {
-			data := getChunk(15, x)
-			f.Append(uint64(x), data)
+		// Reopen with all other codecs, the items should be readable
+		for _, other := range []freezerCodec{freezerCodecNone, freezerCodecSnappy, freezerCodecZstd} {
+			f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.codec != codec {
+				f.Close()
+				t.Fatalf("codec mismatch: have %v, want %v", f.codec, codec)
+			}
+			for x := 0; x < 0xff; x++ {
+				if blob, err := f.Retrieve(uint64(x)); err != nil {
+					f.Close()
+					t.Fatalf("codec %v: failed to retrieve item %d: %v", codec, x, err)
+				} else if !bytes.Equal(blob, getChunk(15, x)) {
+					f.Close()
+					t.Fatalf("codec %v: item %d mismatch: have %x", codec, x, blob)
+				}
+			}
+			f.Close()
 		}
-		f.Close()
 	}
-	// Open without snappy
+}
+
+// TestLegacyCodecDetection tests that tables predating the codec metadata are
+// detected from the name of their index file.
+func TestLegacyCodecDetection(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("legacytest-%d", rand.Uint64())
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, false)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
-		if _, err = f.Retrieve(0); err == nil {
-			f.Close()
-			t.Fatalf("expected empty table")
+		for x := 0; x < 0xff; x++ {
+			f.Append(uint64(x), getChunk(15, x))
 		}
+		f.Close()
+	}
+	// Drop the recorded codec, simulating a table created by an older release
+	if err := os.Remove(filepath.Join(os.TempDir(), fmt.Sprintf("%s.meta", fname))); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.codec != freezerCodecNone {
+		t.Fatalf("codec mismatch: have %v, want %v", f.codec, freezerCodecNone)
+	}
+	if _, err = f.Retrieve(0xfe); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	// The detected codec should have been recorded
+	if meta, known, err := readFreezerTableMeta(f.meta); err != nil || !known || meta.Codec != freezerCodecNone {
+		t.Fatalf("codec not recorded: meta %v, known %v, err %v", meta, known, err)
+	}
+}
+
+// TestFreezerCodecConfig tests that the configured codecs apply to new tables,
+// and that existing tables compressed with a different codec are refused.
+func TestFreezerCodecConfig(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(dir)
 
-	// Open with snappy
-	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	// closeFreezer releases a freezer without its freezing loop running
+	closeFreezer := func(f *freezer) {
+		for _, table := range f.tables {
+			table.Close()
+		}
+		f.instanceLock.Release()
+	}
+	f, err := newFreezer(dir, "", map[string]string{freezerBodiesTable: "zstd"})
+	if err != nil {
+		t.Fatalf("failed to create freezer: %v", err)
+	}
+	if codec := f.tables[freezerBodiesTable].codec; codec != freezerCodecZstd {
+		t.Fatalf("codec mismatch: have %v, want %v", codec, freezerCodecZstd)
+	}
+	if codec := f.tables[freezerReceiptTable].codec; codec != freezerCodecs[freezerReceiptTable] {
+		t.Fatalf("default codec mismatch: have %v, want %v", codec, freezerCodecs[freezerReceiptTable])
+	}
+	closeFreezer(f)
+
+	// Reopen the freezer with matching, missing and conflicting codecs
+	for i, tt := range []struct {
+		codecs map[string]string
+		fail   bool
+	}{
+		{map[string]string{freezerBodiesTable: "zstd"}, false},
+		{nil, false},
+		{map[string]string{freezerBodiesTable: "snappy"}, true},
+		{map[string]string{freezerReceiptTable: "zstd"}, true},
+		{map[string]string{"unknown": "zstd"}, true},
+		{map[string]string{freezerBodiesTable: "unknown"}, true},
+	} {
+		f, err := newFreezer(dir, "", tt.codecs)
+		if tt.fail {
+			if err == nil {
+				closeFreezer(f)
+				t.Fatalf("test %d: conflicting codecs accepted", i)
+			}
+			continue
+		}
 		if err != nil {
-			t.Fatal(err)
+			t.Fatalf("test %d: failed to reopen freezer: %v", i, err)
 		}
-		// There should be 255 items
-		if _, err = f.Retrieve(0xfe); err != nil {
-			f.Close()
-			t.Fatalf("expected no error, got %v", err)
+		if codec := f.tables[freezerBodiesTable].codec; codec != freezerCodecZstd {
+			closeFreezer(f)
+			t.Fatalf("test %d: codec mismatch: have %v, want %v", i, codec, freezerCodecZstd)
 		}
+		closeFreezer(f)
 	}
-
 }
+
 func assertFileSize(f string, size int64) error {
 	stat, err := os.Stat(f)
 	if err != nil {
@@ -311,7 +409,7 @@ func TestFreezerRepairDanglingIndex(t *testing.T) {
 	fname := fmt.Sprintf("dangling_indextest-%d", rand.Uint64())
 
 	{ // Fill a table and close it
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -347,7 +445,7 @@ func TestFreezerRepairDanglingIndex(t *testing.T) {
 	// 45, 45, 15
 	// with 3+3+1 items
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -368,7 +466,7 @@ func TestFreezerTruncate(t *testing.T) {
 	fname := fmt.Sprintf("truncation-%d", rand.Uint64())
 
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -385,7 +483,7 @@ func TestFreezerTruncate(t *testing.T) {
 	}
 	// Reopen, truncate
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -410,7 +508,7 @@ func TestFreezerRepairFirstFile(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("truncationfirst-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -438,7 +536,7 @@ func TestFreezerRepairFirstFile(t *testing.T) {
 	}
 	// Reopen
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -466,7 +564,7 @@ func TestFreezerReadAndTruncate(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("read_truncate-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -483,7 +581,7 @@ func TestFreezerReadAndTruncate(t *testing.T) {
 	}
 	// Reopen and read all files
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -512,7 +610,7 @@ func TestOffset(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("offset-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -568,7 +666,7 @@ func TestOffset(t *testing.T) {
 	}
 	// Now open again
 	checkPresent := func(numDeleted uint64) {
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, freezerCodecNone)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -630,6 +728,144 @@ func TestOffset(t *testing.T) {
 	checkPresent(1000000)
 }
 
+// TestFreezerTruncateTail tests that items can be removed from the tail of the
+// table, hiding them first and deleting the data files they fully occupy.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-%d", rand.Uint64())
+
+	// Fill a table and make sure the items below the tail are hidden
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Write 15 bytes 30 times, results in 10 files
+	for x := 0; x < 30; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	checkRetrieve := func(f *freezerTable, tail uint64, items uint64) {
+		t.Helper()
+		for i := uint64(0); i < items; i++ {
+			got, err := f.Retrieve(i)
+			if i < tail {
+				if err == nil {
+					t.Fatalf("item %d: expected error, got %x", i, got)
+				}
+				if f.has(i) {
+					t.Fatalf("item %d: reported as present", i)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("item %d: %v", i, err)
+			}
+			if exp := getChunk(15, int(i)); !bytes.Equal(got, exp) {
+				t.Fatalf("item %d: have %x, want %x", i, got, exp)
+			}
+		}
+	}
+	checkFiles := func(deleted int) {
+		t.Helper()
+		for i := 0; i < 10; i++ {
+			_, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.%04d.rdat", fname, i)))
+			if i < deleted && !os.IsNotExist(err) {
+				t.Fatalf("data file %d: expected to be deleted", i)
+			}
+			if i >= deleted && err != nil {
+				t.Fatalf("data file %d: %v", i, err)
+			}
+		}
+	}
+	if err := f.truncateTail(5); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 5, 30)
+	checkFiles(1) // Items 3, 4 and 5 share the second file
+	if f.itemOffset != 3 {
+		t.Fatalf("item offset mismatch: have %d, want %d", f.itemOffset, 3)
+	}
+	// Reopen the table and check that the hidden items stay hidden
+	f.Close()
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 5, 30)
+
+	// Hide all the items, only the head file should be retained
+	if err := f.truncateTail(30); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(f, 30, 30)
+	checkFiles(9)
+	if err := f.truncateTail(31); err == nil {
+		t.Fatal("expected error truncating the tail above the head")
+	}
+	// Truncating the head below the hidden items should rewind the tail
+	if err := f.truncate(28); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.truncate(26); err == nil {
+		t.Fatal("expected error truncating below the deleted items")
+	}
+	for x := 28; x < 32; x++ {
+		if err := f.Append(uint64(x), getChunk(15, x)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkRetrieve(f, 28, 32)
+
+	f.Close()
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkRetrieve(f, 28, 32)
+}
+
+// TestFreezerTruncateTailDanglingFiles tests that data files left behind by an
+// interrupted tail truncation are deleted on open.
+func TestFreezerTruncateTailDanglingFiles(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncate-tail-dangling-%d", rand.Uint64())
+
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 9; x++ {
+		f.Append(uint64(x), getChunk(15, x))
+	}
+	if err := f.truncateTail(6); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Recreate the deleted data files, as if the deletion never happened
+	for i := 0; i < 2; i++ {
+		name := filepath.Join(os.TempDir(), fmt.Sprintf("%s.%04d.rdat", fname, i))
+		if err := ioutil.WriteFile(name, getChunk(45, i), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, freezerCodecNone); err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 2; i++ {
+		name := filepath.Join(os.TempDir(), fmt.Sprintf("%s.%04d.rdat", fname, i))
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("dangling data file %d not deleted", i)
+		}
+	}
+	if got, err := f.Retrieve(6); err != nil {
+		t.Fatal(err)
+	} else if exp := getChunk(15, 6); !bytes.Equal(got, exp) {
+		t.Fatalf("have %x, want %x", got, exp)
+	}
+}
+
 // TODO (?)
 // - test that if we remove several head-files, aswell as data last data-file,
 //   the index is truncated accordingly
@@ -640,3 +876,70 @@ func TestOffset(t *testing.T) {
 // However, all 'normal' failure modes arising due to failing to sync() or save a file should be
 // handled already, and the case described above can only (?) happen if an external process/user
 // deletes files from the filesystem.
+
+// TestMigrateFreezerTable tests that a table can be recompressed with a different
+// codec, retaining its content and hidden tail items.
+func TestMigrateFreezerTable(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "freezer-migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(datadir)
+
+	f, err := newTable(datadir, freezerReceiptTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerCodecSnappy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 0; x < 100; x++ {
+		f.Append(uint64(x), getChunk(64, x))
+	}
+	if err := f.truncateTail(30); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for _, codec := range []freezerCodec{freezerCodecZstd, freezerCodecNone, freezerCodecSnappy} {
+		if err := MigrateFreezerTable(datadir, freezerReceiptTable, codec.String()); err != nil {
+			t.Fatalf("failed to migrate to %v: %v", codec, err)
+		}
+		f, err := newTable(datadir, freezerReceiptTable, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, freezerCodecSnappy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.codec != codec {
+			f.Close()
+			t.Fatalf("codec mismatch: have %v, want %v", f.codec, codec)
+		}
+		if f.has(29) {
+			f.Close()
+			t.Fatalf("codec %v: hidden item available", codec)
+		}
+		for x := 30; x < 100; x++ {
+			if blob, err := f.Retrieve(uint64(x)); err != nil {
+				f.Close()
+				t.Fatalf("codec %v: failed to retrieve item %d: %v", codec, x, err)
+			} else if !bytes.Equal(blob, getChunk(64, x)) {
+				f.Close()
+				t.Fatalf("codec %v: item %d mismatch: have %x", codec, x, blob)
+			}
+		}
+		f.Close()
+
+		// Only the files of the migrated table should be retained
+		files, err := ioutil.ReadDir(datadir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if name := file.Name(); name != codec.indexName(freezerReceiptTable) && name != codec.dataName(freezerReceiptTable, 0) && name != freezerReceiptTable+".meta" && name != "FLOCK" {
+				t.Fatalf("codec %v: unexpected file %s", codec, name)
+			}
+		}
+	}
+	if err := MigrateFreezerTable(datadir, "unknown", "zstd"); err == nil {
+		t.Fatal("migrated unknown table")
+	}
+	if err := MigrateFreezerTable(datadir, freezerReceiptTable, "lz4"); err == nil {
+		t.Fatal("migrated to unknown codec")
+	}
+}
@@ -60,6 +60,15 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// stateSchemeKey tracks the scheme used to store the state trie nodes.
+	stateSchemeKey = []byte("StateScheme")
+
+	// persistentStateRootKey tracks the root of the state persisted in the path scheme.
+	persistentStateRootKey = []byte("PersistentStateRoot")
+
+	// reverseDiffHeadKey tracks the id of the latest reverse diff in the path scheme.
+	reverseDiffHeadKey = []byte("ReverseDiffHead")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
@@ -86,12 +95,19 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hex path -> account trie node
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + account hash + hex path -> storage trie node
+	reverseDiffPrefix     = []byte("R") // reverseDiffPrefix + id (uint64 big endian) -> reverse diff
+	logIndexPrefix        = []byte("L") // logIndexPrefix + section (uint64 big endian) + term + hash -> log positions
+
+	reverseDiffLookupPrefix = []byte("RL") // reverseDiffLookupPrefix + state root -> id of the latest reverse diff rewinding to it
 
 	preimagePrefix = []byte("secure-key-")      // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	LogIndexPrefix       = []byte("iL") // LogIndexPrefix is the data table of the log indexer to track its progress
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -114,16 +130,23 @@ const (
 	freezerDifficultyTable = "diffs"
 )
 
-// freezerNoSnappy configures whether compression is disabled for the ancient-tables.
-// Hashes and difficulties don't compress well.
-var freezerNoSnappy = map[string]bool{
-	freezerHeaderTable:     false,
-	freezerHashTable:       true,
-	freezerBodiesTable:     false,
-	freezerReceiptTable:    false,
-	freezerDifficultyTable: true,
+// freezerCodecs is the default compression codec of newly created ancient-tables,
+// which may be overridden when opening the freezer. Hashes and difficulties don't
+// compress well. Existing tables retain the codec they were created with until
+// they are migrated.
+var freezerCodecs = map[string]freezerCodec{
+	freezerHeaderTable:     freezerCodecSnappy,
+	freezerHashTable:       freezerCodecNone,
+	freezerBodiesTable:     freezerCodecSnappy,
+	freezerReceiptTable:    freezerCodecSnappy,
+	freezerDifficultyTable: freezerCodecNone,
 }
 
+// freezerPrunableTables lists the ancient tables whose items may be deleted from
+// the tail. Hashes, headers and difficulties are retained to keep the chain
+// verifiable.
+var freezerPrunableTables = []string{freezerBodiesTable, freezerReceiptTable}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
@@ -204,6 +227,20 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// logIndexSectionKey = logIndexPrefix + section (uint64 big endian)
+func logIndexSectionKey(section uint64) []byte {
+	key := make([]byte, len(logIndexPrefix)+8)
+	n := copy(key, logIndexPrefix)
+	binary.BigEndian.PutUint64(key[n:], section)
+	return key
+}
+
+// logIndexKey = logIndexPrefix + section (uint64 big endian) + term + hash
+func logIndexKey(term []byte, section uint64, hash common.Hash) []byte {
+	key := append(logIndexSectionKey(section), term...)
+	return append(key, hash.Bytes()...)
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
@@ -223,6 +260,54 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// accountTrieNodeKey = TrieNodeAccountPrefix + hex path
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + account hash + hex path
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, accountHash.Bytes()...), path...)
+}
+
+// storageTrieNodesKey = TrieNodeStoragePrefix + account hash
+func storageTrieNodesKey(accountHash common.Hash) []byte {
+	return append(TrieNodeStoragePrefix, accountHash.Bytes()...)
+}
+
+// reverseDiffKey = reverseDiffPrefix + id (uint64 big endian)
+func reverseDiffKey(id uint64) []byte {
+	return append(reverseDiffPrefix, encodeBlockNumber(id)...)
+}
+
+// reverseDiffLookupKey = reverseDiffLookupPrefix + state root
+func reverseDiffLookupKey(root common.Hash) []byte {
+	return append(reverseDiffLookupPrefix, root.Bytes()...)
+}
+
+// IsTrieNodePathKey reports whether the given byte slice is the key of a trie
+// node stored in the path scheme.
+func IsTrieNodePathKey(key []byte) bool {
+	var path []byte
+	switch {
+	case bytes.HasPrefix(key, TrieNodeAccountPrefix):
+		path = key[len(TrieNodeAccountPrefix):]
+	case bytes.HasPrefix(key, TrieNodeStoragePrefix) && len(key) >= len(TrieNodeStoragePrefix)+common.HashLength:
+		path = key[len(TrieNodeStoragePrefix)+common.HashLength:]
+	default:
+		return false
+	}
+	if len(path) > 2*common.HashLength {
+		return false
+	}
+	for _, nibble := range path {
+		if nibble >= 16 {
+			return false
+		}
+	}
+	return true
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
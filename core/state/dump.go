@@ -111,6 +111,9 @@ func (d iterativeDump) OnRoot(root common.Hash) {
 	}{root})
 }
 
+// DumpToCollector iterates the state according to the given options and inserts
+// the items into a collector for aggregation or serialization. If the iteration
+// fails, the error is retained in the state, see Error.
 func (s *StateDB) DumpToCollector(c DumpCollector, excludeCode, excludeStorage, excludeMissingPreimages bool, start []byte, maxResults int) (nextKey []byte) {
 	missingPreimages := 0
 	c.OnRoot(s.trie.Hash())
@@ -153,6 +156,11 @@ func (s *StateDB) DumpToCollector(c DumpCollector, excludeCode, excludeStorage,
 				}
 				account.Storage[common.BytesToHash(s.trie.GetKey(storageIt.Key))] = common.Bytes2Hex(content)
 			}
+			if storageIt.Err != nil {
+				log.Error("Failed to iterate storage trie", "address", addr, "err", storageIt.Err)
+				s.setError(storageIt.Err)
+				return nil
+			}
 		}
 		c.OnAccount(addr, account)
 		count++
@@ -163,6 +171,11 @@ func (s *StateDB) DumpToCollector(c DumpCollector, excludeCode, excludeStorage,
 			break
 		}
 	}
+	if it.Err != nil {
+		log.Error("Failed to iterate account trie", "root", s.trie.Hash(), "err", it.Err)
+		s.setError(it.Err)
+		return nil
+	}
 	if missingPreimages > 0 {
 		log.Warn("Dump incomplete due to missing preimages", "missing", missingPreimages)
 	}
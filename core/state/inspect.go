@@ -0,0 +1,272 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// errNoSnapshot is returned when inspecting the contracts of a database which
+// doesn't contain a state snapshot.
+var errNoSnapshot = errors.New("state snapshot unavailable")
+
+// ContractUsage is the disk footprint of the storage and code of a contract.
+type ContractUsage struct {
+	Hash          common.Hash     `json:"hash"`
+	Address       *common.Address `json:"address,omitempty"` // Only present if the preimage is known
+	Slots         uint64          `json:"slots"`
+	SnapshotBytes uint64          `json:"snapshotBytes"`
+	TrieNodes     uint64          `json:"trieNodes"`
+	TrieBytes     uint64          `json:"trieBytes"`
+	CodeSize      uint64          `json:"codeSize"`
+}
+
+// Bytes returns the combined size of the storage snapshot and trie of the contract.
+// In the hash scheme the trie size includes the nodes shared with other contracts.
+func (u *ContractUsage) Bytes() uint64 {
+	return u.SnapshotBytes + u.TrieBytes
+}
+
+// ContractReport is the result of a contract storage inspection. It contains
+// the totals across all contracts and the breakdown of the largest ones, and
+// can be saved as JSON to measure growth between runs. The trie sizes have a
+// different meaning in each state scheme, so only reports of the same scheme
+// can be compared.
+type ContractReport struct {
+	Root          common.Hash      `json:"root"`
+	Scheme        string           `json:"scheme"`
+	Time          time.Time        `json:"time"`
+	Contracts     uint64           `json:"contracts"`
+	Slots         uint64           `json:"slots"`
+	SnapshotBytes uint64           `json:"snapshotBytes"`
+	TrieBytes     uint64           `json:"trieBytes"`
+	Largest       []*ContractUsage `json:"largest"`
+}
+
+// ContractGrowth is the change in the footprint of a contract between two
+// contract reports.
+type ContractGrowth struct {
+	Hash     common.Hash     `json:"hash"`
+	Address  *common.Address `json:"address,omitempty"`
+	Unknown  bool            `json:"unknown,omitempty"` // Previous footprint not in the report, changes are zero
+	Slots    int64           `json:"slots"`
+	Bytes    int64           `json:"bytes"`
+	CodeSize int64           `json:"codeSize"`
+}
+
+// InspectContracts iterates the storage snapshot of the database and breaks the
+// storage usage down by contract. The largest contracts by slot count and by
+// bytes are reported in detail, along with their code size.
+//
+// Storage trie nodes can only be attributed to contracts by their key in the
+// path scheme. In the hash scheme they are shared between contracts, so the
+// tries of the largest contracts by slot count and by snapshot size are walked
+// instead, the largest ones by bytes are picked among those, and the totals
+// don't include trie nodes.
+func InspectContracts(db ethdb.Database, top int) (*ContractReport, error) {
+	root := rawdb.ReadSnapshotRoot(db)
+	if root == (common.Hash{}) {
+		return nil, errNoSnapshot
+	}
+	var (
+		usage  = make(map[common.Hash]*ContractUsage)
+		report = &ContractReport{Root: root, Scheme: rawdb.ReadStateScheme(db), Time: time.Now()}
+		start  = time.Now()
+		logged = time.Now()
+		count  uint64
+	)
+	contract := func(hash common.Hash) *ContractUsage {
+		u, ok := usage[hash]
+		if !ok {
+			u = &ContractUsage{Hash: hash}
+			usage[hash] = u
+		}
+		return u
+	}
+	// Count the storage slots of all contracts in the snapshot
+	it := db.NewIterator(rawdb.SnapshotStoragePrefix, nil)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(rawdb.SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		u := contract(common.BytesToHash(key[len(rawdb.SnapshotStoragePrefix) : len(rawdb.SnapshotStoragePrefix)+common.HashLength]))
+		u.Slots++
+		u.SnapshotBytes += uint64(len(key) + len(it.Value()))
+
+		report.Slots++
+		report.SnapshotBytes += uint64(len(key) + len(it.Value()))
+
+		if count++; count%1000 == 0 && time.Since(logged) > 8*time.Second {
+			log.Info("Inspecting storage snapshot", "slots", count, "contracts", len(usage), "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	// Count the storage trie nodes of all contracts if they are keyed by owner
+	pathScheme := report.Scheme == rawdb.PathScheme
+	if pathScheme {
+		it := db.NewIterator(rawdb.TrieNodeStoragePrefix, nil)
+		for it.Next() {
+			key := it.Key()
+			if !rawdb.IsTrieNodePathKey(key) {
+				continue
+			}
+			u := contract(common.BytesToHash(key[len(rawdb.TrieNodeStoragePrefix) : len(rawdb.TrieNodeStoragePrefix)+common.HashLength]))
+			u.TrieNodes++
+			u.TrieBytes += uint64(len(key) + len(it.Value()))
+
+			report.TrieBytes += uint64(len(key) + len(it.Value()))
+		}
+		it.Release()
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+	}
+	report.Contracts = uint64(len(usage))
+
+	// Pick the candidates for the largest contracts by slot count and by bytes.
+	// The trie sizes are only known for the candidates in the hash scheme, so
+	// rank by bytes once they are filled in.
+	all := make([]*ContractUsage, 0, len(usage))
+	for _, u := range usage {
+		all = append(all, u)
+	}
+	bySlots := func(a, b *ContractUsage) bool { return a.Slots > b.Slots }
+	byBytes := func(a, b *ContractUsage) bool { return a.Bytes() > b.Bytes() }
+
+	candidates := largestContracts(all, top, bySlots, byBytes)
+
+	// Fill in the details of the candidates from their accounts
+	triedb := trie.NewDatabase(db)
+	for _, u := range candidates {
+		if preimage := rawdb.ReadPreimage(db, u.Hash); len(preimage) == common.AddressLength {
+			addr := common.BytesToAddress(preimage)
+			u.Address = &addr
+		}
+		data := rawdb.ReadAccountSnapshot(db, u.Hash)
+		if len(data) == 0 {
+			continue // Dangling storage, reported with the snapshot data only
+		}
+		account, err := snapshot.FullAccount(data)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(account.CodeHash, emptyCodeHash) {
+			u.CodeSize = uint64(len(rawdb.ReadCode(db, common.BytesToHash(account.CodeHash))))
+		}
+		if pathScheme {
+			continue
+		}
+		tr, err := trie.NewSecure(common.BytesToHash(account.Root), triedb)
+		if err != nil {
+			log.Warn("Storage trie unavailable", "hash", u.Hash, "root", common.BytesToHash(account.Root), "err", err)
+			continue
+		}
+		nodes := tr.NodeIterator(nil)
+		for nodes.Next(true) {
+			if hash := nodes.Hash(); hash != (common.Hash{}) {
+				u.TrieNodes++
+				u.TrieBytes += uint64(common.HashLength + len(rawdb.ReadTrieNode(db, hash)))
+			}
+		}
+		if err := nodes.Error(); err != nil {
+			log.Warn("Storage trie incomplete", "hash", u.Hash, "root", common.BytesToHash(account.Root), "err", err)
+		}
+	}
+	report.Largest = largestContracts(candidates, top, bySlots, byBytes)
+	sort.SliceStable(report.Largest, func(i, j int) bool { return byBytes(report.Largest[i], report.Largest[j]) })
+
+	log.Info("Inspected contract storage", "contracts", report.Contracts, "slots", report.Slots, "elapsed", common.PrettyDuration(time.Since(start)))
+	return report, nil
+}
+
+// largestContracts returns the union of the top contracts by each of the given
+// orderings, in the order they were picked.
+func largestContracts(usage []*ContractUsage, top int, orders ...func(a, b *ContractUsage) bool) []*ContractUsage {
+	var (
+		sorted   = append([]*ContractUsage(nil), usage...)
+		selected = make(map[common.Hash]struct{})
+		largest  []*ContractUsage
+	)
+	for _, less := range orders {
+		sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+		for i := 0; i < len(sorted) && i < top; i++ {
+			if _, ok := selected[sorted[i].Hash]; !ok {
+				selected[sorted[i].Hash] = struct{}{}
+				largest = append(largest, sorted[i])
+			}
+		}
+	}
+	return largest
+}
+
+// Growth compares the largest contracts of the report against a previous one,
+// sorted by the number of bytes gained. Contracts absent from the previous
+// report are either new or were below its cutoff, so they are marked unknown
+// and sorted last, unless the previous report detailed every contract. The
+// contracts absent from this report are omitted. Reports of different state
+// schemes are refused.
+func (r *ContractReport) Growth(prev *ContractReport) ([]*ContractGrowth, error) {
+	if r.Scheme != prev.Scheme {
+		return nil, fmt.Errorf("contract report scheme mismatch: have %q, previous %q", r.Scheme, prev.Scheme)
+	}
+	old := make(map[common.Hash]*ContractUsage)
+	for _, u := range prev.Largest {
+		old[u.Hash] = u
+	}
+	complete := uint64(len(prev.Largest)) == prev.Contracts
+
+	growth := make([]*ContractGrowth, 0, len(r.Largest))
+	for _, u := range r.Largest {
+		g := &ContractGrowth{
+			Hash:    u.Hash,
+			Address: u.Address,
+		}
+		if p, ok := old[u.Hash]; ok {
+			g.Slots = int64(u.Slots) - int64(p.Slots)
+			g.Bytes = int64(u.Bytes()) - int64(p.Bytes())
+			g.CodeSize = int64(u.CodeSize) - int64(p.CodeSize)
+		} else if complete {
+			g.Slots, g.Bytes, g.CodeSize = int64(u.Slots), int64(u.Bytes()), int64(u.CodeSize)
+		} else {
+			g.Unknown = true
+		}
+		growth = append(growth, g)
+	}
+	sort.SliceStable(growth, func(i, j int) bool {
+		if growth[i].Unknown != growth[j].Unknown {
+			return !growth[i].Unknown
+		}
+		return growth[i].Bytes > growth[j].Bytes
+	})
+	return growth, nil
+}
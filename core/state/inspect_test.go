@@ -0,0 +1,131 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+)
+
+// Tests that the storage usage is broken down by contract, and that growth is
+// measured against a previous report.
+func TestInspectContracts(t *testing.T) {
+	var (
+		diskdb = rawdb.NewMemoryDatabase()
+		sdb    = NewDatabaseWithConfig(diskdb, nil)
+		small  = common.HexToAddress("0x01")
+		large  = common.HexToAddress("0x02")
+	)
+	// commit fills the contracts with the given number of slots and generates
+	// the snapshot of the resulting state
+	commit := func(root common.Hash, smallSlots, largeSlots int) common.Hash {
+		state, _ := New(root, sdb, nil)
+		state.SetCode(small, []byte{0x1, 0x2, 0x3})
+		state.SetCode(large, make([]byte, 100))
+		for i := 0; i < smallSlots; i++ {
+			state.SetState(small, common.BytesToHash([]byte{byte(i)}), common.Hash{0x1})
+		}
+		for i := 0; i < largeSlots; i++ {
+			state.SetState(large, common.BytesToHash([]byte{byte(i)}), common.Hash{0x1})
+		}
+		root, err := state.Commit(false)
+		if err != nil {
+			t.Fatalf("failed to commit state: %v", err)
+		}
+		if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to commit trie: %v", err)
+		}
+		if _, err := snapshot.New(diskdb, sdb.TrieDB(), 16, root, false, true, false); err != nil {
+			t.Fatalf("failed to generate snapshot: %v", err)
+		}
+		return root
+	}
+	if _, err := InspectContracts(diskdb, 10); err != errNoSnapshot {
+		t.Fatalf("inspection error mismatch: have %v, want %v", err, errNoSnapshot)
+	}
+	root := commit(common.Hash{}, 1, 10)
+	prev, err := InspectContracts(diskdb, 10)
+	if err != nil {
+		t.Fatalf("failed to inspect contracts: %v", err)
+	}
+	if prev.Root != root {
+		t.Fatalf("root mismatch: have %x, want %x", prev.Root, root)
+	}
+	if prev.Contracts != 2 || prev.Slots != 11 {
+		t.Fatalf("totals mismatch: have %d contracts %d slots, want 2 contracts 11 slots", prev.Contracts, prev.Slots)
+	}
+	if len(prev.Largest) != 2 {
+		t.Fatalf("largest contract count mismatch: have %d, want 2", len(prev.Largest))
+	}
+	first := prev.Largest[0]
+	if first.Address == nil || *first.Address != large {
+		t.Fatalf("largest contract mismatch: have %v, want %x", first.Address, large)
+	}
+	if first.Slots != 10 || first.CodeSize != 100 || first.TrieNodes == 0 || first.SnapshotBytes == 0 {
+		t.Fatalf("largest contract usage mismatch: %+v", first)
+	}
+	if second := prev.Largest[1]; second.Slots != 1 || second.CodeSize != 3 {
+		t.Fatalf("smaller contract usage mismatch: %+v", second)
+	}
+	// Only the requested number of contracts should be detailed
+	if report, err := InspectContracts(diskdb, 1); err != nil {
+		t.Fatalf("failed to inspect contracts: %v", err)
+	} else if len(report.Largest) != 1 || report.Largest[0].Hash != first.Hash {
+		t.Fatalf("largest contracts mismatch: have %d", len(report.Largest))
+	}
+	// Grow the large contract and measure against the previous report
+	commit(root, 1, 20)
+	report, err := InspectContracts(diskdb, 10)
+	if err != nil {
+		t.Fatalf("failed to inspect contracts: %v", err)
+	}
+	growth, err := report.Growth(prev)
+	if err != nil {
+		t.Fatalf("failed to measure growth: %v", err)
+	}
+	if len(growth) != 2 {
+		t.Fatalf("growth count mismatch: have %d, want 2", len(growth))
+	}
+	if growth[0].Hash != first.Hash || growth[0].Slots != 10 || growth[0].Bytes <= 0 || growth[0].CodeSize != 0 {
+		t.Fatalf("growth mismatch: %+v", growth[0])
+	}
+	if growth[1].Slots != 0 || growth[1].Bytes != 0 || growth[1].Unknown {
+		t.Fatalf("unchanged contract grew: %+v", growth[1])
+	}
+	// Contracts below the cutoff of the previous report can't be measured
+	prev.Largest = prev.Largest[:1]
+	if growth, err = report.Growth(prev); err != nil {
+		t.Fatalf("failed to measure growth: %v", err)
+	}
+	if len(growth) != 2 {
+		t.Fatalf("growth count mismatch: have %d, want 2", len(growth))
+	}
+	if growth[0].Hash != first.Hash || growth[0].Unknown || growth[0].Slots != 10 {
+		t.Fatalf("growth mismatch: %+v", growth[0])
+	}
+	if !growth[1].Unknown || growth[1].Slots != 0 || growth[1].Bytes != 0 {
+		t.Fatalf("contract below the cutoff measured: %+v", growth[1])
+	}
+	// Reports of different state schemes can't be compared
+	prev.Scheme = rawdb.PathScheme
+	if _, err := report.Growth(prev); err == nil {
+		t.Fatal("growth measured across state schemes")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// missingTrie is a placeholder for an account trie which is not available in
+// the database anymore, while the state itself is still covered by a snapshot.
+// All the reads are served by the snapshot, any access falling through to the
+// trie fails with the error the trie failed to open with.
+type missingTrie struct {
+	root common.Hash
+	err  error
+}
+
+func (t *missingTrie) GetKey([]byte) []byte                  { return nil }
+func (t *missingTrie) TryGet(key []byte) ([]byte, error)     { return nil, t.err }
+func (t *missingTrie) TryUpdate(key, value []byte) error     { return t.err }
+func (t *missingTrie) TryDelete(key []byte) error            { return t.err }
+func (t *missingTrie) Hash() common.Hash                     { return t.root }
+func (t *missingTrie) CommittedNodes() *trie.NodeSet         { return nil }
+func (t *missingTrie) NodeIterator([]byte) trie.NodeIterator { return &missingIterator{err: t.err} }
+
+func (t *missingTrie) Commit(onleaf trie.LeafCallback) (common.Hash, error) {
+	return common.Hash{}, t.err
+}
+
+func (t *missingTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return t.err
+}
+
+// missingIterator is the node iterator of a missing trie, which fails right
+// away without yielding any nodes.
+type missingIterator struct {
+	err error
+}
+
+func (it *missingIterator) Next(bool) bool      { return false }
+func (it *missingIterator) Error() error        { return it.err }
+func (it *missingIterator) Hash() common.Hash   { return common.Hash{} }
+func (it *missingIterator) Parent() common.Hash { return common.Hash{} }
+func (it *missingIterator) Path() []byte        { return nil }
+func (it *missingIterator) Leaf() bool          { return false }
+func (it *missingIterator) LeafKey() []byte     { return nil }
+func (it *missingIterator) LeafBlob() []byte    { return nil }
+func (it *missingIterator) LeafProof() [][]byte { return nil }
@@ -0,0 +1,383 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// DefaultOnlineBloomSize is the default memory allowance of the state bloom
+	// used by the online pruner, in megabytes.
+	DefaultOnlineBloomSize = 2048
+
+	// DefaultOnlineThrottle is the default pause of the online pruner after each
+	// unit of work, yielding the database to the block processing.
+	DefaultOnlineThrottle = 10 * time.Millisecond
+
+	// onlineMarkThrottle is the number of marked nodes after which the marking
+	// stage yields to the block processing for the configured throttle time.
+	onlineMarkThrottle = 100000
+)
+
+var (
+	// errPruningAborted is returned if the online pruning is interrupted.
+	errPruningAborted = errors.New("pruning aborted")
+
+	markedNodesMeter = metrics.NewRegisteredMeter("state/prune/marked", nil)
+	sweptNodesMeter  = metrics.NewRegisteredMeter("state/prune/swept", nil)
+	sweptBytesMeter  = metrics.NewRegisteredMeter("state/prune/swept/bytes", nil)
+	pruneStageGauge  = metrics.NewRegisteredGauge("state/prune/stage", nil)
+)
+
+// Stages of the online pruning, reported through the status and the metrics.
+const (
+	OnlineStageIdle  = "idle"  // No pruning is running
+	OnlineStageMark  = "mark"  // Live trie nodes are being marked
+	OnlineStageSweep = "sweep" // Unmarked trie nodes are being deleted
+)
+
+// OnlineConfig contains the settings of the online pruner.
+type OnlineConfig struct {
+	BloomSize uint64        // Megabytes of memory allowed for the state bloom
+	Throttle  time.Duration // Pause after each unit of work to yield to block processing
+}
+
+// OnlineStatus is a snapshot of the progress of the online pruning.
+type OnlineStatus struct {
+	Root    common.Hash        `json:"root"`
+	Stage   string             `json:"stage"`
+	Marked  uint64             `json:"marked"`
+	Swept   uint64             `json:"swept"`
+	Size    common.StorageSize `json:"size"`
+	Started time.Time          `json:"started"`
+}
+
+// OnlinePruner deletes the stale state from a database while the node is live
+// and keeps importing blocks on top of it. As opposed to the offline Pruner,
+// the state bloom is never complete: nodes flushed by the live trie database
+// must be reported via Mark for the whole duration of the pruning.
+//
+// The workflow of the online pruner is:
+//
+// - mark all trie nodes of the target state, regenerated from the snapshot
+// - mark all trie nodes of the live states which are not in the target state
+// - iterate the database, delete all trie nodes which were not marked
+//
+// Contract codes are never deleted by the online pruner.
+type OnlinePruner struct {
+	db     ethdb.Database
+	root   common.Hash
+	config OnlineConfig
+	bloom  *stateBloom
+
+	marked  uint64       // Number of trie nodes marked (atomic)
+	swept   uint64       // Number of trie nodes deleted (atomic)
+	size    uint64       // Storage size of the deleted trie nodes (atomic)
+	stage   atomic.Value // Current stage of the pruning
+	started time.Time
+
+	lock sync.RWMutex // Lock ordering the deletions against the concurrent marks
+}
+
+// NewOnlinePruner creates an online pruner retaining the state of the given
+// root and all the nodes marked during the pruning.
+func NewOnlinePruner(db ethdb.Database, root common.Hash, config OnlineConfig) (*OnlinePruner, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errPathScheme
+	}
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	bloom, err := newStateBloomWithSize(config.BloomSize)
+	if err != nil {
+		return nil, err
+	}
+	p := &OnlinePruner{
+		db:      db,
+		root:    root,
+		config:  config,
+		bloom:   bloom,
+		started: time.Now(),
+	}
+	p.setStage(OnlineStageMark)
+	return p, nil
+}
+
+// setStage updates the current stage of the pruning.
+func (p *OnlinePruner) setStage(stage string) {
+	p.stage.Store(stage)
+	switch stage {
+	case OnlineStageMark:
+		pruneStageGauge.Update(1)
+	case OnlineStageSweep:
+		pruneStageGauge.Update(2)
+	default:
+		pruneStageGauge.Update(0)
+	}
+}
+
+// Status returns the current progress of the pruning.
+func (p *OnlinePruner) Status() OnlineStatus {
+	return OnlineStatus{
+		Root:    p.root,
+		Stage:   p.stage.Load().(string),
+		Marked:  atomic.LoadUint64(&p.marked),
+		Swept:   atomic.LoadUint64(&p.swept),
+		Size:    common.StorageSize(atomic.LoadUint64(&p.size)),
+		Started: p.started,
+	}
+}
+
+// Mark flags a trie node as live, preventing its deletion. It's meant to be
+// installed as the flush hook of the live trie database, so it must be called
+// before the node is written into the database.
+func (p *OnlinePruner) Mark(hash common.Hash) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	p.bloom.Put(hash.Bytes(), nil)
+	atomic.AddUint64(&p.marked, 1)
+	markedNodesMeter.Mark(1)
+}
+
+// onlineBloomWriter is a write-only key-value store feeding the state bloom of
+// an online pruner, throttling the trie regeneration.
+type onlineBloomWriter struct {
+	pruner *OnlinePruner
+	abort  <-chan struct{}
+}
+
+// Put implements the KeyValueWriter interface, marking trie nodes and codes.
+func (w *onlineBloomWriter) Put(key []byte, value []byte) error {
+	select {
+	case <-w.abort:
+		return errPruningAborted
+	default:
+	}
+	if err := w.pruner.bloom.Put(key, value); err != nil {
+		return err
+	}
+	if atomic.AddUint64(&w.pruner.marked, 1)%onlineMarkThrottle == 0 {
+		time.Sleep(w.pruner.config.Throttle)
+	}
+	markedNodesMeter.Mark(1)
+	return nil
+}
+
+// Delete implements the KeyValueWriter interface.
+func (w *onlineBloomWriter) Delete(key []byte) error { panic("not supported") }
+
+// MarkState marks all trie nodes of the pruning target regenerated from the
+// snapshot, along with the genesis state. The snapshot layer of the target
+// must be pinned while marking.
+func (p *OnlinePruner) MarkState(snaptree *snapshot.Tree, abort <-chan struct{}) error {
+	start := time.Now()
+	if err := snapshot.GenerateTrie(snaptree, p.root, p.db, &onlineBloomWriter{pruner: p, abort: abort}); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, p.bloom); err != nil {
+		return err
+	}
+	log.Info("Marked target state", "root", p.root, "nodes", atomic.LoadUint64(&p.marked), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// MarkLive marks all trie nodes of a live state which are not part of the
+// pruning target. Both states must be fully resolvable from the trie database
+// for the duration of the call.
+func (p *OnlinePruner) MarkLive(triedb *trie.Database, root common.Hash, abort <-chan struct{}) error {
+	if root == p.root {
+		return nil
+	}
+	base, err := trie.New(p.root, triedb)
+	if err != nil {
+		return err
+	}
+	live, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it, _ := trie.NewDifferenceIterator(base.NodeIterator(nil), live.NodeIterator(nil))
+	for it.Next(true) {
+		select {
+		case <-abort:
+			return errPruningAborted
+		default:
+		}
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			p.markLiveNode(hash)
+		}
+		if !it.Leaf() {
+			continue
+		}
+		// Account changed or created, mark the changed part of its storage
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		if acc.Root == emptyRoot {
+			continue
+		}
+		baseRoot := emptyRoot
+		if blob, err := base.TryGet(it.LeafKey()); err != nil {
+			return err
+		} else if len(blob) > 0 {
+			var old state.Account
+			if err := rlp.DecodeBytes(blob, &old); err != nil {
+				return err
+			}
+			baseRoot = old.Root
+		}
+		if baseRoot == acc.Root {
+			continue
+		}
+		if err := p.markLiveStorage(triedb, baseRoot, acc.Root, abort); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// markLiveStorage marks all trie nodes of a live storage trie which are not
+// part of the storage trie of the same account in the pruning target.
+func (p *OnlinePruner) markLiveStorage(triedb *trie.Database, baseRoot, root common.Hash, abort <-chan struct{}) error {
+	base, err := trie.New(baseRoot, triedb)
+	if err != nil {
+		return err
+	}
+	live, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it, _ := trie.NewDifferenceIterator(base.NodeIterator(nil), live.NodeIterator(nil))
+	for it.Next(true) {
+		select {
+		case <-abort:
+			return errPruningAborted
+		default:
+		}
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			p.markLiveNode(hash)
+		}
+	}
+	return it.Error()
+}
+
+// markLiveNode marks a single node of a live state, throttling the traversal.
+func (p *OnlinePruner) markLiveNode(hash common.Hash) {
+	p.bloom.Put(hash.Bytes(), nil)
+	if atomic.AddUint64(&p.marked, 1)%onlineMarkThrottle == 0 {
+		time.Sleep(p.config.Throttle)
+	}
+	markedNodesMeter.Mark(1)
+}
+
+// Sweep iterates the database and deletes all trie nodes which were not marked.
+// Nodes marked concurrently are never deleted, as the deletions are checked
+// against the bloom again right before they are written.
+func (p *OnlinePruner) Sweep(abort <-chan struct{}) error {
+	p.setStage(OnlineStageSweep)
+	defer p.setStage(OnlineStageIdle)
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+		keys   [][]byte
+		sizes  []int
+		size   int
+		iter   = p.db.NewIterator(nil, nil)
+	)
+	defer func() { iter.Release() }()
+
+	flush := func() error {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+
+		batch := p.db.NewBatch()
+		for i, key := range keys {
+			if ok, _ := p.bloom.Contain(key); ok {
+				continue // Marked since it was scanned, retain
+			}
+			batch.Delete(key)
+			atomic.AddUint64(&p.swept, 1)
+			atomic.AddUint64(&p.size, uint64(sizes[i]))
+			sweptNodesMeter.Mark(1)
+			sweptBytesMeter.Mark(int64(sizes[i]))
+		}
+		keys, sizes, size = keys[:0], sizes[:0], 0
+		return batch.Write()
+	}
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		if ok, _ := p.bloom.Contain(key); ok {
+			continue
+		}
+		key = common.CopyBytes(key)
+		keys = append(keys, key)
+		sizes = append(sizes, len(key)+len(iter.Value()))
+		size += len(key)
+
+		if size >= ethdb.IdealBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			// Recreate the iterator after every batch commit in order
+			// to allow the underlying compactor to delete the entries.
+			iter.Release()
+			iter = p.db.NewIterator(nil, key)
+
+			if time.Since(logged) > 8*time.Second {
+				log.Info("Pruning state data", "nodes", atomic.LoadUint64(&p.swept), "size", common.StorageSize(atomic.LoadUint64(&p.size)),
+					"at", common.BytesToHash(key), "elapsed", common.PrettyDuration(time.Since(start)))
+				logged = time.Now()
+			}
+			select {
+			case <-abort:
+				return errPruningAborted
+			case <-time.After(p.config.Throttle):
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if err := flush(); err != nil {
+			return err
+		}
+	}
+	log.Info("Pruned state data", "nodes", atomic.LoadUint64(&p.swept), "size", common.StorageSize(atomic.LoadUint64(&p.size)), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
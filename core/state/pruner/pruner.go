@@ -62,6 +62,10 @@ var (
 
 	// emptyCode is the known hash of the empty EVM bytecode.
 	emptyCode = crypto.Keccak256(nil)
+
+	// errPathScheme is returned if pruning is requested on a database storing
+	// the trie nodes in the path scheme, which never retains stale state.
+	errPathScheme = errors.New("state pruning is not supported in path scheme")
 )
 
 // Pruner is an offline tool to prune the stale state with the
@@ -86,6 +90,9 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, headHeader *types.Header, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errPathScheme
+	}
 	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, headHeader.Root, false, false, false)
 	if err != nil {
 		return nil, err // The relevant snapshot(s) might not exist
@@ -423,15 +423,21 @@ func (dl *diffLayer) Update(blockRoot common.Hash, destructs map[common.Hash]str
 // a single diff at the bottom. Since usually the lowermost diff is the largest,
 // the flattening builds up from there in reverse.
 func (dl *diffLayer) flatten() snapshot {
+	return dl.flattenTo(nil)
+}
+
+// flattenTo is like flatten, but it stops at the given parent layer, leaving it
+// and its ancestors unmodified.
+func (dl *diffLayer) flattenTo(stop snapshot) snapshot {
 	// If the parent is not diff, we're the first in line, return unmodified
 	parent, ok := dl.parent.(*diffLayer)
-	if !ok {
+	if !ok || snapshot(parent) == stop {
 		return dl
 	}
 	// Parent is a diff, flatten it first (note, apart from weird corned cases,
 	// flatten will realistically only ever merge 1 layer, so there's no need to
 	// be smarter about grouping flattens together).
-	parent = parent.flatten().(*diffLayer)
+	parent = parent.flattenTo(stop).(*diffLayer)
 
 	parent.lock.Lock()
 	defer parent.lock.Unlock()
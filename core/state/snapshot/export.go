@@ -0,0 +1,403 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// The snapshot dump is a portable file format of the flat state of a given block.
+// It starts with a header carrying the block itself, followed by a stream of
+// self-contained chunks, each carrying a checksum of its payload. The last chunk
+// summarizes the item counts so that truncated dumps can be detected.
+const (
+	dumpMagic     = "geth-snapshot" // Identifier of the snapshot dump files
+	dumpVersion   = 1               // Version of the snapshot dump format
+	dumpChunkSize = 4 * 1024 * 1024 // Approximate payload size of a single chunk
+)
+
+// Kinds of the chunks in a snapshot dump.
+const (
+	dumpAccountChunk uint8 = iota // Slim RLP encoded accounts
+	dumpStorageChunk              // Storage slots of a single account
+	dumpCodeChunk                 // Contract codes, keyed by hash
+	dumpEndChunk                  // Summary of the dump, last chunk
+)
+
+var (
+	// errDumpTruncated is returned if a snapshot dump ends without a summary.
+	errDumpTruncated = errors.New("snapshot dump truncated")
+
+	// dumpCRCTable is the polynomial table used to checksum the chunks.
+	dumpCRCTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// dumpHeader is the first item of a snapshot dump, carrying the block whose
+// state is dumped, so that it can be imported into a database without it.
+type dumpHeader struct {
+	Magic   string
+	Version uint64
+	Header  *types.Header
+	Body    *types.Body
+	Td      *big.Int
+}
+
+// dumpChunk is a checksummed section of a snapshot dump. The payload is the RLP
+// encoding of a dumpEntries or, for the last chunk, a dumpSummary.
+type dumpChunk struct {
+	Kind     uint8
+	Payload  []byte
+	Checksum uint32
+}
+
+// dumpEntries is a batch of snapshot items of the same kind.
+type dumpEntries struct {
+	Account common.Hash // Owner of the slots in storage chunks, empty otherwise
+	Keys    []common.Hash
+	Vals    [][]byte
+}
+
+// dumpSummary is the payload of the last chunk of a snapshot dump.
+type dumpSummary struct {
+	Accounts uint64
+	Slots    uint64
+	Codes    uint64
+}
+
+// dumpWriter batches snapshot items into chunks and writes them out.
+type dumpWriter struct {
+	w       io.Writer
+	entries map[uint8]*dumpEntries
+	sizes   map[uint8]int
+}
+
+// add appends an item to the pending chunk of the given kind, flushing it out if
+// it grew large enough.
+func (dw *dumpWriter) add(kind uint8, account common.Hash, key common.Hash, val []byte) error {
+	entries := dw.entries[kind]
+	if entries == nil {
+		entries = &dumpEntries{Account: account}
+		dw.entries[kind] = entries
+	}
+	entries.Keys = append(entries.Keys, key)
+	entries.Vals = append(entries.Vals, val)
+
+	dw.sizes[kind] += common.HashLength + len(val)
+	if dw.sizes[kind] >= dumpChunkSize {
+		return dw.flush(kind)
+	}
+	return nil
+}
+
+// flush writes out the pending chunk of the given kind, if any.
+func (dw *dumpWriter) flush(kind uint8) error {
+	entries := dw.entries[kind]
+	if entries == nil {
+		return nil
+	}
+	delete(dw.entries, kind)
+	delete(dw.sizes, kind)
+	return dw.write(kind, entries)
+}
+
+// write encodes and checksums a chunk payload and writes it out.
+func (dw *dumpWriter) write(kind uint8, payload interface{}) error {
+	blob, err := rlp.EncodeToBytes(payload)
+	if err != nil {
+		return err
+	}
+	return rlp.Encode(dw.w, &dumpChunk{
+		Kind:     kind,
+		Payload:  blob,
+		Checksum: crc32.Checksum(blob, dumpCRCTable),
+	})
+}
+
+// Export streams the flat state of the given block, including the contract codes
+// read from codedb, into a snapshot dump. The block and its total difficulty are
+// stored in the dump too.
+func Export(w io.Writer, snaptree *Tree, block *types.Block, td *big.Int, codedb ethdb.KeyValueReader) error {
+	root := block.Root()
+	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer acctIt.Release()
+
+	if err := rlp.Encode(w, &dumpHeader{
+		Magic:   dumpMagic,
+		Version: dumpVersion,
+		Header:  block.Header(),
+		Body:    block.Body(),
+		Td:      td,
+	}); err != nil {
+		return err
+	}
+	var (
+		dw = &dumpWriter{
+			w:       w,
+			entries: make(map[uint8]*dumpEntries),
+			sizes:   make(map[uint8]int),
+		}
+		summary dumpSummary
+		codes   = make(map[common.Hash]struct{})
+
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for acctIt.Next() {
+		accountHash, blob := acctIt.Hash(), acctIt.Account()
+		if err := dw.add(dumpAccountChunk, common.Hash{}, accountHash, blob); err != nil {
+			return err
+		}
+		summary.Accounts++
+
+		account, err := FullAccount(blob)
+		if err != nil {
+			return err
+		}
+		// Export each contract code once, no matter how many accounts share it
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+			if _, ok := codes[codeHash]; !ok {
+				code := rawdb.ReadCode(codedb, codeHash)
+				if len(code) == 0 {
+					return fmt.Errorf("missing code %x of account %x", codeHash, accountHash)
+				}
+				if err := dw.add(dumpCodeChunk, common.Hash{}, codeHash, code); err != nil {
+					return err
+				}
+				codes[codeHash] = struct{}{}
+				summary.Codes++
+			}
+		}
+		// Export the storage of the account into its own chunks
+		if common.BytesToHash(account.Root) != emptyRoot {
+			storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+			if err != nil {
+				return err
+			}
+			for storageIt.Next() {
+				if err := dw.add(dumpStorageChunk, accountHash, storageIt.Hash(), storageIt.Slot()); err != nil {
+					storageIt.Release()
+					return err
+				}
+				summary.Slots++
+			}
+			err = storageIt.Error()
+			storageIt.Release()
+			if err != nil {
+				return err
+			}
+			if err := dw.flush(dumpStorageChunk); err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting snapshot", "at", accountHash, "accounts", summary.Accounts, "slots", summary.Slots, "codes", summary.Codes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := acctIt.Error(); err != nil {
+		return err
+	}
+	for _, kind := range []uint8{dumpAccountChunk, dumpCodeChunk} {
+		if err := dw.flush(kind); err != nil {
+			return err
+		}
+	}
+	if err := dw.write(dumpEndChunk, &summary); err != nil {
+		return err
+	}
+	log.Info("Exported snapshot", "number", block.Number(), "hash", block.Hash(), "root", root, "accounts", summary.Accounts, "slots", summary.Slots, "codes", summary.Codes, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// Import rebuilds the snapshot disk layer from a snapshot dump, regenerates the
+// state tries from it and verifies the resulting root. The database must contain
+// the genesis of the network but no snapshot yet. Once the state is verified, the
+// block of the dump is written into the canonical chain and becomes the head
+// block. The header of the imported block is returned.
+//
+// On failure all the snapshot data is wiped. The contract codes and trie nodes
+// written until then are keyed by their hashes, they are left behind as garbage
+// and are overwritten by a later import.
+func Import(r io.Reader, db ethdb.Database) (*types.Header, error) {
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		return nil, fmt.Errorf("database already contains the snapshot of %x", root)
+	}
+	if rawdb.ReadCanonicalHash(db, 0) == (common.Hash{}) {
+		return nil, errors.New("database not initialized with a genesis")
+	}
+	// The tries are regenerated keyed by hash, which a path scheme database can't use
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errors.New("snapshot import is not supported in path scheme")
+	}
+	stream := rlp.NewStream(r, 0)
+
+	var header dumpHeader
+	if err := stream.Decode(&header); err != nil {
+		return nil, fmt.Errorf("failed to read snapshot dump header: %v", err)
+	}
+	if header.Magic != dumpMagic {
+		return nil, errors.New("not a snapshot dump")
+	}
+	if header.Version != dumpVersion {
+		return nil, fmt.Errorf("unsupported snapshot dump version %d", header.Version)
+	}
+	if header.Header == nil || header.Body == nil || header.Td == nil {
+		return nil, errors.New("snapshot dump block missing")
+	}
+	block := types.NewBlockWithHeader(header.Header).WithBody(header.Body.Transactions, header.Body.Uncles)
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+		return nil, fmt.Errorf("snapshot dump transaction root mismatch: have %x, want %x", hash, block.TxHash())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return nil, fmt.Errorf("snapshot dump uncle hash mismatch: have %x, want %x", hash, block.UncleHash())
+	}
+	// The block must not conflict with the canonical chain of the database
+	number := block.NumberU64()
+	if hash := rawdb.ReadCanonicalHash(db, number); hash != (common.Hash{}) && hash != block.Hash() {
+		return nil, fmt.Errorf("block #%d [%x] of the snapshot dump conflicts with canonical block %x", number, block.Hash(), hash)
+	}
+	// Import the dump and regenerate the tries, wiping all the snapshot data on
+	// failure so that neither an unverified snapshot is trusted on startup, nor
+	// stale entries pollute a later import.
+	if err := importDump(stream, db, block.Root()); err != nil {
+		rawdb.DeleteSnapshotRoot(db)
+		if werr := wipeContent(db); werr != nil {
+			log.Error("Failed to wipe imported snapshot", "err", werr)
+		}
+		return nil, err
+	}
+	// Write the block into the canonical chain and move the chain head up to the
+	// imported state, unless it's past it already
+	batch := db.NewBatch()
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteTd(batch, block.Hash(), number, header.Td)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), number)
+
+	for _, head := range []struct {
+		read  func(ethdb.KeyValueReader) common.Hash
+		write func(ethdb.KeyValueWriter, common.Hash)
+	}{
+		{rawdb.ReadHeadHeaderHash, rawdb.WriteHeadHeaderHash},
+		{rawdb.ReadHeadFastBlockHash, rawdb.WriteHeadFastBlockHash},
+		{rawdb.ReadHeadBlockHash, rawdb.WriteHeadBlockHash},
+	} {
+		if n := rawdb.ReadHeaderNumber(db, head.read(db)); n == nil || *n < number {
+			head.write(batch, block.Hash())
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+// importDump writes the snapshot items of a dump into the database, marks the
+// snapshot as fully generated and regenerates the state tries from it.
+func importDump(stream *rlp.Stream, db ethdb.Database, root common.Hash) error {
+	var (
+		batch = db.NewBatch()
+		have  dumpSummary
+		want  *dumpSummary
+
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for want == nil {
+		var chunk dumpChunk
+		if err := stream.Decode(&chunk); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF || err == rlp.ErrValueTooLarge {
+				return errDumpTruncated
+			}
+			return err
+		}
+		if crc := crc32.Checksum(chunk.Payload, dumpCRCTable); crc != chunk.Checksum {
+			return fmt.Errorf("snapshot dump chunk checksum mismatch: have %08x, want %08x", crc, chunk.Checksum)
+		}
+		if chunk.Kind == dumpEndChunk {
+			want = new(dumpSummary)
+			if err := rlp.DecodeBytes(chunk.Payload, want); err != nil {
+				return err
+			}
+			continue
+		}
+		var entries dumpEntries
+		if err := rlp.DecodeBytes(chunk.Payload, &entries); err != nil {
+			return err
+		}
+		if len(entries.Keys) != len(entries.Vals) {
+			return fmt.Errorf("invalid snapshot dump chunk: %d keys, %d values", len(entries.Keys), len(entries.Vals))
+		}
+		for i, key := range entries.Keys {
+			switch chunk.Kind {
+			case dumpAccountChunk:
+				rawdb.WriteAccountSnapshot(batch, key, entries.Vals[i])
+				have.Accounts++
+			case dumpStorageChunk:
+				rawdb.WriteStorageSnapshot(batch, entries.Account, key, entries.Vals[i])
+				have.Slots++
+			case dumpCodeChunk:
+				rawdb.WriteCode(batch, key, entries.Vals[i])
+				have.Codes++
+			default:
+				return fmt.Errorf("unknown snapshot dump chunk kind %d", chunk.Kind)
+			}
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing snapshot", "accounts", have.Accounts, "slots", have.Slots, "codes", have.Codes, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if have != *want {
+		return fmt.Errorf("snapshot dump content mismatch: have %d accounts, %d slots, %d codes, want %d, %d, %d",
+			have.Accounts, have.Slots, have.Codes, want.Accounts, want.Slots, want.Codes)
+	}
+	// Mark the disk layer as fully generated, then regenerate the tries from it
+	rawdb.WriteSnapshotRoot(batch, root)
+	journalProgress(batch, nil, nil)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	log.Info("Imported snapshot", "root", root, "accounts", have.Accounts, "slots", have.Slots, "codes", have.Codes, "elapsed", common.PrettyDuration(time.Since(start)))
+
+	snaptree, err := New(db, trie.NewDatabase(db), 256, root, false, false, false)
+	if err != nil {
+		return err
+	}
+	return GenerateTrie(snaptree, root, db, db)
+}
@@ -0,0 +1,217 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that a snapshot exported into a dump can be imported into a database
+// containing only the genesis, rebuilding both the snapshot and the state tries
+// and writing the block of the dump.
+func TestExportImport(t *testing.T) {
+	// We can't use statedb to make a test trie (circular dependency), so make
+	// a fake one manually: three accounts, two of which share a storage trie
+	// and one of which has contract code.
+	var (
+		diskdb = memorydb.New()
+		triedb = trie.NewDatabase(diskdb)
+		code   = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+	)
+	stTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	stTrie.Update([]byte("key-1"), []byte("val-1"))
+	stTrie.Update([]byte("key-2"), []byte("val-2"))
+	stTrie.Commit(nil)
+
+	accTrie, _ := trie.NewSecure(common.Hash{}, triedb)
+	for i, acc := range []*Account{
+		{Balance: big.NewInt(1), Root: stTrie.Hash().Bytes(), CodeHash: crypto.Keccak256(code)},
+		{Balance: big.NewInt(2), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()},
+		{Balance: big.NewInt(3), Root: stTrie.Hash().Bytes(), CodeHash: emptyCode.Bytes()},
+	} {
+		val, _ := rlp.EncodeToBytes(acc)
+		accTrie.Update([]byte{byte(i)}, val)
+	}
+	root, _ := accTrie.Commit(nil)
+	triedb.Commit(root, false, nil)
+	rawdb.WriteCode(diskdb, crypto.Keccak256Hash(code), code)
+
+	snaps, err := New(diskdb, triedb, 16, root, false, true, false)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	var (
+		uncle = &types.Header{Number: big.NewInt(0), Extra: []byte("uncle")}
+		block = types.NewBlock(&types.Header{Number: big.NewInt(1), Root: root}, nil, []*types.Header{uncle}, nil, trie.NewStackTrie(nil))
+		td    = big.NewInt(2)
+		dump  = new(bytes.Buffer)
+	)
+	if err := Export(dump, snaps, block, td, diskdb); err != nil {
+		t.Fatalf("failed to export snapshot: %v", err)
+	}
+	// Importing into a database without a genesis should fail
+	if _, err := Import(bytes.NewReader(dump.Bytes()), rawdb.NewMemoryDatabase()); err == nil {
+		t.Fatal("imported into a database without genesis")
+	}
+	// Import the dump and ensure the block and the whole state are present
+	db := newImportDatabase()
+	imported, err := Import(bytes.NewReader(dump.Bytes()), db)
+	if err != nil {
+		t.Fatalf("failed to import snapshot: %v", err)
+	}
+	if imported.Hash() != block.Hash() {
+		t.Fatalf("imported block mismatch: have %x, want %x", imported.Hash(), block.Hash())
+	}
+	if have := rawdb.ReadHeadBlockHash(db); have != block.Hash() {
+		t.Fatalf("head block mismatch: have %x, want %x", have, block.Hash())
+	}
+	if have := rawdb.ReadCanonicalHash(db, 1); have != block.Hash() {
+		t.Fatalf("canonical hash mismatch: have %x, want %x", have, block.Hash())
+	}
+	if have := rawdb.ReadBlock(db, block.Hash(), 1); have == nil || len(have.Uncles()) != 1 {
+		t.Fatal("imported block body missing")
+	}
+	if have := rawdb.ReadTd(db, block.Hash(), 1); have == nil || have.Cmp(td) != 0 {
+		t.Fatalf("total difficulty mismatch: have %v, want %v", have, td)
+	}
+	if have := rawdb.ReadSnapshotRoot(db); have != root {
+		t.Fatalf("snapshot root mismatch: have %x, want %x", have, root)
+	}
+	if have := rawdb.ReadCode(db, crypto.Keccak256Hash(code)); !bytes.Equal(have, code) {
+		t.Fatalf("code mismatch: have %x, want %x", have, code)
+	}
+	restored, err := trie.NewSecure(stTrie.Hash(), trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open imported storage trie: %v", err)
+	}
+	if val, err := restored.TryGet([]byte("key-2")); err != nil || string(val) != "val-2" {
+		t.Fatalf("imported storage mismatch: have %q, want %q (err %v)", val, "val-2", err)
+	}
+	snaps, err = New(db, trie.NewDatabase(db), 16, root, false, false, false)
+	if err != nil {
+		t.Fatalf("failed to load imported snapshot: %v", err)
+	}
+	if err := snaps.Verify(root); err != nil {
+		t.Fatalf("imported snapshot invalid: %v", err)
+	}
+	// Importing into a database with a snapshot should fail
+	if _, err := Import(bytes.NewReader(dump.Bytes()), db); err == nil {
+		t.Fatal("imported into a database with existing snapshot")
+	}
+	// Importing a block conflicting with the canonical chain should fail
+	db = newImportDatabase()
+	rawdb.WriteCanonicalHash(db, common.Hash{0x1}, 1)
+	if _, err := Import(bytes.NewReader(dump.Bytes()), db); err == nil {
+		t.Fatal("imported block conflicting with the canonical chain")
+	}
+	// Corrupted and truncated dumps should be rejected, leaving no snapshot data,
+	// while a later import should succeed on top of the leftovers
+	corrupt := common.CopyBytes(dump.Bytes())
+	corrupt[len(corrupt)/2] ^= 0xff
+	db = newImportDatabase()
+	if _, err := Import(bytes.NewReader(corrupt), db); err == nil {
+		t.Fatal("imported corrupted dump")
+	}
+	checkWiped(t, db)
+
+	if _, err := Import(bytes.NewReader(dump.Bytes()[:dump.Len()-10]), db); err != errDumpTruncated {
+		t.Fatalf("truncated dump error mismatch: have %v, want %v", err, errDumpTruncated)
+	}
+	checkWiped(t, db)
+
+	if _, err := Import(bytes.NewReader(dump.Bytes()), db); err != nil {
+		t.Fatalf("failed to import snapshot after failed imports: %v", err)
+	}
+
+	// A dump whose content doesn't match its root should fail to regenerate the
+	// tries, leaving no snapshot data and the chain head untouched
+	var header dumpHeader
+	if err := rlp.DecodeBytes(dump.Bytes()[:dumpHeaderSize(t, dump.Bytes())], &header); err != nil {
+		t.Fatalf("failed to decode dump header: %v", err)
+	}
+	header.Header.Root = common.Hash{0x1}
+
+	mismatch, err := rlp.EncodeToBytes(&header)
+	if err != nil {
+		t.Fatalf("failed to encode dump header: %v", err)
+	}
+	mismatch = append(mismatch, dump.Bytes()[dumpHeaderSize(t, dump.Bytes()):]...)
+
+	db = newImportDatabase()
+	if _, err := Import(bytes.NewReader(mismatch), db); err == nil {
+		t.Fatal("imported dump with mismatching root")
+	}
+	checkWiped(t, db)
+	if have := rawdb.ReadCanonicalHash(db, 1); have != (common.Hash{}) {
+		t.Fatalf("block written by failed import: %x", have)
+	}
+	if have := rawdb.ReadHeadBlockHash(db); have != rawdb.ReadCanonicalHash(db, 0) {
+		t.Fatalf("head block moved by failed import: %x", have)
+	}
+}
+
+// newImportDatabase creates a database containing only a genesis block, to
+// import a snapshot dump into.
+func newImportDatabase() ethdb.Database {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0)})
+	)
+	rawdb.WriteBlock(db, genesis)
+	rawdb.WriteCanonicalHash(db, genesis.Hash(), 0)
+	rawdb.WriteHeadHeaderHash(db, genesis.Hash())
+	rawdb.WriteHeadFastBlockHash(db, genesis.Hash())
+	rawdb.WriteHeadBlockHash(db, genesis.Hash())
+	return db
+}
+
+// dumpHeaderSize returns the size of the header at the start of a snapshot dump.
+func dumpHeaderSize(t *testing.T, dump []byte) int {
+	_, _, rest, err := rlp.Split(dump)
+	if err != nil {
+		t.Fatalf("failed to split dump header: %v", err)
+	}
+	return len(dump) - len(rest)
+}
+
+// checkWiped ensures that a failed import left no snapshot data behind.
+func checkWiped(t *testing.T, db ethdb.Database) {
+	t.Helper()
+	if root := rawdb.ReadSnapshotRoot(db); root != (common.Hash{}) {
+		t.Fatalf("snapshot root left behind: %x", root)
+	}
+	for _, prefix := range [][]byte{rawdb.SnapshotAccountPrefix, rawdb.SnapshotStoragePrefix} {
+		it := db.NewIterator(prefix, nil)
+		for it.Next() {
+			if len(it.Key()) == len(prefix)+common.HashLength || len(it.Key()) == len(prefix)+2*common.HashLength {
+				t.Fatalf("snapshot entry left behind: %x", it.Key())
+			}
+		}
+		it.Release()
+	}
+}
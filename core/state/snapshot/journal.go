@@ -228,18 +228,31 @@ func loadSnapshot(diskdb ethdb.KeyValueStore, triedb *trie.Database, cache int,
 // loadDiffLayer reads the next sections of a snapshot journal, reconstructing a new
 // diff and verifying that it can be linked to the requested parent.
 func loadDiffLayer(parent snapshot, r *rlp.Stream) (snapshot, error) {
+	root, destructSet, accountData, storageData, err := readDiffLayer(r)
+	if err != nil {
+		// The first read may fail with EOF, marking the end of the journal
+		if err == io.EOF {
+			return parent, nil
+		}
+		return nil, err
+	}
+	return loadDiffLayer(newDiffLayer(parent, root, destructSet, accountData, storageData), r)
+}
+
+// readDiffLayer decodes the next diff layer from a snapshot journal. If there
+// are no more layers in the journal, io.EOF is returned.
+func readDiffLayer(r *rlp.Stream) (common.Hash, map[common.Hash]struct{}, map[common.Hash][]byte, map[common.Hash]map[common.Hash][]byte, error) {
 	// Read the next diff journal entry
 	var root common.Hash
 	if err := r.Decode(&root); err != nil {
-		// The first read may fail with EOF, marking the end of the journal
 		if err == io.EOF {
-			return parent, nil
+			return common.Hash{}, nil, nil, nil, err
 		}
-		return nil, fmt.Errorf("load diff root: %v", err)
+		return common.Hash{}, nil, nil, nil, fmt.Errorf("load diff root: %v", err)
 	}
 	var destructs []journalDestruct
 	if err := r.Decode(&destructs); err != nil {
-		return nil, fmt.Errorf("load diff destructs: %v", err)
+		return common.Hash{}, nil, nil, nil, fmt.Errorf("load diff destructs: %v", err)
 	}
 	destructSet := make(map[common.Hash]struct{})
 	for _, entry := range destructs {
@@ -247,7 +260,7 @@ func loadDiffLayer(parent snapshot, r *rlp.Stream) (snapshot, error) {
 	}
 	var accounts []journalAccount
 	if err := r.Decode(&accounts); err != nil {
-		return nil, fmt.Errorf("load diff accounts: %v", err)
+		return common.Hash{}, nil, nil, nil, fmt.Errorf("load diff accounts: %v", err)
 	}
 	accountData := make(map[common.Hash][]byte)
 	for _, entry := range accounts {
@@ -259,7 +272,7 @@ func loadDiffLayer(parent snapshot, r *rlp.Stream) (snapshot, error) {
 	}
 	var storage []journalStorage
 	if err := r.Decode(&storage); err != nil {
-		return nil, fmt.Errorf("load diff storage: %v", err)
+		return common.Hash{}, nil, nil, nil, fmt.Errorf("load diff storage: %v", err)
 	}
 	storageData := make(map[common.Hash]map[common.Hash][]byte)
 	for _, entry := range storage {
@@ -273,7 +286,53 @@ func loadDiffLayer(parent snapshot, r *rlp.Stream) (snapshot, error) {
 		}
 		storageData[entry.Hash] = slots
 	}
-	return loadDiffLayer(newDiffLayer(parent, root, destructSet, accountData, storageData), r)
+	return root, destructSet, accountData, storageData, nil
+}
+
+// journalCallback is a function which is invoked by iterateJournal, every
+// time a diff layer is loaded from disk.
+type journalCallback = func(parent common.Hash, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error
+
+// iterateJournal iterates through the journalled diff layers, loading them from
+// the database and invoking the callback for each loaded layer. The order is
+// incremental, starting with the bottom-most diff layer. Journals in an unknown
+// or legacy format are skipped.
+func iterateJournal(db ethdb.KeyValueReader, callback journalCallback) error {
+	journal := rawdb.ReadSnapshotJournal(db)
+	if len(journal) == 0 {
+		log.Warn("Loaded snapshot journal", "diffs", "missing")
+		return nil
+	}
+	r := rlp.NewStream(bytes.NewReader(journal), 0)
+
+	// Firstly, resolve the first element as the journal version
+	version, err := r.Uint()
+	if err != nil {
+		log.Warn("Failed to resolve the journal version", "error", err)
+		return nil
+	}
+	if version != journalVersion {
+		log.Warn("Discarded the snapshot journal with wrong version", "required", journalVersion, "got", version)
+		return nil
+	}
+	// Secondly, resolve the disk layer root, which is the parent of the first diff
+	var parent common.Hash
+	if err := r.Decode(&parent); err != nil {
+		return errors.New("missing disk layer root")
+	}
+	for {
+		root, destructs, accounts, storage, err := readDiffLayer(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := callback(parent, root, destructs, accounts, storage); err != nil {
+			return err
+		}
+		parent = root
+	}
 }
 
 // Journal terminates any in-progress snapshot generation, also implicitly pushing
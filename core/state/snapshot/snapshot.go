@@ -166,6 +166,7 @@ type Tree struct {
 	triedb *trie.Database           // In-memory cache to access the trie through
 	cache  int                      // Megabytes permitted to use for read caches
 	layers map[common.Hash]snapshot // Collection of all known layers
+	pins   map[common.Hash]int      // Roots of the layers pinned by long running iterators
 	lock   sync.RWMutex
 }
 
@@ -327,6 +328,10 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	// If someone's iterating a pinned layer, don't pull it from underneath
+	if len(t.pins) > 0 && layers == 0 {
+		return nil
+	}
 	// Flattening the bottom-most diff layer requires special casing since there's
 	// no child to rewire to the grandparent. In that case we can fake a temporary
 	// child for the capping and then remove it.
@@ -379,6 +384,33 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	return nil
 }
 
+// Pin prevents the layer of the given state root and the ones below it from
+// being flattened or persisted by Cap until the returned release function is
+// called, keeping long running iterators over the state valid. The layers above
+// the pinned one are still capped, but they are accumulated in memory on top
+// of it instead of being persisted, so the number of layers stays bounded.
+func (t *Tree) Pin(root common.Hash) (func(), error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.layers[root] == nil {
+		return nil, fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	if t.pins == nil {
+		t.pins = make(map[common.Hash]int)
+	}
+	t.pins[root]++
+
+	return func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		if t.pins[root]--; t.pins[root] == 0 {
+			delete(t.pins, root)
+		}
+	}, nil
+}
+
 // cap traverses downwards the diff tree until the number of allowed layers are
 // crossed. All diffs beyond the permitted number are flattened downwards. If the
 // layer limit is reached, memory cap is also enforced (but not before).
@@ -391,6 +423,8 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 // survival is only known *after* capping, we need to omit it from the count if
 // we want to ensure that *at least* the requested number of diff layers remain.
 func (t *Tree) cap(diff *diffLayer, layers int) *diskLayer {
+	pinned := t.pinned(diff)
+
 	// Dive until we run out of layers or reach the persistent database
 	for i := 0; i < layers-1; i++ {
 		// If we still have diff layers below, continue down
@@ -401,6 +435,25 @@ func (t *Tree) cap(diff *diffLayer, layers int) *diskLayer {
 			return nil
 		}
 	}
+	// If a layer is pinned, flatten the ones above it into a single layer, but
+	// leave the pinned one and its ancestors untouched
+	if pinned != nil {
+		if t.pinned(diff.parent) != pinned {
+			return nil // The pinned layer is among the retained ones
+		}
+		parent, ok := diff.parent.(*diffLayer)
+		if !ok || snapshot(parent) == pinned {
+			return nil
+		}
+		flattened := parent.flattenTo(pinned).(*diffLayer)
+		t.layers[flattened.root] = flattened
+
+		diff.lock.Lock()
+		defer diff.lock.Unlock()
+
+		diff.parent = flattened
+		return nil
+	}
 	// We're out of layers, flatten anything below, stopping if it's the disk or if
 	// the memory limit is not yet exceeded.
 	switch parent := diff.parent.(type) {
@@ -441,6 +494,24 @@ func (t *Tree) cap(diff *diffLayer, layers int) *diskLayer {
 	return base
 }
 
+// pinned returns the topmost pinned layer among the given layer and the ones
+// below it, or nil if none is pinned.
+func (t *Tree) pinned(layer snapshot) snapshot {
+	if len(t.pins) == 0 {
+		return nil
+	}
+	for {
+		if t.pins[layer.Root()] > 0 {
+			return layer
+		}
+		diff, ok := layer.(*diffLayer)
+		if !ok {
+			return nil
+		}
+		layer = diff.parent
+	}
+}
+
 // diffToDisk merges a bottom-most diff into the persistent disk layer underneath
 // it. The method will panic if called onto a non-bottom-most diff layer.
 //
@@ -324,6 +324,83 @@ func TestPostCapBasicDataAccess(t *testing.T) {
 	}
 }
 
+// Tests that capping the tree doesn't flatten a pinned layer, accumulating the
+// layers above it instead, until the pin is released.
+func TestPinnedCap(t *testing.T) {
+	setAccount := func(accKey string) map[common.Hash][]byte {
+		return map[common.Hash][]byte{
+			common.HexToHash(accKey): randomAccount(),
+		}
+	}
+	// Create a starting base layer and a snapshot tree out of it
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	parent := base.root
+	for i := 1; i <= 6; i++ {
+		root := common.HexToHash(fmt.Sprintf("0xa%d", i))
+		snaps.Update(root, parent, nil, setAccount(fmt.Sprintf("0xa%d", i)), nil)
+		parent = root
+	}
+	if _, err := snaps.Pin(common.HexToHash("0x1337")); err == nil {
+		t.Fatal("expected error pinning a missing layer, got none")
+	}
+	release, err := snaps.Pin(common.HexToHash("0xa2"))
+	if err != nil {
+		t.Fatalf("failed to pin layer: %v", err)
+	}
+	pinned := snaps.Snapshot(common.HexToHash("0xa2")).(*diffLayer)
+
+	// Capping to a single layer should keep the pinned one, flattening everything
+	// between it and the retained layer
+	if err := snaps.Cap(common.HexToHash("0xa6"), 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if pinned.Stale() {
+		t.Fatal("pinned layer went stale")
+	}
+	it, err := snaps.AccountIterator(common.HexToHash("0xa2"), common.Hash{})
+	if err != nil {
+		t.Fatalf("failed to iterate pinned layer: %v", err)
+	}
+	verifyIterator(t, 2, it, verifyAccount)
+	it.Release()
+
+	top := snaps.Snapshot(common.HexToHash("0xa6")).(*diffLayer)
+	if have, want := top.Parent().Root(), common.HexToHash("0xa5"); have != want {
+		t.Fatalf("accumulator root mismatch: have %x, want %x", have, want)
+	}
+	if have := top.Parent().Parent(); have != snapshot(pinned) {
+		t.Fatalf("accumulator parent mismatch: have %x, want %x", have.Root(), pinned.Root())
+	}
+	for i := 1; i <= 6; i++ {
+		if data, err := top.Account(common.HexToHash(fmt.Sprintf("0xa%d", i))); err != nil || data == nil {
+			t.Errorf("account %d missing after cap: %v", i, err)
+		}
+	}
+	if n := len(snaps.layers); n != 5 {
+		t.Fatalf("layer count mismatch: have %d, want 5", n)
+	}
+	// Releasing the pin should allow flattening the whole tree again
+	release()
+	if err := snaps.Cap(common.HexToHash("0xa6"), 1); err != nil {
+		t.Fatalf("failed to cap tree: %v", err)
+	}
+	if snaps.Snapshot(common.HexToHash("0xa2")) != nil {
+		t.Fatal("released layer not flattened")
+	}
+	if n := len(snaps.layers); n != 3 {
+		t.Fatalf("layer count mismatch: have %d, want 3", n)
+	}
+}
+
 // TestSnaphots tests the functionality for retrieveing the snapshot
 // with given head root and the desired depth.
 func TestSnaphots(t *testing.T) {
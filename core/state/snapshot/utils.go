@@ -0,0 +1,113 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// CheckDanglingStorage iterates the snapshot storage data, and verifies that all
+// storage also has corresponding account data, both in the disk layer and in
+// the journalled diff layers.
+func CheckDanglingStorage(chaindb ethdb.KeyValueStore) error {
+	dangling, err := checkDanglingDiskStorage(chaindb)
+	if err != nil {
+		return err
+	}
+	danglingMem, err := checkDanglingMemStorage(chaindb)
+	if err != nil {
+		return err
+	}
+	if dangling += danglingMem; dangling > 0 {
+		return fmt.Errorf("found %d dangling storage snapshots", dangling)
+	}
+	return nil
+}
+
+// checkDanglingDiskStorage checks if there is any storage data in the disk layer
+// whose account is missing, returning the number of such accounts.
+func checkDanglingDiskStorage(chaindb ethdb.KeyValueStore) (int, error) {
+	var (
+		lastReport = time.Now()
+		start      = time.Now()
+		lastKey    []byte
+		dangling   int
+		it         = chaindb.NewIterator(rawdb.SnapshotStoragePrefix, nil)
+	)
+	log.Info("Checking dangling snapshot disk storage")
+
+	defer it.Release()
+	for it.Next() {
+		k := it.Key()
+		if len(k) != len(rawdb.SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		accKey := k[len(rawdb.SnapshotStoragePrefix) : len(rawdb.SnapshotStoragePrefix)+common.HashLength]
+		if bytes.Equal(accKey, lastKey) {
+			// No need to look up for every slot
+			continue
+		}
+		lastKey = common.CopyBytes(accKey)
+		if time.Since(lastReport) > time.Second*8 {
+			log.Info("Iterating snapshot storage", "at", fmt.Sprintf("%#x", accKey), "elapsed", common.PrettyDuration(time.Since(start)))
+			lastReport = time.Now()
+		}
+		if data := rawdb.ReadAccountSnapshot(chaindb, common.BytesToHash(accKey)); len(data) == 0 {
+			log.Warn("Dangling storage - missing account", "account", fmt.Sprintf("%#x", accKey), "storagekey", fmt.Sprintf("%#x", k))
+			dangling++
+		}
+	}
+	if err := it.Error(); err != nil {
+		return dangling, err
+	}
+	log.Info("Verified the snapshot disk storage", "dangling", dangling, "time", common.PrettyDuration(time.Since(start)))
+	return dangling, nil
+}
+
+// checkDanglingMemStorage checks if there is any storage data in the journalled
+// diff layers whose account is missing from the same layer, returning the number
+// of such accounts.
+func checkDanglingMemStorage(db ethdb.KeyValueStore) (int, error) {
+	var (
+		start    = time.Now()
+		dangling int
+	)
+	log.Info("Checking dangling journalled storage")
+
+	err := iterateJournal(db, func(pRoot, root common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
+		for accHash := range storage {
+			if _, ok := accounts[accHash]; !ok {
+				log.Warn("Dangling storage - missing account", "account", fmt.Sprintf("%#x", accHash), "root", root)
+				dangling++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Info("Failed to resolve snapshot journal", "err", err)
+		return dangling, err
+	}
+	log.Info("Verified the snapshot journalled storage", "dangling", dangling, "time", common.PrettyDuration(time.Since(start)))
+	return dangling, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that storage snapshots without a corresponding account are detected,
+// both in the disk layer and in the journalled diff layers.
+func TestCheckDanglingStorage(t *testing.T) {
+	var (
+		accA = common.HexToHash("0xa1")
+		accB = common.HexToHash("0xb1")
+		accC = common.HexToHash("0xc1")
+		slot = common.HexToHash("0x01")
+	)
+	// A consistent disk layer should pass the check
+	db := memorydb.New()
+	rawdb.WriteAccountSnapshot(db, accA, accA[:])
+	rawdb.WriteStorageSnapshot(db, accA, slot, slot[:])
+	if err := CheckDanglingStorage(db); err != nil {
+		t.Fatalf("consistent disk layer reported dangling: %v", err)
+	}
+	// Storage without an account on disk should be reported
+	rawdb.WriteStorageSnapshot(db, accB, slot, slot[:])
+	if n, err := checkDanglingDiskStorage(db); err != nil || n != 1 {
+		t.Fatalf("dangling disk storage mismatch: have %d, want %d (err %v)", n, 1, err)
+	}
+	if err := CheckDanglingStorage(db); err == nil {
+		t.Fatal("dangling disk storage not reported")
+	}
+	rawdb.DeleteStorageSnapshot(db, accB, slot)
+
+	// Storage without an account in a journalled diff layer should be reported
+	journal := new(bytes.Buffer)
+	for _, item := range []interface{}{
+		journalVersion,
+		common.HexToHash("0x01"), // disk layer root
+		common.HexToHash("0x02"), // diff layer root
+		[]journalDestruct{},
+		[]journalAccount{{Hash: accA, Blob: accA[:]}},
+		[]journalStorage{
+			{Hash: accA, Keys: []common.Hash{slot}, Vals: [][]byte{slot[:]}},
+			{Hash: accC, Keys: []common.Hash{slot}, Vals: [][]byte{slot[:]}},
+		},
+	} {
+		if err := rlp.Encode(journal, item); err != nil {
+			t.Fatalf("failed to encode journal: %v", err)
+		}
+	}
+	rawdb.WriteSnapshotJournal(db, journal.Bytes())
+	if n, err := checkDanglingMemStorage(db); err != nil || n != 1 {
+		t.Fatalf("dangling journal storage mismatch: have %d, want %d (err %v)", n, 1, err)
+	}
+	if err := CheckDanglingStorage(db); err == nil {
+		t.Fatal("dangling journal storage not reported")
+	}
+}
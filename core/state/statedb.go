@@ -125,6 +125,26 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 	if err != nil {
 		return nil, err
 	}
+	return newStateDB(root, db, snaps, tr), nil
+}
+
+// NewFromSnapshot creates a new state for reading from a given trie. If the trie
+// is not available anymore but the state is still covered by the snapshots, the
+// state is served from the snapshot alone, failing any access which would need
+// the trie, including iterating and committing it.
+func NewFromSnapshot(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error) {
+	tr, err := db.OpenTrie(root)
+	if err != nil {
+		if snaps == nil || snaps.Snapshot(root) == nil {
+			return nil, err
+		}
+		tr = &missingTrie{root: root, err: err}
+	}
+	return newStateDB(root, db, snaps, tr), nil
+}
+
+// newStateDB creates a new state on top of the given account trie.
+func newStateDB(root common.Hash, db Database, snaps *snapshot.Tree, tr Trie) *StateDB {
 	sdb := &StateDB{
 		db:                  db,
 		trie:                tr,
@@ -146,7 +166,7 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 			sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
 		}
 	}
-	return sdb, nil
+	return sdb
 }
 
 // StartPrefetcher initializes a new trie prefetcher to pull in nodes from the
@@ -157,7 +177,9 @@ func (s *StateDB) StartPrefetcher(namespace string) {
 		s.prefetcher.close()
 		s.prefetcher = nil
 	}
-	if s.snap != nil {
+	// The prefetcher opens the storage tries by root alone, which can't locate
+	// the nodes in the path scheme.
+	if s.snap != nil && s.db.TrieDB().Scheme() != rawdb.PathScheme {
 		s.prefetcher = newTriePrefetcher(s.db, s.originalRoot, namespace)
 	}
 }
@@ -598,6 +620,7 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 	}
 	newobj = newObject(s, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
+	newobj.recreated = prev != nil
 	if prev == nil {
 		s.journal.append(createObjectChange{account: &addr})
 	} else {
@@ -918,18 +941,34 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	s.IntermediateRoot(deleteEmptyObjects)
 
 	// Commit objects to the trie, measuring the elapsed time
-	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	var (
+		codeWriter = s.db.TrieDB().DiskDB().NewBatch()
+		nodes      = trie.NewMergedNodeSet()
+	)
 	for addr := range s.stateObjectsDirty {
-		if obj := s.stateObjects[addr]; !obj.deleted {
+		obj := s.stateObjects[addr]
+		if obj.deleted || obj.recreated {
+			// Wipe the storage of the deleted or replaced accounts in the path
+			// scheme, it's not reachable via the storage tries anymore
+			nodes.Destruct(obj.addrHash)
+			obj.recreated = false
+		}
+		if !obj.deleted {
 			// Write any contract code associated with the state object
 			if obj.code != nil && obj.dirtyCode {
 				rawdb.WriteCode(codeWriter, common.BytesToHash(obj.CodeHash()), obj.code)
 				obj.dirtyCode = false
 			}
 			// Write any storage changes in the state object to its storage trie
-			if err := obj.CommitTrie(s.db); err != nil {
+			set, err := obj.CommitTrie(s.db)
+			if err != nil {
 				return common.Hash{}, err
 			}
+			if set != nil {
+				if err := nodes.Merge(set); err != nil {
+					return common.Hash{}, err
+				}
+			}
 		}
 	}
 	if len(s.stateObjectsDirty) > 0 {
@@ -960,6 +999,21 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	if metrics.EnabledExpensive {
 		s.AccountCommits += time.Since(start)
 	}
+	// Add the changed trie nodes as a new layer on top of the parent state if
+	// they are stored in the path scheme
+	if set := s.trie.CommittedNodes(); set != nil && err == nil {
+		if err := nodes.Merge(set); err != nil {
+			return common.Hash{}, err
+		}
+		parent := s.originalRoot
+		if parent == (common.Hash{}) {
+			parent = emptyRoot
+		}
+		if err := s.db.TrieDB().Update(root, parent, nodes); err != nil {
+			return common.Hash{}, err
+		}
+		s.originalRoot = root
+	}
 	// If snapshotting is enabled, update the snapshot tree with this new version
 	if s.snap != nil {
 		if metrics.EnabledExpensive {
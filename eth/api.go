@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -154,6 +155,21 @@ func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return api.e.miner.HashRate()
 }
 
+// SendBundle submits a bundle of signed, binary encoded transactions to be
+// included atomically, in the given order, at the top of the block with the
+// given number. The bundle is discarded if any of its transactions fails.
+func (api *PrivateMinerAPI) SendBundle(encodedTxs []hexutil.Bytes, blockNumber hexutil.Uint64) (common.Hash, error) {
+	txs := make(types.Transactions, len(encodedTxs))
+	for i, encodedTx := range encodedTxs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(encodedTx); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid transaction #%d: %v", i, err)
+		}
+		txs[i] = tx
+	}
+	return api.e.Miner().AddBundle(txs, uint64(blockNumber))
+}
+
 // PrivateAdminAPI is the collection of Ethereum full node-related APIs
 // exposed over the private admin endpoint.
 type PrivateAdminAPI struct {
@@ -298,7 +314,11 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 	if err != nil {
 		return state.Dump{}, err
 	}
-	return stateDb.RawDump(false, false, true), nil
+	dump := stateDb.RawDump(false, false, true)
+	if err := stateDb.Error(); err != nil {
+		return state.Dump{}, err
+	}
+	return dump, nil
 }
 
 // PrivateDebugAPI is the collection of Ethereum full node APIs exposed over
@@ -403,7 +423,11 @@ func (api *PublicDebugAPI) AccountRange(blockNrOrHash rpc.BlockNumberOrHash, sta
 	if maxResults > AccountRangeMaxResults || maxResults <= 0 {
 		maxResults = AccountRangeMaxResults
 	}
-	return stateDb.IteratorDump(nocode, nostorage, incompletes, start, maxResults), nil
+	dump := stateDb.IteratorDump(nocode, nostorage, incompletes, start, maxResults)
+	if err := stateDb.Error(); err != nil {
+		return state.IteratorDump{}, err
+	}
+	return dump, nil
 }
 
 // StorageRangeResult is the result of a debug_storageRangeAt API call.
@@ -543,3 +567,34 @@ func (api *PrivateDebugAPI) getModifiedAccounts(startBlock, endBlock *types.Bloc
 	}
 	return dirty, nil
 }
+
+// PruneState starts deleting the stale state in the background, retaining the
+// state of the given root (the current head if omitted), the recent states and
+// the genesis. The node keeps processing blocks while pruning.
+func (api *PrivateDebugAPI) PruneState(root *common.Hash, bloomSize *uint64) error {
+	if !api.eth.Synced() {
+		return errors.New("state pruning is not supported while syncing")
+	}
+	var target common.Hash
+	if root != nil {
+		target = *root
+	}
+	config := pruner.OnlineConfig{
+		BloomSize: pruner.DefaultOnlineBloomSize,
+		Throttle:  pruner.DefaultOnlineThrottle,
+	}
+	if bloomSize != nil {
+		config.BloomSize = *bloomSize
+	}
+	return api.eth.blockchain.PruneState(target, config)
+}
+
+// StatePruningStatus returns the progress of the current or last state pruning
+// started via PruneState.
+func (api *PrivateDebugAPI) StatePruningStatus() (*core.StatePruningStatus, error) {
+	status := api.eth.blockchain.PruningStatus()
+	if status == nil {
+		return nil, errors.New("no state pruning started")
+	}
+	return status, nil
+}
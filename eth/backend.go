@@ -82,6 +82,9 @@ type Ethereum struct {
 	bloomIndexer      *core.ChainIndexer             // Bloom indexer operating during block imports
 	closeBloomHandler chan struct{}
 
+	logIndexDb ethdb.Database     // Log index database, nil if the log index is disabled
+	logIndexer *core.ChainIndexer // Log indexer operating during block imports
+
 	APIBackend *EthAPIBackend
 
 	miner     *miner.Miner
@@ -126,6 +129,20 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	scheme, err := core.SetupStateScheme(chainDb, config.StateScheme)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == rawdb.PathScheme {
+		if config.SyncMode != downloader.FullSync {
+			return nil, errors.New("path state scheme requires full sync")
+		}
+		if config.NoPruning {
+			return nil, errors.New("path state scheme doesn't support archive mode")
+		}
+	}
+	log.Info("Initialised state scheme", "scheme", scheme)
+
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideBerlin)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -195,6 +212,14 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
+	if config.LogIndex {
+		if eth.logIndexDb, err = stack.OpenDatabase("logindex", 0, 0, "eth/db/logindex/"); err != nil {
+			return nil, err
+		}
+		eth.logIndexer = core.NewLogIndexer(chainDb, eth.logIndexDb, params.LogIndexBlocks, params.LogIndexConfirms)
+		eth.logIndexer.Start(eth.blockchain)
+	}
+
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
@@ -542,6 +567,10 @@ func (s *Ethereum) Stop() error {
 	// Then stop everything else.
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
+	if s.logIndexer != nil {
+		s.logIndexer.Close()
+		s.logIndexDb.Close()
+	}
 	s.txPool.Stop()
 	s.miner.Stop()
 	s.blockchain.Stop()
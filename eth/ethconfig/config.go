@@ -129,8 +129,12 @@ type Config struct {
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
+	StateScheme string `toml:",omitempty"` // Scheme to store the state trie nodes in, only applies to new databases
+
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
+	LogIndex bool `toml:",omitempty"` // Whether to maintain an index of the logs by address and topic
+
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
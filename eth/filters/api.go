@@ -31,9 +31,14 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// maxReplayBlocks is the maximum number of blocks a log subscription may replay,
+// both when walking back abandoned blocks and when retrieving canonical ones.
+const maxReplayBlocks = 10000
+
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -111,8 +116,8 @@ func (api *PublicFilterAPI) timeoutLoop(timeout time.Duration) {
 // https://eth.wiki/json-rpc/API#eth_newpendingtransactionfilter
 func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	var (
-		pendingTxs   = make(chan []common.Hash)
-		pendingTxSub = api.events.SubscribePendingTxs(pendingTxs)
+		pendingTxs   = make(chan []*types.Transaction)
+		pendingTxSub = api.events.SubscribePendingTxs(nil, pendingTxs)
 	)
 
 	api.filtersMu.Lock()
@@ -122,10 +127,12 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 	go func() {
 		for {
 			select {
-			case ph := <-pendingTxs:
+			case txs := <-pendingTxs:
 				api.filtersMu.Lock()
 				if f, found := api.filters[pendingTxSub.ID]; found {
-					f.hashes = append(f.hashes, ph...)
+					for _, tx := range txs {
+						f.hashes = append(f.hashes, tx.Hash())
+					}
 				}
 				api.filtersMu.Unlock()
 			case <-pendingTxSub.Err():
@@ -142,25 +149,39 @@ func (api *PublicFilterAPI) NewPendingTransactionFilter() rpc.ID {
 
 // NewPendingTransactions creates a subscription that is triggered each time a transaction
 // enters the transaction pool and was signed from one of the transactions this nodes manages.
-func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Subscription, error) {
+//
+// By default only the transaction hashes are sent, if fullTx is true the full
+// transactions are sent instead. The optional criteria restrict the subscription
+// to the transactions matching their sender, recipient and method selector.
+func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context, fullTx *bool, crit *TransactionCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
-
+	if crit != nil {
+		for _, selector := range crit.Selectors {
+			if len(selector) != 4 {
+				return nil, fmt.Errorf("invalid method selector %#x: want 4 bytes", []byte(selector))
+			}
+		}
+	}
 	rpcSub := notifier.CreateSubscription()
 
 	go func() {
-		txHashes := make(chan []common.Hash, 128)
-		pendingTxSub := api.events.SubscribePendingTxs(txHashes)
+		pendingTxs := make(chan []*types.Transaction, 128)
+		pendingTxSub := api.events.SubscribePendingTxs(crit, pendingTxs)
 
 		for {
 			select {
-			case hashes := <-txHashes:
-				// To keep the original behaviour, send a single tx hash in one notification.
-				// TODO(rjl493456442) Send a batch of tx hashes in one notification
-				for _, h := range hashes {
-					notifier.Notify(rpcSub.ID, h)
+			case txs := <-pendingTxs:
+				// To keep the original behaviour, send a single tx in one notification.
+				// TODO(rjl493456442) Send a batch of txs in one notification
+				for _, tx := range txs {
+					if fullTx != nil && *fullTx {
+						notifier.Notify(rpcSub.ID, ethapi.NewRPCPendingTransaction(tx))
+					} else {
+						notifier.Notify(rpcSub.ID, tx.Hash())
+					}
 				}
 			case <-rpcSub.Err():
 				pendingTxSub.Unsubscribe()
@@ -241,7 +262,15 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 }
 
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
-func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+//
+// If the criteria start at a past block, the matching logs since that block are
+// replayed before the live ones. Alternatively, a client resuming a dropped
+// subscription may pass the hash of the last block it processed as the resume
+// cursor. The logs of the blocks it processed that are no longer canonical are
+// then sent again with the removed flag set, followed by the logs of the
+// canonical blocks after the last common one. At most maxReplayBlocks blocks
+// are replayed either way.
+func (api *PublicFilterAPI) Logs(ctx context.Context, crit LogsCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
@@ -250,15 +279,69 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	var (
 		rpcSub      = notifier.CreateSubscription()
 		matchedLogs = make(chan []*types.Log)
+		replay      = crit.ResumeFrom != nil || (crit.FromBlock != nil && crit.FromBlock.Sign() >= 0)
 	)
-
-	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(crit), matchedLogs)
+	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(crit.FilterCriteria), matchedLogs)
 	if err != nil {
 		return nil, err
 	}
-
+	// Retrieve the historical logs, queueing up the live ones meanwhile to not
+	// block the event system
+	var (
+		history []*types.Log
+		queued  [][]*types.Log
+	)
+	if replay {
+		var (
+			stop    = make(chan struct{})
+			stopped = make(chan struct{})
+		)
+		go func() {
+			defer close(stopped)
+			for {
+				select {
+				case logs := <-matchedLogs:
+					queued = append(queued, logs)
+				case <-stop:
+					return
+				}
+			}
+		}()
+		history, err = api.replayLogs(ctx, crit)
+		close(stop)
+		<-stopped
+
+		if err != nil {
+			logsSub.Unsubscribe()
+			return nil, err
+		}
+	}
 	go func() {
-
+		// Deliver the historical logs and the ones queued up in the meantime.
+		// The queued logs may overlap with the replayed ones, so they are only
+		// delivered if new, and removed ones only if delivered before.
+		delivered := make(map[common.Hash]bool)
+		for _, log := range history {
+			if !log.Removed {
+				delivered[log.BlockHash] = true
+			}
+			notifier.Notify(rpcSub.ID, log)
+		}
+		for _, logs := range queued {
+			// A batch may contain multiple logs of a block, so the delivery
+			// status is only updated after the whole batch
+			updated := make(map[common.Hash]bool)
+			for _, log := range logs {
+				if log.Removed != delivered[log.BlockHash] {
+					continue // Removed logs of undelivered or new logs of delivered blocks
+				}
+				updated[log.BlockHash] = !log.Removed
+				notifier.Notify(rpcSub.ID, log)
+			}
+			for hash, status := range updated {
+				delivered[hash] = status
+			}
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
@@ -278,6 +361,86 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// replayLogs retrieves the historical logs matching the criteria of a log
+// subscription, up to the current head block.
+func (api *PublicFilterAPI) replayLogs(ctx context.Context, crit LogsCriteria) ([]*types.Log, error) {
+	head, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil {
+		if err == nil {
+			err = errors.New("head block not found")
+		}
+		return nil, err
+	}
+	var (
+		logs []*types.Log
+		from int64
+	)
+	if crit.ResumeFrom != nil {
+		// Walk back the blocks seen by the client until reaching the canonical
+		// chain, marking the logs of the abandoned blocks removed
+		for hash, depth := *crit.ResumeFrom, 0; ; depth++ {
+			header, err := api.backend.HeaderByHash(ctx, hash)
+			if header == nil {
+				if err == nil {
+					err = fmt.Errorf("unknown block %x", hash)
+				}
+				return nil, err
+			}
+			canon, _ := api.backend.HeaderByNumber(ctx, rpc.BlockNumber(header.Number.Int64()))
+			if canon != nil && canon.Hash() == hash {
+				from = header.Number.Int64() + 1
+				break
+			}
+			if depth == maxReplayBlocks {
+				return nil, fmt.Errorf("resumed block %x more than %d blocks off the canonical chain", *crit.ResumeFrom, maxReplayBlocks)
+			}
+			receipts, err := api.backend.GetLogs(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+			var unfiltered []*types.Log
+			for _, logs := range receipts {
+				unfiltered = append(unfiltered, logs...)
+			}
+			matched := filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics)
+			for i := len(matched) - 1; i >= 0; i-- {
+				removed := *matched[i]
+				removed.Removed = true
+				logs = append(logs, &removed)
+			}
+			hash = header.ParentHash
+		}
+	} else {
+		from = crit.FromBlock.Int64()
+	}
+	// Retrieve the logs of the canonical blocks up to the head, the later ones
+	// are delivered live
+	to := head.Number.Int64()
+	if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Int64() < to {
+		to = crit.ToBlock.Int64()
+	}
+	if from > to {
+		return logs, nil
+	}
+	if to-from >= maxReplayBlocks {
+		return nil, fmt.Errorf("log replay range of %d blocks exceeds the limit of %d", to-from+1, maxReplayBlocks)
+	}
+	matched, err := NewRangeFilter(api.backend, from, to, crit.Addresses, crit.Topics).Logs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(logs, matched...), nil
+}
+
+// TransactionCriteria represents the restrictions of a pending transaction
+// subscription. A transaction matches if it matches all of the non-empty
+// fields, and a field matches if any of its values match.
+type TransactionCriteria struct {
+	From      []common.Address `json:"from"`     // Senders of the transactions
+	To        []common.Address `json:"to"`       // Recipients of the transactions, never matching contract creations
+	Selectors []hexutil.Bytes  `json:"selector"` // Method selectors prefixing the call data
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria ethereum.FilterQuery
@@ -463,6 +626,35 @@ func returnLogs(logs []*types.Log) []*types.Log {
 	return logs
 }
 
+// LogsCriteria represents the criteria of a log subscription. On top of the
+// filter criteria, a client resuming a dropped subscription may pass the hash
+// of the last block it processed as the resume cursor.
+type LogsCriteria struct {
+	FilterCriteria
+	ResumeFrom *common.Hash
+}
+
+// UnmarshalJSON sets *args fields with given data.
+func (args *LogsCriteria) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ResumeFrom *common.Hash `json:"resumeFrom"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := args.FilterCriteria.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	if raw.ResumeFrom != nil {
+		if args.BlockHash != nil || args.FromBlock != nil {
+			// The resume cursor is mutually exclusive with the starting criteria
+			return fmt.Errorf("cannot specify both ResumeFrom and BlockHash/FromBlock, choose one or the other")
+		}
+		args.ResumeFrom = raw.ResumeFrom
+	}
+	return nil
+}
+
 // UnmarshalJSON sets *args fields with given data.
 func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
 	type input struct {
@@ -17,16 +17,21 @@
 package filters
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
@@ -45,6 +50,9 @@ type Backend interface {
 
 	BloomStatus() (uint64, uint64)
 	ServiceFilter(ctx context.Context, session *bloombits.MatcherSession)
+
+	LogIndexStatus() (uint64, uint64)
+	LogIndexLookup(ctx context.Context, section uint64, term []byte) ([]core.LogPosition, error)
 }
 
 // Filter can be used to retrieve and filter logs.
@@ -126,6 +134,9 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 		if header == nil {
 			return nil, errors.New("unknown block")
 		}
+		if err := ethapi.CheckHistoryPruned(f.db, header.Number.Uint64()); err != nil {
+			return nil, err
+		}
 		return f.blockLogs(ctx, header)
 	}
 	// Figure out the limits of the filter range
@@ -142,27 +153,146 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	if f.end == -1 {
 		end = head
 	}
-	// Gather all indexed logs, and finish with non indexed ones
+	// Reject ranges reaching into pruned history, their logs are gone
+	if uint64(f.begin) <= end {
+		if err := ethapi.CheckHistoryPruned(f.db, uint64(f.begin)); err != nil {
+			return nil, err
+		}
+	}
+	// Gather all logs covered by the log index, then the bloom indexed ones, and
+	// finish with non indexed ones
 	var (
 		logs []*types.Log
 		err  error
 	)
-	size, sections := f.backend.BloomStatus()
-	if indexed := sections * size; indexed > uint64(f.begin) {
+	size, sections := f.backend.LogIndexStatus()
+	if indexed := sections * size; indexed > uint64(f.begin) && (len(f.addresses) > 0 || len(f.topics) > 0) {
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			logs, err = f.logIndexLogs(ctx, end)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			logs, err = f.logIndexLogs(ctx, indexed-1)
 		}
 		if err != nil {
 			return logs, err
 		}
 	}
+	size, sections = f.backend.BloomStatus()
+	if indexed := sections * size; indexed > uint64(f.begin) && uint64(f.begin) <= end {
+		var found []*types.Log
+		if indexed > end {
+			found, err = f.indexedLogs(ctx, end)
+		} else {
+			found, err = f.indexedLogs(ctx, indexed-1)
+		}
+		logs = append(logs, found...)
+		if err != nil {
+			return logs, err
+		}
+	}
 	rest, err := f.unindexedLogs(ctx, end)
 	logs = append(logs, rest...)
 	return logs, err
 }
 
+// logIndexLogs returns the logs matching the filter criteria based on the log
+// index. Only the blocks containing matching logs are retrieved.
+func (f *Filter) logIndexLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	var (
+		logs    []*types.Log
+		size, _ = f.backend.LogIndexStatus()
+	)
+	for section := uint64(f.begin) / size; section <= end/size; section++ {
+		positions, err := f.logIndexPositions(ctx, section)
+		if err != nil {
+			return logs, err
+		}
+		for _, pos := range positions {
+			// Skip the positions out of range and the further logs of processed blocks
+			if pos.Block < uint64(f.begin) || pos.Block > end {
+				continue
+			}
+			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(pos.Block))
+			if err != nil {
+				return logs, err
+			}
+			if header == nil {
+				return logs, fmt.Errorf("header #%d missing", pos.Block)
+			}
+			found, err := f.checkMatches(ctx, header)
+			if err != nil {
+				return logs, err
+			}
+			logs = append(logs, found...)
+			f.begin = int64(pos.Block) + 1
+		}
+		if next := (section + 1) * size; next <= end {
+			f.begin = int64(next)
+		} else {
+			f.begin = int64(end) + 1
+		}
+		select {
+		case <-ctx.Done():
+			return logs, ctx.Err()
+		default:
+		}
+	}
+	return logs, nil
+}
+
+// logIndexPositions returns the positions of the logs in the given section that
+// match the filter criteria, sorted by their position in the chain. A log must
+// match any address and any topic at each position with topics.
+func (f *Filter) logIndexPositions(ctx context.Context, section uint64) ([]core.LogPosition, error) {
+	var clauses [][][]byte
+	if len(f.addresses) > 0 {
+		clause := make([][]byte, len(f.addresses))
+		for i, addr := range f.addresses {
+			clause[i] = core.LogAddressTerm(addr)
+		}
+		clauses = append(clauses, clause)
+	}
+	for i, topics := range f.topics {
+		if len(topics) == 0 {
+			continue // empty rule set == wildcard
+		}
+		clause := make([][]byte, len(topics))
+		for j, topic := range topics {
+			clause[j] = core.LogTopicTerm(i, topic)
+		}
+		clauses = append(clauses, clause)
+	}
+	var matches map[core.LogPosition]struct{}
+	for i, clause := range clauses {
+		union := make(map[core.LogPosition]struct{})
+		for _, term := range clause {
+			positions, err := f.backend.LogIndexLookup(ctx, section, term)
+			if err != nil {
+				return nil, err
+			}
+			for _, pos := range positions {
+				if _, ok := matches[pos]; i == 0 || ok {
+					union[pos] = struct{}{}
+				}
+			}
+		}
+		if len(union) == 0 {
+			return nil, nil
+		}
+		matches = union
+	}
+	positions := make([]core.LogPosition, 0, len(matches))
+	for pos := range matches {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Block != positions[j].Block {
+			return positions[i].Block < positions[j].Block
+		}
+		return positions[i].Index < positions[j].Index
+	})
+	return positions, nil
+}
+
 // indexedLogs returns the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
 func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
@@ -318,6 +448,46 @@ Logs:
 	return ret
 }
 
+// filterTxs creates a slice of transactions matching the given criteria.
+func filterTxs(txs []*types.Transaction, crit *TransactionCriteria) []*types.Transaction {
+	var ret []*types.Transaction
+	for _, tx := range txs {
+		if len(crit.To) > 0 && (tx.To() == nil || !includes(crit.To, *tx.To())) {
+			continue
+		}
+		if len(crit.Selectors) > 0 {
+			data := tx.Data()
+			if len(data) < 4 || !includesSelector(crit.Selectors, data[:4]) {
+				continue
+			}
+		}
+		// Recover the sender last, it's the most expensive check. The same
+		// signer is used as for the RPC representation of the transaction.
+		if len(crit.From) > 0 {
+			var signer types.Signer = types.HomesteadSigner{}
+			if tx.Protected() {
+				signer = types.LatestSignerForChainID(tx.ChainId())
+			}
+			from, err := types.Sender(signer, tx)
+			if err != nil || !includes(crit.From, from) {
+				continue
+			}
+		}
+		ret = append(ret, tx)
+	}
+	return ret
+}
+
+// includesSelector reports whether the given method selector is in the list.
+func includesSelector(selectors []hexutil.Bytes, selector []byte) bool {
+	for _, sel := range selectors {
+		if bytes.Equal(sel, selector) {
+			return true
+		}
+	}
+	return false
+}
+
 func bloomFilter(bloom types.Bloom, addresses []common.Address, topics [][]common.Hash) bool {
 	if len(addresses) > 0 {
 		var included bool
@@ -17,7 +17,9 @@
 package filters
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -28,13 +30,16 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -43,10 +48,15 @@ var (
 	deadline = 5 * time.Minute
 )
 
+// testLogIndexBlocks is the section size of the log index of the test backend.
+const testLogIndexBlocks = 16
+
 type testBackend struct {
 	mux             *event.TypeMux
 	db              ethdb.Database
 	sections        uint64
+	logIndexDb      ethdb.Database
+	logIndexer      *core.ChainIndexer
 	txFeed          event.Feed
 	logsFeed        event.Feed
 	rmLogsFeed      event.Feed
@@ -130,6 +140,18 @@ func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
 
+func (b *testBackend) LogIndexStatus() (uint64, uint64) {
+	if b.logIndexer == nil {
+		return testLogIndexBlocks, 0
+	}
+	sections, _, _ := b.logIndexer.Sections()
+	return testLogIndexBlocks, sections
+}
+
+func (b *testBackend) LogIndexLookup(ctx context.Context, section uint64, term []byte) ([]core.LogPosition, error) {
+	return core.ReadLogIndex(b.db, b.logIndexDb, testLogIndexBlocks, section, term)
+}
+
 func (b *testBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
 	requests := make(chan chan *bloombits.Retrieval)
 
@@ -269,6 +291,101 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestPendingTxSubscription tests whether pending tx subscriptions deliver the
+// full transactions matching the requested sender, recipient and selector.
+func TestPendingTxSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		server  = rpc.NewServer()
+		signer  = types.HomesteadSigner{}
+
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		key2, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+		to      = common.HexToAddress("0xb794f5ea0ba39494ce83a213fffba74279579268")
+		other   = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		call    = []byte{0xa9, 0x05, 0x9c, 0xbb, 0x01}
+	)
+	sign := func(key *ecdsa.PrivateKey, nonce uint64, to *common.Address, data []byte) *types.Transaction {
+		var tx *types.Transaction
+		if to == nil {
+			tx = types.NewContractCreation(nonce, new(big.Int), 100000, new(big.Int), data)
+		} else {
+			tx = types.NewTransaction(nonce, *to, new(big.Int), 100000, new(big.Int), data)
+		}
+		tx, _ = types.SignTx(tx, signer, key)
+		return tx
+	}
+	transactions := []*types.Transaction{
+		sign(key1, 0, &to, call),    // matching sender, recipient and selector
+		sign(key2, 0, &to, call),    // mismatching sender
+		sign(key1, 1, &other, call), // mismatching recipient
+		sign(key1, 2, &to, nil),     // missing selector
+		sign(key1, 3, nil, call),    // contract creation
+		sign(key1, 4, &to, call[:4]),
+	}
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false, deadline)); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	crit := map[string]interface{}{
+		"from":     []common.Address{addr1},
+		"to":       []common.Address{to},
+		"selector": []hexutil.Bytes{call[:4]},
+	}
+	if _, err := client.EthSubscribe(context.Background(), make(chan common.Hash), "newPendingTransactions", false, map[string]interface{}{"selector": []hexutil.Bytes{call}}); err == nil {
+		t.Fatalf("subscription with invalid selector succeeded")
+	}
+	hashCh := make(chan common.Hash)
+	hashSub, err := client.EthSubscribe(context.Background(), hashCh, "newPendingTransactions")
+	if err != nil {
+		t.Fatalf("failed to subscribe to hashes: %v", err)
+	}
+	defer hashSub.Unsubscribe()
+
+	txCh := make(chan *ethapi.RPCTransaction)
+	txSub, err := client.EthSubscribe(context.Background(), txCh, "newPendingTransactions", true, crit)
+	if err != nil {
+		t.Fatalf("failed to subscribe to transactions: %v", err)
+	}
+	defer txSub.Unsubscribe()
+
+	backend.txFeed.Send(core.NewTxsEvent{Txs: transactions})
+
+	// The unfiltered subscription should deliver all hashes
+	for i, tx := range transactions {
+		select {
+		case hash := <-hashCh:
+			if hash != tx.Hash() {
+				t.Fatalf("hash %d mismatch: have %x, want %x", i, hash, tx.Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("hash %d not delivered", i)
+		}
+	}
+	// The filtered one should deliver the full matching transactions only
+	for _, i := range []int{0, 5} {
+		select {
+		case tx := <-txCh:
+			if tx.Hash != transactions[i].Hash() || tx.From != addr1 || !bytes.Equal(tx.Input, transactions[i].Data()) {
+				t.Fatalf("transaction mismatch: have %x, want %x", tx.Hash, transactions[i].Hash())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("transaction %d not delivered", i)
+		}
+	}
+	select {
+	case tx := <-txCh:
+		t.Fatalf("unexpected transaction delivered: %x", tx.Hash)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -680,3 +797,155 @@ func flattenLogs(pl [][]*types.Log) []*types.Log {
 	}
 	return logs
 }
+
+// Tests that log subscriptions replay the historical logs from the requested
+// block, and that resumed subscriptions receive the logs of abandoned blocks
+// as removed before the canonical ones.
+func TestLogsSubscriptionReplay(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		server  = rpc.NewServer()
+		addr    = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		genesis = new(core.Genesis).MustCommit(db)
+	)
+	// makeChain generates blocks with a log each, topics distinguishing the
+	// blocks of the forks
+	makeChain := func(parent *types.Block, n int, fork byte) ([]*types.Block, []types.Receipts) {
+		return core.GenerateChain(params.TestChainConfig, parent, ethash.NewFaker(), db, n, func(i int, gen *core.BlockGen) {
+			receipt := types.NewReceipt(nil, false, 0)
+			receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{{fork, byte(gen.Number().Uint64())}}}}
+			gen.AddUncheckedReceipt(receipt)
+			gen.AddUncheckedTx(types.NewTransaction(uint64(fork), common.Address{fork}, big.NewInt(1), 1, big.NewInt(1), nil))
+		})
+	}
+	chain, receipts := makeChain(genesis, 6, 0)
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	side, sideReceipts := makeChain(chain[2], 2, 1)
+	for i, block := range side {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), sideReceipts[i])
+	}
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false, deadline)); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// topic returns the distinguishing topic of the log of a block
+	topic := func(fork byte, number uint64) common.Hash {
+		return common.Hash{fork, byte(number)}
+	}
+	type result struct {
+		topic   common.Hash
+		removed bool
+	}
+	tests := []struct {
+		crit   map[string]interface{}
+		expect []result
+	}{
+		// Logs from a past block are replayed
+		{
+			map[string]interface{}{"fromBlock": "0x5"},
+			[]result{{topic(0, 5), false}, {topic(0, 6), false}},
+		},
+		// Logs of abandoned blocks are removed, newest first
+		{
+			map[string]interface{}{"resumeFrom": side[1].Hash()},
+			[]result{
+				{topic(1, 5), true}, {topic(1, 4), true},
+				{topic(0, 4), false}, {topic(0, 5), false}, {topic(0, 6), false},
+			},
+		},
+		// Nothing is replayed when resuming from the head
+		{
+			map[string]interface{}{"resumeFrom": chain[5].Hash()},
+			nil,
+		},
+	}
+	for i, tt := range tests {
+		ch := make(chan types.Log)
+		sub, err := client.EthSubscribe(context.Background(), ch, "logs", tt.crit)
+		if err != nil {
+			t.Fatalf("test %d: failed to subscribe: %v", i, err)
+		}
+		for j, want := range tt.expect {
+			select {
+			case log := <-ch:
+				if log.Topics[0] != want.topic || log.Removed != want.removed {
+					t.Fatalf("test %d: log %d mismatch: have %x (removed %v), want %x (removed %v)", i, j, log.Topics[0], log.Removed, want.topic, want.removed)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("test %d: log %d not delivered", i, j)
+			}
+		}
+		// Live logs should follow the replayed ones
+		live := &types.Log{Address: addr, Topics: []common.Hash{topic(0, 7)}, BlockNumber: 7, BlockHash: common.Hash{0x7}}
+		for backend.logsFeed.Send([]*types.Log{live}) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case log := <-ch:
+			if log.Topics[0] != live.Topics[0] || log.Removed {
+				t.Fatalf("test %d: live log mismatch: have %x (removed %v)", i, log.Topics[0], log.Removed)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("test %d: live log not delivered", i)
+		}
+		sub.Unsubscribe()
+	}
+}
+
+// Tests that log subscriptions refuse to replay more than maxReplayBlocks blocks
+// and to combine the resume cursor with the starting block.
+func TestLogsSubscriptionReplayLimit(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		server  = rpc.NewServer()
+		genesis = &types.Header{Number: big.NewInt(0)}
+		head    = &types.Header{Number: big.NewInt(maxReplayBlocks), ParentHash: common.Hash{0x1}}
+	)
+	for _, header := range []*types.Header{genesis, head} {
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), header.Number.Uint64())
+	}
+	rawdb.WriteHeadBlockHash(db, head.Hash())
+
+	// Create a sidechain abandoned for longer than the replay limit
+	side := genesis
+	for i := 1; i <= maxReplayBlocks+1; i++ {
+		side = &types.Header{Number: big.NewInt(int64(i)), ParentHash: side.Hash(), Extra: []byte("side")}
+		rawdb.WriteHeader(db, side)
+	}
+	if err := server.RegisterName("eth", NewPublicFilterAPI(backend, false, deadline)); err != nil {
+		t.Fatalf("failed to register filter API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	for i, crit := range []map[string]interface{}{
+		{"fromBlock": "0x0"},
+		{"resumeFrom": side.Hash()},
+		{"resumeFrom": head.Hash(), "fromBlock": "0x0"},
+	} {
+		if _, err := client.EthSubscribe(context.Background(), make(chan types.Log), "logs", crit); err == nil {
+			t.Errorf("test %d: subscription succeeded", i)
+		}
+	}
+	// Resuming from the head is still allowed
+	sub, err := client.EthSubscribe(context.Background(), make(chan types.Log), "logs", map[string]interface{}{"resumeFrom": head.Hash()})
+	if err != nil {
+		t.Fatalf("failed to resume from the head: %v", err)
+	}
+	sub.Unsubscribe()
+}
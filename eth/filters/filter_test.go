@@ -21,7 +21,9 @@ import (
 	"io/ioutil"
 	"math/big"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
@@ -29,7 +31,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 func makeReceipt(addr common.Address) *types.Receipt {
@@ -223,3 +227,150 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// testIndexerChain feeds the head of a test chain to a chain indexer.
+type testIndexerChain struct {
+	head *types.Header
+	feed event.Feed
+}
+
+func (c *testIndexerChain) CurrentHeader() *types.Header {
+	return c.head
+}
+
+func (c *testIndexerChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// Tests that filtering through the log index yields the same logs as scanning
+// the blocks, for ranges covered by the index both partially and entirely.
+func TestLogIndexFilters(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		indexed = &testBackend{db: db, logIndexDb: rawdb.NewMemoryDatabase()}
+		scanned = &testBackend{db: db}
+		addr1   = common.HexToAddress("0x1111111111111111111111111111111111111111")
+		addr2   = common.HexToAddress("0x2222222222222222222222222222222222222222")
+		topics  = []common.Hash{{0x1}, {0x2}, {0x3}}
+	)
+	genesis := new(core.Genesis).MustCommit(db)
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 70, func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr1, Topics: []common.Hash{topics[i%3], topics[(i/3)%3]}}}
+		if i%5 == 0 {
+			receipt.Logs = append(receipt.Logs, &types.Log{Address: addr2, Topics: []common.Hash{topics[(i+1)%3]}})
+		}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	indexed.logIndexer = core.NewLogIndexer(db, indexed.logIndexDb, testLogIndexBlocks, 0)
+	defer indexed.logIndexer.Close()
+	indexed.logIndexer.Start(&testIndexerChain{head: chain[len(chain)-1].Header()})
+
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, sections := indexed.LogIndexStatus(); sections == 4 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("log index not generated")
+		}
+	}
+	tests := []struct {
+		begin, end int64
+		addresses  []common.Address
+		topics     [][]common.Hash
+	}{
+		{0, -1, []common.Address{addr1}, nil},
+		{0, -1, []common.Address{addr2}, nil},
+		{5, 40, []common.Address{addr1, addr2}, nil},
+		{0, -1, nil, [][]common.Hash{{topics[0]}}},
+		{3, 68, nil, [][]common.Hash{nil, {topics[1], topics[2]}}},
+		{20, 20, nil, [][]common.Hash{{topics[2]}}},
+		{0, -1, []common.Address{addr2}, [][]common.Hash{{topics[1]}}},
+		{0, -1, []common.Address{addr2}, [][]common.Hash{nil, {topics[1]}}},
+		{10, 60, []common.Address{addr1}, [][]common.Hash{{topics[0]}, {topics[2]}}},
+		{0, -1, []common.Address{{0x9}}, nil},
+	}
+	for i, tt := range tests {
+		want, err := NewRangeFilter(scanned, tt.begin, tt.end, tt.addresses, tt.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: failed to scan logs: %v", i, err)
+		}
+		have, err := NewRangeFilter(indexed, tt.begin, tt.end, tt.addresses, tt.topics).Logs(context.Background())
+		if err != nil {
+			t.Fatalf("test %d: failed to filter indexed logs: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("test %d: logs mismatch: have %d logs, want %d", i, len(have), len(want))
+		}
+	}
+}
+
+// Tests that filtering logs in blocks with pruned history fails.
+func TestPrunedHistoryFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filtertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		backend = &testBackend{db: db}
+		addr    = common.Address{0x1}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = core.GenesisBlockForTesting(gendb, addr, big.NewInt(1000000))
+	)
+	blocks, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), gendb, 9, func(i int, gen *core.BlockGen) {
+		gen.AddUncheckedReceipt(makeReceipt(addr))
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.Address{0x2}, big.NewInt(1), 1, big.NewInt(1), nil))
+	})
+	blocks = append([]*types.Block{genesis}, blocks...)
+	receipts = append([]types.Receipts{nil}, receipts...)
+	for i, block := range blocks {
+		rawdb.WriteAncientBlock(db, block, receipts[i], big.NewInt(int64(i)))
+		rawdb.WriteHeaderNumber(db, block.Hash(), block.NumberU64())
+	}
+	rawdb.WriteHeadBlockHash(db, blocks[len(blocks)-1].Hash())
+
+	if err := db.TruncateAncientTail(5); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	checkPruned := func(filter *Filter) {
+		t.Helper()
+		if _, err := filter.Logs(context.Background()); err == nil {
+			t.Fatal("filtered pruned history")
+		} else if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != 4444 {
+			t.Fatalf("error mismatch: have %v, want history pruned", err)
+		}
+	}
+	checkPruned(NewRangeFilter(backend, 0, -1, []common.Address{addr}, nil))
+	checkPruned(NewRangeFilter(backend, 4, 6, []common.Address{addr}, nil))
+	checkPruned(NewBlockFilter(backend, blocks[4].Hash(), []common.Address{addr}, nil))
+
+	logs, err := NewRangeFilter(backend, 5, -1, []common.Address{addr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to filter retained history: %v", err)
+	}
+	if len(logs) != 5 {
+		t.Fatalf("log count mismatch: have %d, want 5", len(logs))
+	}
+	logs, err = NewBlockFilter(backend, blocks[5].Hash(), []common.Address{addr}, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to filter retained block: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("block log count mismatch: have %d, want 1", len(logs))
+	}
+}
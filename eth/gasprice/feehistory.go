@@ -0,0 +1,228 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	errInvalidPercentile = errors.New("invalid reward percentile")
+	errRequestBeyondHead = errors.New("request beyond head block")
+)
+
+const (
+	// maxFeeHistory is the maximum number of blocks that can be retrieved in a
+	// single fee history request.
+	maxFeeHistory = 1024
+
+	// feeHistoryCacheSize is the number of processed blocks retained to serve
+	// overlapping fee history requests and price suggestions.
+	feeHistoryCacheSize = 2048
+)
+
+// txGasAndPrice is the gas used and the gas price paid by a transaction.
+type txGasAndPrice struct {
+	gasUsed uint64
+	price   *big.Int
+}
+
+// blockFees is the gas price distribution of a block, independent of the
+// requested percentiles so it can be cached. It is shared by the fee history
+// and the price suggestions of the oracle.
+type blockFees struct {
+	gasUsedRatio float64
+	txs          []txGasAndPrice // Sorted by gas price in ascending order, nil if not processed
+	gasUsed      uint64          // Gas used by the sampled transactions
+	processed    bool            // Whether the transactions of the block were processed
+	receipts     bool            // Whether the gas used of the transactions is filled in
+}
+
+// processBlock collects the gas price distribution of a block. The transactions
+// sent by the miner are skipped as they can be included at any price. The gas
+// used by the transactions is only filled in if the receipts are given.
+func (gpo *Oracle) processBlock(header *types.Header, block *types.Block, receipts types.Receipts) (*blockFees, error) {
+	fees := &blockFees{
+		gasUsedRatio: float64(header.GasUsed) / float64(header.GasLimit),
+	}
+	if block == nil {
+		return fees, nil
+	}
+	if receipts != nil && len(receipts) != len(block.Transactions()) {
+		return nil, fmt.Errorf("receipt count mismatch for block %d: have %d, want %d", block.NumberU64(), len(receipts), len(block.Transactions()))
+	}
+	fees.processed, fees.receipts = true, receipts != nil
+
+	signer := types.MakeSigner(gpo.backend.ChainConfig(), block.Number())
+	for i, tx := range block.Transactions() {
+		if sender, err := types.Sender(signer, tx); err != nil || sender == block.Coinbase() {
+			continue
+		}
+		sample := txGasAndPrice{price: tx.GasPrice()}
+		if receipts != nil {
+			sample.gasUsed = receipts[i].GasUsed
+			fees.gasUsed += receipts[i].GasUsed
+		}
+		fees.txs = append(fees.txs, sample)
+	}
+	sort.SliceStable(fees.txs, func(i, j int) bool { return fees.txs[i].price.Cmp(fees.txs[j].price) < 0 })
+	return fees, nil
+}
+
+// lowestPrices returns at most limit of the lowest gas prices paid in the block.
+func (fees *blockFees) lowestPrices(limit int) []*big.Int {
+	var prices []*big.Int
+	for i := 0; i < len(fees.txs) && i < limit; i++ {
+		prices = append(prices, fees.txs[i].price)
+	}
+	return prices
+}
+
+// rewards returns the gas prices at the given percentiles of the gas used by
+// the sampled transactions of the block. Blocks without sampled transactions
+// report zero prices.
+func (fees *blockFees) rewards(percentiles []float64) []*big.Int {
+	rewards := make([]*big.Int, len(percentiles))
+	if len(fees.txs) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards
+	}
+	var (
+		index = 0
+		sum   = fees.txs[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(fees.gasUsed) * p / 100)
+		for sum < threshold && index < len(fees.txs)-1 {
+			index++
+			sum += fees.txs[index].gasUsed
+		}
+		rewards[i] = new(big.Int).Set(fees.txs[index].price)
+	}
+	return rewards
+}
+
+// blockFees retrieves the gas price distribution of the given block, either
+// from the cache or by processing the block. The transactions are processed if
+// requested, and their gas used is filled in from the receipts if requested.
+// If the block is not available, nil is returned without an error.
+func (gpo *Oracle) blockFees(ctx context.Context, number uint64, withTxs bool, withReceipts bool) (*blockFees, error) {
+	header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if header == nil {
+		return nil, err
+	}
+	if cached, ok := gpo.historyCache.Get(header.Hash()); ok {
+		if fees := cached.(*blockFees); (fees.processed || !withTxs) && (fees.receipts || !withReceipts) {
+			return fees, nil
+		}
+	}
+	if !withTxs && !withReceipts {
+		return gpo.processBlock(header, nil, nil)
+	}
+	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(number))
+	if block == nil {
+		return nil, err
+	}
+	var receipts types.Receipts
+	if withReceipts {
+		if receipts, err = gpo.backend.GetReceipts(ctx, block.Hash()); err != nil {
+			return nil, err
+		}
+		if receipts == nil {
+			receipts = types.Receipts{}
+		}
+	}
+	fees, err := gpo.processBlock(header, block, receipts)
+	if err != nil {
+		return nil, err
+	}
+	gpo.historyCache.Add(header.Hash(), fees)
+	return fees, nil
+}
+
+// FeeHistory returns the gas used ratio and the requested percentiles of the
+// gas prices paid in a range of blocks ending with the given last block. The
+// percentiles are weighted by the gas used of the transactions and must be
+// given in ascending order between 0 and 100.
+//
+// The number of blocks is capped at the available history and maxFeeHistory.
+// The number of the oldest block of the range is returned along the ratios and
+// the rewards, which are nil if no percentiles are requested.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, percentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	if blocks < 1 {
+		return common.Big0, nil, []float64{}, nil
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	for i, p := range percentiles {
+		if p < 0 || p > 100 {
+			return nil, nil, nil, fmt.Errorf("%w: %f", errInvalidPercentile, p)
+		}
+		if i > 0 && p < percentiles[i-1] {
+			return nil, nil, nil, fmt.Errorf("%w: #%d:%f > #%d:%f", errInvalidPercentile, i-1, percentiles[i-1], i, p)
+		}
+	}
+	// Resolve the last block of the range, pending blocks are not processed
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil {
+		return nil, nil, nil, err
+	}
+	last := head.Number.Uint64()
+	if lastBlock >= 0 {
+		if uint64(lastBlock) > last {
+			return nil, nil, nil, fmt.Errorf("%w: requested %d, head %d", errRequestBeyondHead, lastBlock, last)
+		}
+		last = uint64(lastBlock)
+	}
+	if uint64(blocks) > last+1 {
+		blocks = int(last + 1)
+	}
+	oldest := last + 1 - uint64(blocks)
+
+	var (
+		ratios  = make([]float64, blocks)
+		rewards [][]*big.Int
+	)
+	if len(percentiles) > 0 {
+		rewards = make([][]*big.Int, blocks)
+	}
+	for i := 0; i < blocks; i++ {
+		fees, err := gpo.blockFees(ctx, oldest+uint64(i), len(percentiles) > 0, len(percentiles) > 0)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if fees == nil {
+			return nil, nil, nil, fmt.Errorf("block %d not found", oldest+uint64(i))
+		}
+		ratios[i] = fees.gasUsedRatio
+		if rewards != nil {
+			rewards[i] = fees.rewards(percentiles)
+		}
+	}
+	return new(big.Int).SetUint64(oldest), rewards, ratios, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+func TestFeeHistory(t *testing.T) {
+	var cases = []struct {
+		count       int
+		last        rpc.BlockNumber
+		percentiles []float64
+		expFirst    uint64
+		expCount    int
+		expErr      error
+	}{
+		{count: 0, last: rpc.LatestBlockNumber, percentiles: nil, expFirst: 0, expCount: 0},
+		{count: 4, last: rpc.LatestBlockNumber, percentiles: nil, expFirst: 29, expCount: 4},
+		{count: 4, last: rpc.LatestBlockNumber, percentiles: []float64{0, 50, 100}, expFirst: 29, expCount: 4},
+		{count: 4, last: rpc.PendingBlockNumber, percentiles: []float64{10}, expFirst: 29, expCount: 4},
+		{count: 20, last: 10, percentiles: []float64{50}, expFirst: 0, expCount: 11},
+		{count: 2000, last: rpc.LatestBlockNumber, percentiles: nil, expFirst: 0, expCount: 33},
+		{count: 1, last: 33, percentiles: nil, expErr: errRequestBeyondHead},
+		{count: 1, last: rpc.LatestBlockNumber, percentiles: []float64{101}, expErr: errInvalidPercentile},
+		{count: 1, last: rpc.LatestBlockNumber, percentiles: []float64{50, 40}, expErr: errInvalidPercentile},
+	}
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(params.GWei)})
+
+	for i, c := range cases {
+		first, rewards, ratios, err := oracle.FeeHistory(context.Background(), c.count, c.last, c.percentiles)
+		if c.expErr != nil {
+			if !errors.Is(err, c.expErr) {
+				t.Fatalf("test %d: error mismatch: have %v, want %v", i, err, c.expErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve fee history: %v", i, err)
+		}
+		if first.Uint64() != c.expFirst {
+			t.Fatalf("test %d: first block mismatch: have %d, want %d", i, first, c.expFirst)
+		}
+		if ratios == nil || len(ratios) != c.expCount {
+			t.Fatalf("test %d: gas used ratio count mismatch: have %v, want %d", i, ratios, c.expCount)
+		}
+		if c.percentiles == nil {
+			if rewards != nil {
+				t.Fatalf("test %d: unrequested rewards returned", i)
+			}
+			continue
+		}
+		if len(rewards) != c.expCount {
+			t.Fatalf("test %d: reward count mismatch: have %d, want %d", i, len(rewards), c.expCount)
+		}
+		// Every block but the genesis contains a single transaction priced at
+		// the block number in gwei
+		for j, reward := range rewards {
+			number := c.expFirst + uint64(j)
+			want := new(big.Int).SetUint64(number * params.GWei)
+			if len(reward) != len(c.percentiles) {
+				t.Fatalf("test %d: block %d percentile count mismatch: have %d, want %d", i, number, len(reward), len(c.percentiles))
+			}
+			for k, price := range reward {
+				if price.Cmp(want) != 0 {
+					t.Fatalf("test %d: block %d percentile %v mismatch: have %v, want %v", i, number, c.percentiles[k], price, want)
+				}
+			}
+			if number > 0 && ratios[j] == 0 {
+				t.Fatalf("test %d: block %d gas used ratio missing", i, number)
+			}
+		}
+	}
+}
+
+// Tests that the blocks processed for price suggestions and fee history requests
+// are shared through the cache.
+func TestFeeHistorySharedCache(t *testing.T) {
+	backend := newTestBackend(t)
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(params.GWei)})
+
+	if _, err := oracle.SuggestPrice(context.Background()); err != nil {
+		t.Fatalf("failed to suggest price: %v", err)
+	}
+	head, _ := backend.HeaderByNumber(context.Background(), rpc.LatestBlockNumber)
+	cached, ok := oracle.historyCache.Get(head.Hash())
+	if !ok {
+		t.Fatal("suggested price block not cached")
+	}
+	if fees := cached.(*blockFees); !fees.processed || fees.receipts {
+		t.Fatalf("cached block processing mismatch: have processed %v receipts %v, want true false", fees.processed, fees.receipts)
+	}
+	// The fee history should fill in the gas used of the cached block
+	_, rewards, _, err := oracle.FeeHistory(context.Background(), 1, rpc.LatestBlockNumber, []float64{50})
+	if err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if want := new(big.Int).SetUint64(head.Number.Uint64() * params.GWei); rewards[0][0].Cmp(want) != 0 {
+		t.Fatalf("reward mismatch: have %v, want %v", rewards[0][0], want)
+	}
+	cached, _ = oracle.historyCache.Get(head.Hash())
+	if fees := cached.(*blockFees); !fees.receipts || fees.gasUsed == 0 {
+		t.Fatalf("cached block gas used missing: receipts %v, gas used %d", fees.receipts, fees.gasUsed)
+	}
+	// The price suggestions should be served from the processed block
+	if prices := cached.(*blockFees).lowestPrices(sampleNumber); len(prices) != 1 {
+		t.Fatalf("lowest price count mismatch: have %d, want 1", len(prices))
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 const sampleNumber = 3 // Number of transactions sampled in a block
@@ -44,6 +45,7 @@ type Config struct {
 type OracleBackend interface {
 	HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error)
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
+	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	ChainConfig() *params.ChainConfig
 }
 
@@ -59,6 +61,8 @@ type Oracle struct {
 
 	checkBlocks int
 	percentile  int
+
+	historyCache *lru.Cache // Processed blocks of recent fee history requests
 }
 
 // NewOracle returns a new gasprice oracle which can recommend suitable
@@ -83,12 +87,14 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		maxPrice = DefaultMaxPrice
 		log.Warn("Sanitizing invalid gasprice oracle price cap", "provided", params.MaxPrice, "updated", maxPrice)
 	}
+	cache, _ := lru.New(feeHistoryCacheSize)
 	return &Oracle{
-		backend:     backend,
-		lastPrice:   params.Default,
-		maxPrice:    maxPrice,
-		checkBlocks: blocks,
-		percentile:  percent,
+		backend:      backend,
+		lastPrice:    params.Default,
+		maxPrice:     maxPrice,
+		checkBlocks:  blocks,
+		percentile:   percent,
+		historyCache: cache,
 	}
 }
 
@@ -123,7 +129,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 		txPrices  []*big.Int
 	)
 	for sent < gpo.checkBlocks && number > 0 {
-		go gpo.getBlockPrices(ctx, types.MakeSigner(gpo.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, result, quit)
+		go gpo.getBlockPrices(ctx, number, sampleNumber, result, quit)
 		sent++
 		exp++
 		number--
@@ -146,7 +152,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 		// meaningful returned, try to query more blocks. But the maximum
 		// is 2*checkBlocks.
 		if len(res.prices) == 1 && len(txPrices)+1+exp < gpo.checkBlocks*2 && number > 0 {
-			go gpo.getBlockPrices(ctx, types.MakeSigner(gpo.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, result, quit)
+			go gpo.getBlockPrices(ctx, number, sampleNumber, result, quit)
 			sent++
 			exp++
 			number--
@@ -173,39 +179,24 @@ type getBlockPricesResult struct {
 	err    error
 }
 
-type transactionsByGasPrice []*types.Transaction
-
-func (t transactionsByGasPrice) Len() int           { return len(t) }
-func (t transactionsByGasPrice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
-func (t transactionsByGasPrice) Less(i, j int) bool { return t[i].GasPriceCmp(t[j]) < 0 }
-
-// getBlockPrices calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty or all transactions
+// getBlockPrices calculates the lowest transaction gas prices in a given block
+// and sends them to the result channel. If the block is empty or all transactions
 // are sent by the miner itself(it doesn't make any sense to include this kind of
-// transaction prices for sampling), nil gasprice is returned.
-func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, blockNum uint64, limit int, result chan getBlockPricesResult, quit chan struct{}) {
-	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
-	if block == nil {
+// transaction prices for sampling), nil gasprice is returned, just like for missing
+// blocks. The processed block is shared with the fee history requests through the
+// cache.
+func (gpo *Oracle) getBlockPrices(ctx context.Context, blockNum uint64, limit int, result chan getBlockPricesResult, quit chan struct{}) {
+	fees, err := gpo.blockFees(ctx, blockNum, true, false)
+	if err != nil {
 		select {
 		case result <- getBlockPricesResult{nil, err}:
 		case <-quit:
 		}
 		return
 	}
-	blockTxs := block.Transactions()
-	txs := make([]*types.Transaction, len(blockTxs))
-	copy(txs, blockTxs)
-	sort.Sort(transactionsByGasPrice(txs))
-
 	var prices []*big.Int
-	for _, tx := range txs {
-		sender, err := types.Sender(signer, tx)
-		if err == nil && sender != block.Coinbase() {
-			prices = append(prices, tx.GasPrice())
-			if len(prices) >= limit {
-				break
-			}
-		}
+	if fees != nil {
+		prices = fees.lowestPrices(limit)
 	}
 	select {
 	case result <- getBlockPricesResult{prices, nil}:
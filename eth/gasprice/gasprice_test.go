@@ -51,6 +51,10 @@ func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber)
 	return b.chain.GetBlockByNumber(uint64(number)), nil
 }
 
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	return b.chain.GetReceiptsByHash(hash), nil
+}
+
 func (b *testBackend) ChainConfig() *params.ChainConfig {
 	return b.chain.Config()
 }
@@ -116,3 +120,30 @@ func TestSuggestPrice(t *testing.T) {
 		t.Fatalf("Gas price mismatch, want %d, got %d", expect, got)
 	}
 }
+
+// missingBlockBackend is a test backend missing the body of one block.
+type missingBlockBackend struct {
+	*testBackend
+	missing rpc.BlockNumber
+}
+
+func (b *missingBlockBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	if number == b.missing {
+		return nil, nil
+	}
+	return b.testBackend.BlockByNumber(ctx, number)
+}
+
+// Tests that missing blocks are skipped when suggesting a price, but fail the
+// fee history requests covering them.
+func TestMissingBlock(t *testing.T) {
+	backend := &missingBlockBackend{testBackend: newTestBackend(t), missing: 31}
+	oracle := NewOracle(backend, Config{Blocks: 3, Percentile: 60, Default: big.NewInt(params.GWei)})
+
+	if _, err := oracle.SuggestPrice(context.Background()); err != nil {
+		t.Fatalf("Failed to retrieve recommended gas price: %v", err)
+	}
+	if _, _, _, err := oracle.FeeHistory(context.Background(), 4, rpc.LatestBlockNumber, []float64{50}); err == nil {
+		t.Fatal("Fee history retrieved with missing block")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -160,6 +161,26 @@ type TraceConfig struct {
 	Tracer  *string
 	Timeout *string
 	Reexec  *uint64
+
+	// TracerConfig is the tracer specific configuration, currently only
+	// interpreted by the native tracers.
+	TracerConfig json.RawMessage
+}
+
+// TraceCallConfig holds extra parameters to call trace functions.
+type TraceCallConfig struct {
+	TraceConfig
+	StateOverrides *ethapi.StateOverride
+	BlockOverrides *ethapi.BlockOverrides
+}
+
+// traceConfig returns the generic trace config embedded in the call trace
+// config, or nil if no config was given.
+func (config *TraceCallConfig) traceConfig() *TraceConfig {
+	if config == nil {
+		return nil
+	}
+	return &config.TraceConfig
 }
 
 // StdTraceConfig holds extra parameters to standard-json trace functions.
@@ -685,7 +706,68 @@ func (api *API) TraceTransaction(ctx context.Context, hash common.Hash, config *
 // created during the execution of EVM if the given transaction was added on
 // top of the provided block and returns them as a JSON object.
 // You can provide -2 as a block number to trace on top of the pending block.
-func (api *API) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceConfig) (interface{}, error) {
+// The state and the block context can be overridden the same way as for the
+// eth_call, allowing to trace against patched contracts.
+func (api *API) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (interface{}, error) {
+	statedb, vmctx, release, err := api.stateAtCall(ctx, blockNrOrHash, config)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Execute the trace
+	msg := args.ToMessage(api.backend.RPCGasCap())
+	return api.traceTx(ctx, msg, vmctx, statedb, config.traceConfig())
+}
+
+// TraceCallBlock is a group of calls to trace as part of a pseudo block, with
+// the block context of the base block optionally overridden.
+type TraceCallBlock struct {
+	Calls          []ethapi.CallArgs      `json:"calls"`
+	BlockOverrides *ethapi.BlockOverrides `json:"blockOverrides"`
+}
+
+// TraceCallMany lets you trace a sequence of eth_calls, each one executed on top
+// of the state left behind by the previous one. The calls are grouped into pseudo
+// blocks, each of which may override the block context of the provided block.
+// One trace is returned for every call, grouped in the same way as the input.
+// A call failing to execute does not abort the rest of the sequence, instead
+// the failure is reported in the call's trace result.
+//
+// Any state and block overrides in the config are applied before the first call,
+// the overrides of the individual pseudo blocks are applied on top of them.
+func (api *API) TraceCallMany(ctx context.Context, blocks []TraceCallBlock, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) ([][]*txTraceResult, error) {
+	statedb, basectx, release, err := api.stateAtCall(ctx, blockNrOrHash, config)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	results := make([][]*txTraceResult, len(blocks))
+	for i, pseudo := range blocks {
+		vmctx := basectx
+		pseudo.BlockOverrides.Apply(&vmctx)
+
+		results[i] = make([]*txTraceResult, len(pseudo.Calls))
+		for j, args := range pseudo.Calls {
+			msg := args.ToMessage(api.backend.RPCGasCap())
+			res, err := api.traceTx(ctx, msg, vmctx, statedb, config.traceConfig())
+			if err != nil {
+				results[i][j] = &txTraceResult{Error: err.Error()}
+			} else {
+				results[i][j] = &txTraceResult{Result: res}
+			}
+			// Finalize the state so the next call sees the changes
+			statedb.Finalise(api.backend.ChainConfig().IsEIP158(vmctx.BlockNumber))
+		}
+	}
+	return results, nil
+}
+
+// stateAtCall retrieves the state at the end of the block identified by
+// blockNrOrHash and the block context to execute calls on top of it, both with
+// the overrides of the config applied.
+func (api *API) stateAtCall(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash, config *TraceCallConfig) (*state.StateDB, vm.BlockContext, func(), error) {
 	// Try to retrieve the specified block
 	var (
 		err   error
@@ -695,9 +777,11 @@ func (api *API) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHa
 		block, err = api.blockByHash(ctx, hash)
 	} else if number, ok := blockNrOrHash.Number(); ok {
 		block, err = api.blockByNumber(ctx, number)
+	} else {
+		return nil, vm.BlockContext{}, nil, errors.New("invalid arguments; neither block nor hash specified")
 	}
 	if err != nil {
-		return nil, err
+		return nil, vm.BlockContext{}, nil, err
 	}
 	// try to recompute the state
 	reexec := defaultTraceReexec
@@ -706,14 +790,19 @@ func (api *API) TraceCall(ctx context.Context, args ethapi.CallArgs, blockNrOrHa
 	}
 	statedb, release, err := api.backend.StateAtBlock(ctx, block, reexec)
 	if err != nil {
-		return nil, err
+		return nil, vm.BlockContext{}, nil, err
 	}
-	defer release()
-
-	// Execute the trace
-	msg := args.ToMessage(api.backend.RPCGasCap())
 	vmctx := core.NewEVMBlockContext(block.Header(), api.chainContext(ctx), nil)
-	return api.traceTx(ctx, msg, vmctx, statedb, config)
+
+	// Apply the customized state and block overrides if any
+	if config != nil {
+		if err := config.StateOverrides.Apply(statedb); err != nil {
+			release()
+			return nil, vm.BlockContext{}, nil, err
+		}
+		config.BlockOverrides.Apply(&vmctx)
+	}
+	return statedb, vmctx, release, nil
 }
 
 // traceTx configures a new tracer according to the provided configuration, and
@@ -735,16 +824,18 @@ func (api *API) traceTx(ctx context.Context, message core.Message, vmctx vm.Bloc
 				return nil, err
 			}
 		}
-		// Constuct the JavaScript tracer to execute with
-		if tracer, err = New(*config.Tracer, txContext); err != nil {
+		// Constuct the native or JavaScript tracer to execute with
+		t, err := New(*config.Tracer, txContext, config.TracerConfig)
+		if err != nil {
 			return nil, err
 		}
 		// Handle timeouts and RPC cancellations
 		deadlineCtx, cancel := context.WithTimeout(ctx, timeout)
 		go func() {
 			<-deadlineCtx.Done()
-			tracer.(*Tracer).Stop(errors.New("execution timeout"))
+			t.Stop(errors.New("execution timeout"))
 		}()
+		tracer = t
 		defer cancel()
 
 	case config == nil:
@@ -776,7 +867,7 @@ func (api *API) traceTx(ctx context.Context, message core.Message, vmctx vm.Bloc
 			StructLogs:  ethapi.FormatLogs(tracer.StructLogs()),
 		}, nil
 
-	case *Tracer:
+	case Tracer:
 		return tracer.GetResult()
 
 	default:
@@ -214,7 +214,7 @@ func TestTraceCall(t *testing.T) {
 	var testSuite = []struct {
 		blockNumber rpc.BlockNumber
 		call        ethapi.CallArgs
-		config      *TraceConfig
+		config      *TraceCallConfig
 		expectErr   error
 		expect      interface{}
 	}{
@@ -321,6 +321,112 @@ func TestTraceCall(t *testing.T) {
 	}
 }
 
+func TestTraceCallWithOverrides(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts
+	accounts := newAccounts(2)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+	}}
+	api := NewAPI(newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {}))
+
+	// Fund an empty account and patch in a contract returning the block number
+	var (
+		head    = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		number  = common.HexToAddress("0x1337")
+		balance = (*hexutil.Big)(big.NewInt(params.Ether))
+		code    = hexutil.Bytes{byte(vm.NUMBER), byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN)}
+		call    = ethapi.CallArgs{
+			From:  &accounts[1].addr,
+			To:    &number,
+			Value: (*hexutil.Big)(big.NewInt(1000)),
+		}
+	)
+	if _, err := api.TraceCall(context.Background(), call, head, nil); err == nil {
+		t.Fatalf("call from unfunded account succeeded")
+	}
+	config := &TraceCallConfig{
+		StateOverrides: &ethapi.StateOverride{
+			accounts[1].addr: ethapi.OverrideAccount{Balance: &balance},
+			number:           ethapi.OverrideAccount{Code: &code},
+		},
+		BlockOverrides: &ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(0x539))},
+	}
+	result, err := api.TraceCall(context.Background(), call, head, config)
+	if err != nil {
+		t.Fatalf("failed to trace call: %v", err)
+	}
+	res := result.(*ethapi.ExecutionResult)
+	if res.Failed {
+		t.Fatalf("call execution failed")
+	}
+	if want := fmt.Sprintf("%064x", 0x539); res.ReturnValue != want {
+		t.Errorf("block number override mismatch: have %s, want %s", res.ReturnValue, want)
+	}
+}
+
+func TestTraceCallMany(t *testing.T) {
+	t.Parallel()
+
+	// Initialize test accounts and a contract returning the block number
+	accounts := newAccounts(3)
+	number := common.HexToAddress("0x1337")
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr: {Balance: big.NewInt(params.Ether)},
+		accounts[1].addr: {Balance: big.NewInt(params.Ether)},
+		accounts[2].addr: {Balance: big.NewInt(params.Ether)},
+		number:           {Balance: new(big.Int), Code: []byte{byte(vm.NUMBER), byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN)}},
+	}}
+	api := NewAPI(newTestBackend(t, 1, genesis, func(i int, b *core.BlockGen) {}))
+
+	// Moving more than the original balance only works if the first call is
+	// applied before the second one
+	var (
+		head     = rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+		transfer = ethapi.CallArgs{
+			From:  &accounts[0].addr,
+			To:    &accounts[1].addr,
+			Value: (*hexutil.Big)(big.NewInt(params.Ether)),
+		}
+		forward = ethapi.CallArgs{
+			From:  &accounts[1].addr,
+			To:    &accounts[2].addr,
+			Value: (*hexutil.Big)(new(big.Int).Mul(big.NewInt(3), big.NewInt(params.Ether/2))),
+		}
+		query = ethapi.CallArgs{
+			From: &accounts[0].addr,
+			To:   &number,
+		}
+	)
+	if _, err := api.TraceCall(context.Background(), forward, head, nil); err == nil {
+		t.Fatalf("standalone call succeeded without the funding transfer")
+	}
+	results, err := api.TraceCallMany(context.Background(), []TraceCallBlock{
+		{Calls: []ethapi.CallArgs{transfer}},
+		{Calls: []ethapi.CallArgs{forward, query}, BlockOverrides: &ethapi.BlockOverrides{Number: (*hexutil.Big)(big.NewInt(0x539))}},
+	}, head, nil)
+	if err != nil {
+		t.Fatalf("failed to trace calls: %v", err)
+	}
+	if len(results) != 2 || len(results[0]) != 1 || len(results[1]) != 2 {
+		t.Fatalf("result count mismatch: %v", results)
+	}
+	for i, block := range results {
+		for j, res := range block {
+			if res.Error != "" {
+				t.Fatalf("call %d/%d: trace failed: %v", i, j, res.Error)
+			}
+			if res.Result.(*ethapi.ExecutionResult).Failed {
+				t.Fatalf("call %d/%d: execution failed", i, j)
+			}
+		}
+	}
+	if have, want := results[1][1].Result.(*ethapi.ExecutionResult).ReturnValue, fmt.Sprintf("%064x", 0x539); have != want {
+		t.Errorf("block number override mismatch: have %s, want %s", have, want)
+	}
+}
+
 func TestTraceTransaction(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,323 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package native
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+)
+
+func init() {
+	tracers.RegisterNativeTracer("prestateTracer", newPrestateTracer)
+}
+
+// account is the state of a single account in the prestate, in the same format
+// as reported by prestate_tracer.js.
+type account struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// diffAccount is the state of a single account in diff mode, where only the
+// non-empty, respectively the modified fields are reported.
+type diffAccount struct {
+	Balance *hexutil.Big                `json:"balance,omitempty"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// stateDiff is the result of the prestate tracer in diff mode.
+type stateDiff struct {
+	Pre  map[common.Address]*diffAccount `json:"pre"`
+	Post map[common.Address]*diffAccount `json:"post"`
+}
+
+// prestateTracerConfig is the user supplied configuration of the prestate tracer.
+type prestateTracerConfig struct {
+	DiffMode bool `json:"diffMode"` // Whether to report the pre and post state of the touched accounts
+}
+
+// prestateTracer is a native Go implementation of prestate_tracer.js, which
+// outputs sufficient information to create a local execution of the transaction
+// from a custom assembled genesis block.
+//
+// In diff mode, the tracer instead reports the state of all the accounts and
+// storage slots modified by the transaction, both before and after it.
+type prestateTracer struct {
+	config   prestateTracerConfig
+	gasPrice *big.Int
+
+	env      *vm.EVM                     // EVM the traced transaction is running in
+	prestate map[common.Address]*account // Accounts accessed during execution, before any modification
+	create   bool                        // Whether the transaction is a contract creation
+	to       common.Address              // Recipient of the transaction, or the created contract
+
+	interrupt uint32 // Atomic flag to signal execution interruption
+	reason    error  // Textual reason for the interruption
+}
+
+// newPrestateTracer returns a native Go tracer which reports the state accessed
+// by a transaction prior to its execution, or in diff mode the state modified
+// by it.
+func newPrestateTracer(txCtx vm.TxContext, cfg json.RawMessage) (tracers.Tracer, error) {
+	var config prestateTracerConfig
+	if len(cfg) > 0 {
+		if err := json.Unmarshal(cfg, &config); err != nil {
+			return nil, err
+		}
+	}
+	gasPrice := new(big.Int)
+	if txCtx.GasPrice != nil {
+		gasPrice.Set(txCtx.GasPrice)
+	}
+	return &prestateTracer{
+		config:   config,
+		gasPrice: gasPrice,
+		prestate: make(map[common.Address]*account),
+	}, nil
+}
+
+// CaptureStart implements the vm.Tracer interface to initialize the tracing
+// operation. By the time it's called, the sender already paid for the gas, its
+// nonce is bumped and the value is transferred, so those are reverted here.
+func (t *prestateTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) error {
+	t.env, t.create, t.to = env, create, to
+
+	isHomestead := env.ChainConfig().IsHomestead(env.Context.BlockNumber)
+	isIstanbul := env.ChainConfig().IsIstanbul(env.Context.BlockNumber)
+	intrinsicGas, err := core.IntrinsicGas(input, nil, create, isHomestead, isIstanbul)
+	if err != nil {
+		return err
+	}
+	t.lookupAccount(from)
+	t.lookupAccount(to)
+	if t.config.DiffMode {
+		t.lookupAccount(env.Context.Coinbase)
+	}
+	toBal := (*big.Int)(t.prestate[to].Balance)
+	toBal.Sub(toBal, value)
+
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gas+intrinsicGas), t.gasPrice)
+	fromBal := (*big.Int)(t.prestate[from].Balance)
+	fromBal.Add(fromBal, value)
+	fromBal.Add(fromBal, fee)
+	t.prestate[from].Nonce--
+
+	// A created contract could not have existed before, as any existing state
+	// would have caused the transaction to be rejected as invalid.
+	if create {
+		t.prestate[to] = &account{Balance: new(hexutil.Big), Storage: make(map[common.Hash]common.Hash)}
+	}
+	return nil
+}
+
+// CaptureState implements the vm.Tracer interface to trace a single step of VM execution.
+func (t *prestateTracer) CaptureState(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, rData []byte, contract *vm.Contract, depth int, err error) error {
+	if err != nil || atomic.LoadUint32(&t.interrupt) > 0 {
+		return nil
+	}
+	// Whenever new state is accessed, add it to the prestate
+	switch op {
+	case vm.EXTCODECOPY, vm.EXTCODESIZE, vm.EXTCODEHASH, vm.BALANCE, vm.SELFDESTRUCT:
+		t.lookupAccount(common.Address(stack.Back(0).Bytes20()))
+
+	case vm.CREATE:
+		from := contract.Address()
+		t.lookupAccount(crypto.CreateAddress(from, env.StateDB.GetNonce(from)))
+
+	case vm.CREATE2:
+		// stack: endowment, offset, size, salt
+		begin, end := stackOffset(stack, 1, 2)
+		codeHash := crypto.Keccak256(memorySlice(memory, begin, end))
+		salt := stack.Back(3).Bytes32()
+		t.lookupAccount(crypto.CreateAddress2(contract.Address(), salt, codeHash))
+
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		t.lookupAccount(common.Address(stack.Back(1).Bytes20()))
+
+	case vm.SSTORE, vm.SLOAD:
+		t.lookupStorage(contract.Address(), common.Hash(stack.Back(0).Bytes32()))
+	}
+	return nil
+}
+
+// CaptureFault implements the vm.Tracer interface to trace an execution fault
+// while running an opcode.
+func (t *prestateTracer) CaptureFault(env *vm.EVM, pc uint64, op vm.OpCode, gas, cost uint64, memory *vm.Memory, stack *vm.Stack, rStack *vm.ReturnStack, contract *vm.Contract, depth int, err error) error {
+	return nil
+}
+
+// CaptureEnd is called after the call finishes to finalize the tracing.
+func (t *prestateTracer) CaptureEnd(output []byte, gasUsed uint64, elapsed time.Duration, err error) error {
+	return nil
+}
+
+// GetResult returns the json-encoded prestate, or in diff mode the pre and post
+// state of the modified accounts, and any error arising from the encoding or
+// forceful termination (via `Stop`).
+//
+// The post state is read from the state database when the result is requested,
+// so that it reflects the gas refunds and fees settled after the EVM execution.
+func (t *prestateTracer) GetResult() (json.RawMessage, error) {
+	var (
+		res []byte
+		err error
+	)
+	if t.config.DiffMode {
+		res, err = json.Marshal(t.diff())
+	} else {
+		// The created contract is not part of the prestate of the transaction
+		if t.create {
+			delete(t.prestate, t.to)
+		}
+		res, err = json.Marshal(t.prestate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(res), t.reason
+}
+
+// Stop terminates execution of the tracer at the first opportune moment.
+func (t *prestateTracer) Stop(err error) {
+	t.reason = err
+	atomic.StoreUint32(&t.interrupt, 1)
+}
+
+// diff assembles the state of the modified accounts before and after the traced
+// transaction. Untouched accounts and slots are omitted, as are the unmodified
+// fields of the post state. Destructed accounts have no post state.
+func (t *prestateTracer) diff() *stateDiff {
+	result := &stateDiff{
+		Pre:  make(map[common.Address]*diffAccount),
+		Post: make(map[common.Address]*diffAccount),
+	}
+	if t.env == nil {
+		return result
+	}
+	db := t.env.StateDB
+	for addr, pre := range t.prestate {
+		if db.HasSuicided(addr) {
+			if acc := newDiffAccount(pre); acc != nil {
+				result.Pre[addr] = acc
+			}
+			continue
+		}
+		var (
+			post     = new(diffAccount)
+			modified bool
+		)
+		if balance := db.GetBalance(addr); balance.Cmp((*big.Int)(pre.Balance)) != 0 {
+			post.Balance, modified = (*hexutil.Big)(new(big.Int).Set(balance)), true
+		}
+		if nonce := db.GetNonce(addr); nonce != pre.Nonce {
+			post.Nonce, modified = nonce, true
+		}
+		if code := db.GetCode(addr); !bytes.Equal(code, pre.Code) {
+			post.Code, modified = common.CopyBytes(code), true
+		}
+		for key, val := range pre.Storage {
+			if current := db.GetState(addr, key); current != val {
+				if post.Storage == nil {
+					post.Storage = make(map[common.Hash]common.Hash)
+				}
+				post.Storage[key], modified = current, true
+			}
+		}
+		if !modified {
+			continue
+		}
+		// Only report the slots changed in the pre state too
+		pre := newDiffAccount(pre)
+		if pre == nil {
+			pre = new(diffAccount)
+		}
+		for key := range pre.Storage {
+			if _, ok := post.Storage[key]; !ok {
+				delete(pre.Storage, key)
+			}
+		}
+		if len(pre.Storage) == 0 {
+			pre.Storage = nil
+		}
+		result.Pre[addr] = pre
+		result.Post[addr] = post
+	}
+	return result
+}
+
+// newDiffAccount converts a prestate account into its diff mode representation
+// with all empty fields omitted, returning nil if the account didn't exist.
+func newDiffAccount(acc *account) *diffAccount {
+	diff := &diffAccount{
+		Nonce: acc.Nonce,
+		Code:  acc.Code,
+	}
+	if (*big.Int)(acc.Balance).Sign() != 0 {
+		diff.Balance = acc.Balance
+	}
+	for key, val := range acc.Storage {
+		if val == (common.Hash{}) {
+			continue
+		}
+		if diff.Storage == nil {
+			diff.Storage = make(map[common.Hash]common.Hash)
+		}
+		diff.Storage[key] = val
+	}
+	if diff.Balance == nil && diff.Nonce == 0 && len(diff.Code) == 0 && diff.Storage == nil {
+		return nil
+	}
+	return diff
+}
+
+// lookupAccount injects the specified account into the prestate.
+func (t *prestateTracer) lookupAccount(addr common.Address) {
+	if _, ok := t.prestate[addr]; ok {
+		return
+	}
+	db := t.env.StateDB
+	t.prestate[addr] = &account{
+		Balance: (*hexutil.Big)(new(big.Int).Set(db.GetBalance(addr))),
+		Nonce:   db.GetNonce(addr),
+		Code:    common.CopyBytes(db.GetCode(addr)),
+		Storage: make(map[common.Hash]common.Hash),
+	}
+}
+
+// lookupStorage injects the specified storage entry of the given account into
+// the prestate.
+func (t *prestateTracer) lookupStorage(addr common.Address, key common.Hash) {
+	t.lookupAccount(addr)
+	if _, ok := t.prestate[addr].Storage[key]; ok {
+		return
+	}
+	t.prestate[addr].Storage[key] = t.env.StateDB.GetState(addr, key)
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package native is a collection of Go implementations of the built in
+// JavaScript tracers, registered with the tracers package on import.
+package native
+
+import (
+	"math"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// stackOffset interprets two stack items as the offset and size of a memory
+// region and returns the boundaries of it. Regions which cannot possibly fit
+// into memory are reported as reaching up to the maximum offset.
+func stackOffset(stack *vm.Stack, off, size int) (uint64, uint64) {
+	begin, length := stack.Back(off), stack.Back(size)
+	if !begin.IsUint64() || !length.IsUint64() || begin.Uint64() > math.MaxUint64-length.Uint64() {
+		return 0, math.MaxUint64
+	}
+	return begin.Uint64(), begin.Uint64() + length.Uint64()
+}
+
+// memorySlice returns a copy of the requested range of memory, or nil if the
+// range is out of bounds.
+func memorySlice(memory *vm.Memory, begin, end uint64) []byte {
+	if end == begin {
+		return []byte{}
+	}
+	if end < begin || uint64(memory.Len()) < end {
+		return nil
+	}
+	return memory.GetCopy(int64(begin), int64(end-begin))
+}
@@ -14,19 +14,41 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-// Package tracers is a collection of JavaScript transaction tracers.
+// Package tracers is a collection of JavaScript and native transaction tracers.
 package tracers
 
 import (
+	"encoding/json"
 	"strings"
 	"unicode"
 
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/eth/tracers/internal/tracers"
 )
 
+// Tracer interface extends vm.Tracer and additionally allows collecting the
+// tracing result and aborting the execution.
+type Tracer interface {
+	vm.Tracer
+
+	// GetResult returns the JSON encoded result of the trace, or any error
+	// accumulated during tracing.
+	GetResult() (json.RawMessage, error)
+
+	// Stop terminates execution of the tracer at the first opportune moment.
+	Stop(err error)
+}
+
 // all contains all the built in JavaScript tracers by name.
 var all = make(map[string]string)
 
+// NativeCtor is the constructor of a native Go tracer. The config is the raw
+// tracer specific configuration supplied by the user, which may be empty.
+type NativeCtor func(txCtx vm.TxContext, config json.RawMessage) (Tracer, error)
+
+// native contains all the registered Go tracer constructors by name.
+var native = make(map[string]NativeCtor)
+
 // camel converts a snake cased input string into a camel cased output.
 func camel(str string) string {
 	pieces := strings.Split(str, "_")
@@ -51,3 +73,27 @@ func tracer(name string) (string, bool) {
 	}
 	return "", false
 }
+
+// RegisterNativeTracer makes a Go tracer available by name. It is meant to be
+// called from the init function of the package implementing the tracer, and
+// panics if the name is already taken. A native tracer shadows the built in
+// JavaScript tracer of the same name.
+func RegisterNativeTracer(name string, ctor NativeCtor) {
+	if _, ok := native[name]; ok {
+		panic("tracer " + name + " already registered")
+	}
+	native[name] = ctor
+}
+
+// New instantiates a new tracer instance. Native tracers are looked up first:
+// if code is the name of a registered native tracer, that is returned,
+// configured with the given config. Otherwise code is either the name of one
+// of the built in JavaScript tracers, or a Javascript snippet which must
+// evaluate to an expression returning an object with 'step', 'fault' and
+// 'result' functions. JavaScript tracers ignore the config.
+func New(code string, txCtx vm.TxContext, config json.RawMessage) (Tracer, error) {
+	if ctor, ok := native[code]; ok {
+		return ctor(txCtx, config)
+	}
+	return newJsTracer(code, txCtx)
+}
@@ -14,12 +14,14 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
-package tracers
+package tracers_test
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"math/big"
 	"path/filepath"
@@ -35,6 +37,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	jstracers "github.com/ethereum/go-ethereum/eth/tracers/internal/tracers"
+	_ "github.com/ethereum/go-ethereum/eth/tracers/native"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/tests"
@@ -104,6 +109,14 @@ type callTrace struct {
 	Calls   []callTrace     `json:"calls,omitempty"`
 }
 
+// prestateAccount is a single account reported by the prestate tracer.
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   uint64                      `json:"nonce"`
+	Code    hexutil.Bytes               `json:"code"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
 type callContext struct {
 	Number     math.HexOrDecimal64   `json:"number"`
 	Difficulty *math.HexOrDecimal256 `json:"difficulty"`
@@ -121,6 +134,54 @@ type callTracerTest struct {
 }
 
 func TestPrestateTracerCreate2(t *testing.T) {
+	for name, tracer := range map[string]string{"js": jsTracer("prestate_tracer.js"), "native": "prestateTracer"} {
+		res, _ := runCreate2Test(t, tracer, nil)
+
+		ret := make(map[string]interface{})
+		if err := json.Unmarshal(res, &ret); err != nil {
+			t.Fatalf("failed to unmarshal trace result: %v", err)
+		}
+		if _, has := ret["0x60f3f640a8508fc6a86d45df051962668e1e8ac7"]; !has {
+			t.Fatalf("%s: expected 0x60f3f640a8508fc6a86d45df051962668e1e8ac7 in result", name)
+		}
+	}
+}
+
+func TestPrestateTracerDiffMode(t *testing.T) {
+	res, origin := runCreate2Test(t, "prestateTracer", json.RawMessage(`{"diffMode": true}`))
+
+	ret := new(struct {
+		Pre  map[common.Address]*prestateAccount `json:"pre"`
+		Post map[common.Address]*prestateAccount `json:"post"`
+	})
+	if err := json.Unmarshal(res, ret); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	// Both the sender and the CREATE2 caller bumped their nonces
+	for _, addr := range []common.Address{origin, common.HexToAddress("0x00000000000000000000000000000000deadbeef")} {
+		if ret.Pre[addr] == nil || ret.Pre[addr].Nonce != 1 {
+			t.Errorf("account %x: missing or invalid pre state: %+v", addr, ret.Pre[addr])
+		}
+		if ret.Post[addr] == nil || ret.Post[addr].Nonce != 2 {
+			t.Errorf("account %x: missing or invalid post state: %+v", addr, ret.Post[addr])
+		}
+	}
+	// The sender paid the fee to the coinbase
+	if pre, post := ret.Pre[origin], ret.Post[origin]; pre == nil || post == nil || post.Balance == nil || (*big.Int)(post.Balance).Cmp((*big.Int)(pre.Balance)) >= 0 {
+		t.Errorf("sender balance not decreased: pre %+v, post %+v", pre, post)
+	}
+	if post := ret.Post[common.Address{}]; post == nil || post.Balance == nil || (*big.Int)(post.Balance).Sign() == 0 {
+		t.Errorf("coinbase balance not increased: %+v", post)
+	}
+	// The code of the CREATE2 caller is untouched, so it's only in the pre state
+	if len(ret.Post[common.HexToAddress("0x00000000000000000000000000000000deadbeef")].Code) != 0 {
+		t.Errorf("unmodified code reported in post state")
+	}
+}
+
+// runCreate2Test executes a transaction invoking CREATE2 with the given tracer,
+// returning the trace result and the sender of the transaction.
+func runCreate2Test(t *testing.T, tracerName string, config json.RawMessage) (json.RawMessage, common.Address) {
 	unsignedTx := types.NewTransaction(1, common.HexToAddress("0x00000000000000000000000000000000deadbeef"),
 		new(big.Int), 5000000, big.NewInt(1), []byte{})
 
@@ -173,9 +234,9 @@ func TestPrestateTracerCreate2(t *testing.T) {
 	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
 
 	// Create the tracer, the EVM environment and run it
-	tracer, err := New("prestateTracer", txContext)
+	tracer, err := tracers.New(tracerName, txContext, config)
 	if err != nil {
-		t.Fatalf("failed to create call tracer: %v", err)
+		t.Fatalf("failed to create %s: %v", tracerName, err)
 	}
 	evm := vm.NewEVM(context, txContext, statedb, params.MainnetChainConfig, vm.Config{Debug: true, Tracer: tracer})
 
@@ -187,23 +248,42 @@ func TestPrestateTracerCreate2(t *testing.T) {
 	if _, err = st.TransitionDb(); err != nil {
 		t.Fatalf("failed to execute transaction: %v", err)
 	}
-	// Retrieve the trace result and compare against the etalon
 	res, err := tracer.GetResult()
 	if err != nil {
 		t.Fatalf("failed to retrieve trace result: %v", err)
 	}
-	ret := make(map[string]interface{})
-	if err := json.Unmarshal(res, &ret); err != nil {
-		t.Fatalf("failed to unmarshal trace result: %v", err)
-	}
-	if _, has := ret["0x60f3f640a8508fc6a86d45df051962668e1e8ac7"]; !has {
-		t.Fatalf("Expected 0x60f3f640a8508fc6a86d45df051962668e1e8ac7 in result")
-	}
+	return res, origin
 }
 
 // Iterates over all the input-output datasets in the tracer test harness and
-// runs the JavaScript tracers against them.
+// runs the JavaScript and the native call tracers against them.
 func TestCallTracer(t *testing.T) {
+	testCallTracer(jsTracer("call_tracer.js"), t)
+}
+
+func TestCallTracerNative(t *testing.T) {
+	testCallTracer("callTracer", t)
+}
+
+// Tests that the native tracers take precedence over the JavaScript tracers of
+// the same name.
+func TestNativeTracerLookup(t *testing.T) {
+	tracer, err := tracers.New("callTracer", vm.TxContext{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create callTracer: %v", err)
+	}
+	if typ := fmt.Sprintf("%T", tracer); typ != "*native.callTracer" {
+		t.Fatalf("tracer type mismatch: have %s, want *native.callTracer", typ)
+	}
+}
+
+// jsTracer returns the source of a built in JavaScript tracer, which is shadowed
+// by the native tracer of the same name when looked up by name.
+func jsTracer(file string) string {
+	return string(jstracers.MustAsset(file))
+}
+
+func testCallTracer(tracerName string, t *testing.T) {
 	files, err := ioutil.ReadDir("testdata")
 	if err != nil {
 		t.Fatalf("failed to retrieve tracer test suite: %v", err)
@@ -213,65 +293,17 @@ func TestCallTracer(t *testing.T) {
 			continue
 		}
 		file := file // capture range variable
-		t.Run(camel(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json")), func(t *testing.T) {
+		t.Run(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json"), func(t *testing.T) {
 			t.Parallel()
 
-			// Call tracer test found, read if from disk
-			blob, err := ioutil.ReadFile(filepath.Join("testdata", file.Name()))
-			if err != nil {
-				t.Fatalf("failed to read testcase: %v", err)
-			}
-			test := new(callTracerTest)
-			if err := json.Unmarshal(blob, test); err != nil {
-				t.Fatalf("failed to parse testcase: %v", err)
-			}
-			// Configure a blockchain with the given prestate
-			tx := new(types.Transaction)
-			if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
-				t.Fatalf("failed to parse testcase input: %v", err)
-			}
-			signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
-			origin, _ := signer.Sender(tx)
-			txContext := vm.TxContext{
-				Origin:   origin,
-				GasPrice: tx.GasPrice(),
-			}
-			context := vm.BlockContext{
-				CanTransfer: core.CanTransfer,
-				Transfer:    core.Transfer,
-				Coinbase:    test.Context.Miner,
-				BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
-				Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
-				Difficulty:  (*big.Int)(test.Context.Difficulty),
-				GasLimit:    uint64(test.Context.GasLimit),
-			}
-			_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
-
-			// Create the tracer, the EVM environment and run it
-			tracer, err := New("callTracer", txContext)
-			if err != nil {
-				t.Fatalf("failed to create call tracer: %v", err)
-			}
-			evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+			test := loadCallTracerTest(t, file.Name())
+			res := runCallTracerTest(t, test, tracerName, nil)
 
-			msg, err := tx.AsMessage(signer)
-			if err != nil {
-				t.Fatalf("failed to prepare transaction for tracing: %v", err)
-			}
-			st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
-			if _, err = st.TransitionDb(); err != nil {
-				t.Fatalf("failed to execute transaction: %v", err)
-			}
-			// Retrieve the trace result and compare against the etalon
-			res, err := tracer.GetResult()
-			if err != nil {
-				t.Fatalf("failed to retrieve trace result: %v", err)
-			}
+			// Compare the trace result against the etalon
 			ret := new(callTrace)
 			if err := json.Unmarshal(res, ret); err != nil {
 				t.Fatalf("failed to unmarshal trace result: %v", err)
 			}
-
 			if !jsonEqual(ret, test.Result) {
 				// uncomment this for easier debugging
 				//have, _ := json.MarshalIndent(ret, "", " ")
@@ -283,6 +315,220 @@ func TestCallTracer(t *testing.T) {
 	}
 }
 
+// Iterates over all the input-output datasets in the tracer test harness and
+// runs the native prestate and 4byte tracers against them.
+func TestNativeTracers(t *testing.T) {
+	files, err := ioutil.ReadDir("testdata")
+	if err != nil {
+		t.Fatalf("failed to retrieve tracer test suite: %v", err)
+	}
+	for _, file := range files {
+		if !strings.HasPrefix(file.Name(), "call_tracer_") {
+			continue
+		}
+		file := file // capture range variable
+		t.Run(strings.TrimSuffix(strings.TrimPrefix(file.Name(), "call_tracer_"), ".json"), func(t *testing.T) {
+			t.Parallel()
+
+			test := loadCallTracerTest(t, file.Name())
+
+			// The 4byte tracer must produce the same output as the JavaScript one
+			var (
+				want = make(map[string]int)
+				have = make(map[string]int)
+			)
+			if err := json.Unmarshal(runCallTracerTest(t, test, jsTracer("4byte_tracer.js"), nil), &want); err != nil {
+				t.Fatalf("failed to unmarshal JavaScript 4byte trace: %v", err)
+			}
+			if err := json.Unmarshal(runCallTracerTest(t, test, "4byteTracer", nil), &have); err != nil {
+				t.Fatalf("failed to unmarshal native 4byte trace: %v", err)
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Fatalf("4byte trace mismatch: \nhave %+v\nwant %+v", have, want)
+			}
+			// The prestate tracer must produce the same output as the JavaScript one
+			var (
+				jsPrestate     = make(map[common.Address]*prestateAccount)
+				nativePrestate = make(map[common.Address]*prestateAccount)
+			)
+			if err := json.Unmarshal(runCallTracerTest(t, test, jsTracer("prestate_tracer.js"), nil), &jsPrestate); err != nil {
+				t.Fatalf("failed to unmarshal JavaScript prestate trace: %v", err)
+			}
+			if err := json.Unmarshal(runCallTracerTest(t, test, "prestateTracer", nil), &nativePrestate); err != nil {
+				t.Fatalf("failed to unmarshal native prestate trace: %v", err)
+			}
+			// The JavaScript tracer reconstructs the balance of the sender from the
+			// post state, which is inaccurate for failed calls (e.g. the refunded
+			// value of a reverted transaction is added back), so the sender is
+			// checked against the genesis instead
+			tx, sender := callTracerTestTx(t, test)
+			jsPrestate[sender].Balance = genesisAccount(test.Genesis.Alloc, sender).Balance
+
+			if len(nativePrestate) != len(jsPrestate) {
+				t.Fatalf("prestate account count mismatch: have %d, want %d", len(nativePrestate), len(jsPrestate))
+			}
+			for addr, want := range jsPrestate {
+				if have := nativePrestate[addr]; have == nil {
+					t.Errorf("account %x: missing from prestate", addr)
+				} else {
+					comparePrestateAccount(t, addr, have, want)
+				}
+			}
+			// In diff mode, the pre state must match the JavaScript prestate for the
+			// modified accounts and slots, with the empty fields omitted
+			diff := new(struct {
+				Pre  map[common.Address]*prestateAccount `json:"pre"`
+				Post map[common.Address]*prestateAccount `json:"post"`
+			})
+			if err := json.Unmarshal(runCallTracerTest(t, test, "prestateTracer", json.RawMessage(`{"diffMode": true}`)), diff); err != nil {
+				t.Fatalf("failed to unmarshal prestate diff: %v", err)
+			}
+			if len(diff.Pre) == 0 {
+				t.Fatalf("empty prestate diff")
+			}
+			for addr, have := range diff.Pre {
+				full := jsPrestate[addr]
+				if full == nil {
+					// Only the coinbase and the created contract are reported in diff
+					// mode alone, their pre state is the one in the genesis
+					if addr != test.Context.Miner && (tx.To() != nil || addr != crypto.CreateAddress(sender, tx.Nonce())) {
+						t.Errorf("account %x: diff pre state not in JavaScript prestate", addr)
+						continue
+					}
+					full = genesisAccount(test.Genesis.Alloc, addr)
+				}
+				want := &prestateAccount{Nonce: full.Nonce, Code: full.Code, Storage: make(map[common.Hash]common.Hash)}
+				if (*big.Int)(full.Balance).Sign() != 0 {
+					want.Balance = full.Balance
+				}
+				if post := diff.Post[addr]; post != nil {
+					for key := range post.Storage {
+						if val := full.Storage[key]; val != (common.Hash{}) {
+							want.Storage[key] = val
+						}
+					}
+				}
+				comparePrestateAccount(t, addr, have, want)
+			}
+		})
+	}
+}
+
+// callTracerTestTx returns the transaction of a call tracer test case along with
+// its sender.
+func callTracerTestTx(t *testing.T, test *callTracerTest) (*types.Transaction, common.Address) {
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	sender, err := signer.Sender(tx)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	return tx, sender
+}
+
+// genesisAccount converts an account of the genesis into the format reported
+// by the prestate tracer.
+func genesisAccount(alloc core.GenesisAlloc, addr common.Address) *prestateAccount {
+	acc := alloc[addr]
+	res := &prestateAccount{
+		Balance: new(hexutil.Big),
+		Nonce:   acc.Nonce,
+		Code:    acc.Code,
+		Storage: acc.Storage,
+	}
+	if acc.Balance != nil {
+		res.Balance = (*hexutil.Big)(acc.Balance)
+	}
+	return res
+}
+
+// comparePrestateAccount checks that an account reported by the prestate tracer
+// matches the expected one.
+func comparePrestateAccount(t *testing.T, addr common.Address, have, want *prestateAccount) {
+	t.Helper()
+
+	if (have.Balance == nil) != (want.Balance == nil) || (have.Balance != nil && (*big.Int)(have.Balance).Cmp((*big.Int)(want.Balance)) != 0) {
+		t.Errorf("account %x: balance mismatch: have %v, want %v", addr, have.Balance, want.Balance)
+	}
+	if have.Nonce != want.Nonce {
+		t.Errorf("account %x: nonce mismatch: have %d, want %d", addr, have.Nonce, want.Nonce)
+	}
+	if !bytes.Equal(have.Code, want.Code) {
+		t.Errorf("account %x: code mismatch: have %x, want %x", addr, have.Code, want.Code)
+	}
+	if len(have.Storage) != len(want.Storage) {
+		t.Errorf("account %x: slot count mismatch: have %d, want %d", addr, len(have.Storage), len(want.Storage))
+	}
+	for key, val := range want.Storage {
+		if have.Storage[key] != val {
+			t.Errorf("account %x: slot %x mismatch: have %x, want %x", addr, key, have.Storage[key], val)
+		}
+	}
+}
+
+// loadCallTracerTest reads a call tracer test case from the testdata folder.
+func loadCallTracerTest(t *testing.T, name string) *callTracerTest {
+	blob, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read testcase: %v", err)
+	}
+	test := new(callTracerTest)
+	if err := json.Unmarshal(blob, test); err != nil {
+		t.Fatalf("failed to parse testcase: %v", err)
+	}
+	return test
+}
+
+// runCallTracerTest executes the transaction of a call tracer test case on top
+// of its prestate with the given tracer, returning the trace result.
+func runCallTracerTest(t *testing.T, test *callTracerTest, tracerName string, config json.RawMessage) json.RawMessage {
+	// Configure a blockchain with the given prestate
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(common.FromHex(test.Input), tx); err != nil {
+		t.Fatalf("failed to parse testcase input: %v", err)
+	}
+	signer := types.MakeSigner(test.Genesis.Config, new(big.Int).SetUint64(uint64(test.Context.Number)))
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: tx.GasPrice(),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    test.Context.Miner,
+		BlockNumber: new(big.Int).SetUint64(uint64(test.Context.Number)),
+		Time:        new(big.Int).SetUint64(uint64(test.Context.Time)),
+		Difficulty:  (*big.Int)(test.Context.Difficulty),
+		GasLimit:    uint64(test.Context.GasLimit),
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), test.Genesis.Alloc, false)
+
+	// Create the tracer, the EVM environment and run it
+	tracer, err := tracers.New(tracerName, txContext, config)
+	if err != nil {
+		t.Fatalf("failed to create %s: %v", tracerName, err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, test.Genesis.Config, vm.Config{Debug: true, Tracer: tracer})
+
+	msg, err := tx.AsMessage(signer)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return res
+}
+
 // jsonEqual is similar to reflect.DeepEqual, but does a 'bounce' via json prior to
 // comparison
 func jsonEqual(x, y interface{}) bool {
@@ -256,6 +256,9 @@ func TestEthClient(t *testing.T) {
 		"TestGetBlock": {
 			func(t *testing.T) { testGetBlock(t, client) },
 		},
+		"TestBlockReceipts": {
+			func(t *testing.T) { testBlockReceipts(t, chain, client) },
+		},
 		"TestStatusFunctions": {
 			func(t *testing.T) { testStatusFunctions(t, client) },
 		},
@@ -432,6 +435,30 @@ func testGetBlock(t *testing.T, client *rpc.Client) {
 	}
 }
 
+func testBlockReceipts(t *testing.T, chain []*types.Block, client *rpc.Client) {
+	ec := NewClient(client)
+
+	// Receipts of an existing block, both by number and by hash
+	for i, arg := range []rpc.BlockNumberOrHash{
+		rpc.BlockNumberOrHashWithNumber(1),
+		rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber),
+		rpc.BlockNumberOrHashWithHash(chain[1].Hash(), false),
+		rpc.BlockNumberOrHashWithHash(chain[1].Hash(), true),
+	} {
+		receipts, err := ec.BlockReceipts(context.Background(), arg)
+		if err != nil {
+			t.Fatalf("BlockReceipts #%d: unexpected error: %v", i, err)
+		}
+		if receipts == nil || len(receipts) != len(chain[1].Transactions()) {
+			t.Fatalf("BlockReceipts #%d: receipt count mismatch: have %v, want %d", i, receipts, len(chain[1].Transactions()))
+		}
+	}
+	// Receipts of a missing block
+	if _, err := ec.BlockReceipts(context.Background(), rpc.BlockNumberOrHashWithNumber(1000000000)); err != ethereum.NotFound {
+		t.Fatalf("BlockReceipts error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+}
+
 func testStatusFunctions(t *testing.T, client *rpc.Client) {
 	ec := NewClient(client)
 
@@ -459,6 +486,22 @@ func testStatusFunctions(t *testing.T, client *rpc.Client) {
 	if gasPrice.Cmp(big.NewInt(1000000000)) != 0 {
 		t.Fatalf("unexpected gas price: %v", gasPrice)
 	}
+	// FeeHistory (the blocks are empty)
+	history, err := ec.FeeHistory(context.Background(), 3, nil, []float64{25, 75})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if history.OldestBlock.Sign() != 0 {
+		t.Fatalf("unexpected oldest block: %v", history.OldestBlock)
+	}
+	if len(history.GasUsedRatio) != 2 || len(history.Reward) != 2 {
+		t.Fatalf("unexpected fee history length: %d ratios, %d rewards", len(history.GasUsedRatio), len(history.Reward))
+	}
+	for i, reward := range history.Reward {
+		if len(reward) != 2 || reward[0].Sign() != 0 || reward[1].Sign() != 0 {
+			t.Fatalf("unexpected rewards for block %d: %v", i, reward)
+		}
+	}
 }
 
 func testCallContract(t *testing.T, client *rpc.Client) {
@@ -479,6 +522,17 @@ func testCallContract(t *testing.T, client *rpc.Client) {
 	if gas != 21000 {
 		t.Fatalf("unexpected gas price: %v", gas)
 	}
+	// CreateAccessList
+	acl, gasUsed, vmErr, err := ec.CreateAccessList(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if acl == nil || len(*acl) != 0 {
+		t.Fatalf("unexpected access list: %v", acl)
+	}
+	if gasUsed != 21000 || vmErr != "" {
+		t.Fatalf("unexpected access list execution: gas %d, err %q", gasUsed, vmErr)
+	}
 	// CallContract
 	if _, err := ec.CallContract(context.Background(), msg, big.NewInt(1)); err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -25,8 +25,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/node"
@@ -127,6 +130,12 @@ func TestGraphQLBlockSerialization(t *testing.T) {
 			want: `{"errors":[{"message":"Cannot query field \"bleh\" on type \"Query\".","locations":[{"line":1,"column":2}]}]}`,
 			code: 400,
 		},
+		// should return the receipts of all transactions in the block
+		{
+			body: `{"query": "{block(number:1){receipts{status,gasUsed,transaction{hash}}}}"}`,
+			want: `{"data":{"block":{"receipts":[]}}}`,
+			code: 200,
+		},
 		// should return `estimateGas` as decimal
 		{
 			body: `{"query": "{block{ estimateGas(data:{}) }}"}`,
@@ -157,6 +166,40 @@ func TestGraphQLBlockSerialization(t *testing.T) {
 	}
 }
 
+// Tests that the receipts of a block with transactions are served in order,
+// along with their transactions and logs.
+func TestGraphQLBlockReceipts(t *testing.T) {
+	stack := createNode(t, false)
+	defer stack.Close()
+	chain := createGQLServiceWithTransactions(t, stack)
+
+	// start node
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	txs := chain[0].Transactions()
+	body := `{"query": "{block(number:1){receipts{status,gasUsed,cumulativeGasUsed,transaction{hash},logs{index}}}}"}`
+	want := fmt.Sprintf(`{"data":{"block":{"receipts":[`+
+		`{"status":1,"gasUsed":21000,"cumulativeGasUsed":21000,"transaction":{"hash":"%s"},"logs":[]},`+
+		`{"status":1,"gasUsed":21000,"cumulativeGasUsed":42000,"transaction":{"hash":"%s"},"logs":[]}]}}}`,
+		txs[0].Hash().Hex(), txs[1].Hash().Hex())
+
+	resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("could not post: %v", err)
+	}
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("could not read from response body: %v", err)
+	}
+	if have := string(bodyBytes); have != want {
+		t.Errorf("receipts mismatch,\nhave:\n%v\nwant:\n%v", have, want)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("wrong statuscode, have: %v, want: %v", resp.StatusCode, http.StatusOK)
+	}
+}
+
 // Tests that a graphQL request is not handled successfully when graphql is not enabled on the specified endpoint
 func TestGraphQLHTTPOnSamePort_GQLRequest_Unsuccessful(t *testing.T) {
 	stack := createNode(t, false)
@@ -226,3 +269,62 @@ func createGQLService(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
 }
+
+// createGQLServiceWithTransactions creates a graphql service on top of a chain
+// whose first block contains two value transfers, returning the imported blocks.
+func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) []*types.Block {
+	// create backend
+	key, _ := crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	funds := big.NewInt(1000000000)
+	ethConf := &ethconfig.Config{
+		Genesis: &core.Genesis{
+			Config:     params.AllEthashProtocolChanges,
+			GasLimit:   11500000,
+			Difficulty: big.NewInt(1048576),
+			Alloc:      core.GenesisAlloc{address: {Balance: funds}},
+		},
+		Ethash: ethash.Config{
+			PowMode: ethash.ModeFake,
+		},
+		NetworkId:               1337,
+		TrieCleanCache:          5,
+		TrieCleanCacheJournal:   "triecache",
+		TrieCleanCacheRejournal: 60 * time.Minute,
+		TrieDirtyCache:          5,
+		TrieTimeout:             60 * time.Minute,
+		SnapshotCache:           5,
+	}
+	ethBackend, err := eth.New(stack, ethConf)
+	if err != nil {
+		t.Fatalf("could not create eth backend: %v", err)
+	}
+	// Create some blocks and import them
+	signer := types.LatestSigner(params.AllEthashProtocolChanges)
+	chain, _ := core.GenerateChain(params.AllEthashProtocolChanges, ethBackend.BlockChain().Genesis(),
+		ethash.NewFaker(), ethBackend.ChainDb(), 2, func(i int, gen *core.BlockGen) {
+			if i > 0 {
+				return
+			}
+			for nonce := uint64(0); nonce < 2; nonce++ {
+				tx := types.MustSignNewTx(key, signer, &types.LegacyTx{
+					Nonce:    nonce,
+					To:       &common.Address{0xaa},
+					Value:    big.NewInt(1),
+					Gas:      params.TxGas,
+					GasPrice: big.NewInt(1),
+				})
+				gen.AddTx(tx)
+			}
+		})
+	_, err = ethBackend.BlockChain().InsertChain(chain)
+	if err != nil {
+		t.Fatalf("could not create import blocks: %v", err)
+	}
+	// create gql service
+	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	if err != nil {
+		t.Fatalf("could not create graphql service: %v", err)
+	}
+	return chain
+}
@@ -180,6 +180,14 @@ type GasPricer interface {
 	SuggestGasPrice(ctx context.Context) (*big.Int, error)
 }
 
+// FeeHistory is the gas price history of a range of blocks, with the gas used
+// ratio of each block and the requested percentiles of the gas prices paid.
+type FeeHistory struct {
+	OldestBlock  *big.Int     // Number of the first block of the range
+	Reward       [][]*big.Int // Gas prices at the requested percentiles of each block
+	GasUsedRatio []float64    // Ratio of the gas used to the gas limit of each block
+}
+
 // A PendingStateReader provides access to the pending state, which is the result of all
 // known executable transactions which have not yet been included in the blockchain. It is
 // commonly used to display the result of ’unconfirmed’ actions (e.g. wallet value
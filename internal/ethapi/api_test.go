@@ -0,0 +1,127 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// historyBackend implements the parts of Backend needed to look up transactions
+// in a database, the rest panic if called.
+type historyBackend struct {
+	Backend
+	db ethdb.Database
+}
+
+func (b *historyBackend) ChainDb() ethdb.Database { return b.db }
+
+func (b *historyBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+
+func (b *historyBackend) GetPoolTransaction(hash common.Hash) *types.Transaction { return nil }
+
+func (b *historyBackend) GetTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
+	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.db, hash)
+	return tx, blockHash, blockNumber, index, nil
+}
+
+func (b *historyBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	number := rawdb.ReadHeaderNumber(b.db, hash)
+	if number == nil {
+		return nil, nil
+	}
+	return rawdb.ReadReceipts(b.db, hash, *number, params.TestChainConfig), nil
+}
+
+// Tests that looking up the transactions of blocks with pruned history reports
+// the history as pruned.
+func TestTransactionHistoryPruned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), dir, "", nil)
+	if err != nil {
+		t.Fatalf("failed to create database with ancient backend: %v", err)
+	}
+	defer db.Close()
+
+	var (
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		signer  = types.LatestSigner(params.TestChainConfig)
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, 4, func(i int, gen *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(gen.TxNonce(addr), common.Address{0x1}, big.NewInt(1), params.TxGas, big.NewInt(1), nil), signer, key)
+		gen.AddTx(tx)
+	})
+	rawdb.WriteAncientBlock(db, genesis, nil, genesis.Difficulty())
+	for i, block := range blocks {
+		rawdb.WriteAncientBlock(db, block, receipts[i], block.Difficulty())
+		rawdb.WriteHeaderNumber(db, block.Hash(), block.NumberU64())
+		rawdb.WriteTxLookupEntriesByBlock(db, block)
+	}
+	if err := db.TruncateAncientTail(3); err != nil {
+		t.Fatalf("failed to prune history: %v", err)
+	}
+	api := NewPublicTransactionPoolAPI(&historyBackend{db: db}, nil)
+
+	// Transactions in pruned blocks should be reported as such
+	pruned := blocks[1].Transactions()[0].Hash()
+	if _, err := api.GetTransactionByHash(context.Background(), pruned); err == nil {
+		t.Error("pruned transaction: no error")
+	} else if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != 4444 {
+		t.Errorf("pruned transaction: error mismatch: have %v, want history pruned", err)
+	}
+	if _, err := api.GetTransactionReceipt(context.Background(), pruned); err == nil {
+		t.Error("pruned receipt: no error")
+	} else if rpcErr, ok := err.(rpc.Error); !ok || rpcErr.ErrorCode() != 4444 {
+		t.Errorf("pruned receipt: error mismatch: have %v, want history pruned", err)
+	}
+	// Transactions in retained blocks should be found, unknown ones not
+	retained := blocks[3].Transactions()[0].Hash()
+	if tx, err := api.GetTransactionByHash(context.Background(), retained); err != nil || tx == nil || tx.Hash != retained {
+		t.Errorf("retained transaction: have %v (err %v), want %x", tx, err, retained)
+	}
+	if receipt, err := api.GetTransactionReceipt(context.Background(), retained); err != nil || receipt == nil || receipt["transactionHash"] != retained {
+		t.Errorf("retained receipt: have %v (err %v), want %x", receipt, err, retained)
+	}
+	if tx, err := api.GetTransactionByHash(context.Background(), common.Hash{0x1}); err != nil || tx != nil {
+		t.Errorf("unknown transaction: have %v (err %v), want nil", tx, err)
+	}
+	if receipt, err := api.GetTransactionReceipt(context.Background(), common.Hash{0x1}); err != nil || receipt != nil {
+		t.Errorf("unknown receipt: have %v (err %v), want nil", receipt, err)
+	}
+}
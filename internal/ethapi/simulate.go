@@ -0,0 +1,332 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxSimulateBlocks is the maximum number of blocks that can be simulated
+	// in a single request.
+	maxSimulateBlocks = 256
+
+	// simulateTimeout is the time allowance for a whole simulation request.
+	simulateTimeout = 5 * time.Second
+)
+
+// SimBlock is a batch of calls to be executed sequentially in a single
+// simulated block, on top of the state left behind by the previous ones.
+type SimBlock struct {
+	BlockOverrides *BlockOverrides `json:"blockOverrides"`
+	StateOverrides *StateOverride  `json:"stateOverrides"`
+	Calls          []CallArgs      `json:"calls"`
+}
+
+// simCallResult is the outcome of a single simulated call.
+type simCallResult struct {
+	ReturnData   hexutil.Bytes  `json:"returnData"`
+	Logs         []*types.Log   `json:"logs"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	Status       hexutil.Uint64 `json:"status"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+}
+
+// simBlockResult is the outcome of a simulated block along with the results
+// of all the calls executed in it.
+type simBlockResult struct {
+	Number    hexutil.Uint64   `json:"number"`
+	Hash      common.Hash      `json:"hash"`
+	Timestamp hexutil.Uint64   `json:"timestamp"`
+	GasLimit  hexutil.Uint64   `json:"gasLimit"`
+	GasUsed   hexutil.Uint64   `json:"gasUsed"`
+	Coinbase  common.Address   `json:"miner"`
+	Calls     []*simCallResult `json:"calls"`
+}
+
+// Simulate executes a series of simulated blocks, each consisting of a list of
+// calls, on top of the state of the given block. State changes carry over from
+// one call to the next and from one block to the next, so a sequence of calls
+// can be previewed before any of them is signed. The results report the return
+// data, logs, gas used and revert reason of each call.
+//
+// Unless overridden, every simulated block is the child of the previous one,
+// with its number increased by one and its timestamp by one second.
+//
+// Note, this function doesn't make any changes in the state/blockchain.
+func (s *PublicBlockChainAPI) Simulate(ctx context.Context, blocks []SimBlock, blockNrOrHash *rpc.BlockNumberOrHash) ([]*simBlockResult, error) {
+	if len(blocks) == 0 {
+		return nil, errors.New("empty simulation request")
+	}
+	if len(blocks) > maxSimulateBlocks {
+		return nil, fmt.Errorf("too many blocks to simulate: %d > %d", len(blocks), maxSimulateBlocks)
+	}
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	return DoSimulate(ctx, s.b, blocks, bNrOrHash, simulateTimeout, s.b.RPCGasCap())
+}
+
+// DoSimulate executes the given simulated blocks on top of the state of the
+// requested block. Calls failing consensus checks (e.g. insufficient funds for
+// gas) are reported in their results and leave the state untouched, just like
+// reverted calls, while timeouts and invalid blocks abort the whole simulation.
+func DoSimulate(ctx context.Context, b Backend, blocks []SimBlock, blockNrOrHash rpc.BlockNumberOrHash, timeout time.Duration, globalGasCap uint64) ([]*simBlockResult, error) {
+	defer func(start time.Time) { log.Debug("Executing EVM simulation finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, base, err := b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	// Setup context so it may be cancelled the simulation has completed
+	// or, in case of unmetered gas, setup a context with a timeout.
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	// Make sure the context is cancelled when the simulation has completed
+	// this makes sure resources are cleaned up.
+	defer cancel()
+
+	// Wait for the context to be done and cancel the EVM of the running call.
+	// Calls started afterwards are aborted by checking the context instead.
+	var (
+		evmLock sync.Mutex
+		running *vm.EVM
+	)
+	go func() {
+		<-ctx.Done()
+
+		evmLock.Lock()
+		defer evmLock.Unlock()
+		if running != nil {
+			running.Cancel()
+		}
+	}()
+
+	var (
+		chain   = newSimChain(ctx, b, base)
+		parent  = base
+		results = make([]*simBlockResult, 0, len(blocks))
+	)
+	for i, block := range blocks {
+		header, err := block.BlockOverrides.makeHeader(parent)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		if err := block.StateOverrides.Apply(state); err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		var (
+			hash     = header.Hash()
+			gp       = new(core.GasPool).AddGas(header.GasLimit)
+			logIndex uint
+			result   = &simBlockResult{
+				Number:    hexutil.Uint64(header.Number.Uint64()),
+				Hash:      hash,
+				Timestamp: hexutil.Uint64(header.Time),
+				GasLimit:  hexutil.Uint64(header.GasLimit),
+				Coinbase:  header.Coinbase,
+				Calls:     make([]*simCallResult, 0, len(block.Calls)),
+			}
+		)
+		chain.hashes[header.Number.Uint64()] = hash
+
+		for j, args := range block.Calls {
+			// Unless specified, let the call use up all the gas left in the block
+			if args.Gas == nil {
+				gas := hexutil.Uint64(gp.Gas())
+				args.Gas = &gas
+			}
+			msg := args.ToMessage(globalGasCap)
+			msg = types.NewMessage(msg.From(), msg.To(), state.GetNonce(msg.From()), msg.Value(), msg.Gas(), msg.GasPrice(), msg.Data(), msg.AccessList(), false)
+
+			// Derive a pseudo transaction hash to tag the logs of the call with
+			txHash := types.NewTx(&types.LegacyTx{
+				Nonce:    msg.Nonce(),
+				GasPrice: msg.GasPrice(),
+				Gas:      msg.Gas(),
+				To:       msg.To(),
+				Value:    msg.Value(),
+				Data:     msg.Data(),
+			}).Hash()
+			state.Prepare(txHash, hash, j)
+
+			evm, vmError, err := b.GetEVM(ctx, msg, state, header, nil)
+			if err != nil {
+				return nil, err
+			}
+			evm.Context.GetHash = chain.getHash
+
+			evmLock.Lock()
+			running = evm
+			evmLock.Unlock()
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+			}
+			var (
+				snap = state.Snapshot()
+				gas  = gp.Gas()
+			)
+			res, err := core.ApplyMessage(evm, msg, gp)
+			if err := vmError(); err != nil {
+				return nil, err
+			}
+			// If the timer caused an abort, return an appropriate error message
+			if evm.Cancelled() {
+				return nil, fmt.Errorf("execution aborted (timeout = %v)", timeout)
+			}
+			if err != nil {
+				// The call is invalid, undo any partial charges and report it
+				state.RevertToSnapshot(snap)
+				*gp = core.GasPool(gas)
+
+				result.Calls = append(result.Calls, &simCallResult{
+					ReturnData: hexutil.Bytes{},
+					Logs:       []*types.Log{},
+					Status:     hexutil.Uint64(types.ReceiptStatusFailed),
+					Error:      fmt.Sprintf("%v (supplied gas %d)", err, msg.Gas()),
+				})
+				continue
+			}
+			state.Finalise(true)
+
+			call := &simCallResult{
+				ReturnData: res.ReturnData,
+				Logs:       state.GetLogs(txHash),
+				GasUsed:    hexutil.Uint64(res.UsedGas),
+				Status:     hexutil.Uint64(types.ReceiptStatusSuccessful),
+			}
+			if call.Logs == nil {
+				call.Logs = []*types.Log{}
+			}
+			// Number the logs within the simulated block, not the whole simulation
+			for _, l := range call.Logs {
+				l.BlockNumber = header.Number.Uint64()
+				l.Index = logIndex
+				logIndex++
+			}
+			if res.Failed() {
+				call.Status = hexutil.Uint64(types.ReceiptStatusFailed)
+				call.Error = res.Err.Error()
+				if len(res.Revert()) > 0 {
+					if reason, err := abi.UnpackRevert(res.Revert()); err == nil {
+						call.RevertReason = reason
+					}
+					call.Error = newRevertError(res).Error()
+				}
+			}
+			result.GasUsed += call.GasUsed
+			result.Calls = append(result.Calls, call)
+		}
+		results = append(results, result)
+		parent = header
+	}
+	return results, nil
+}
+
+// makeHeader creates the header of a simulated block on top of the given
+// parent, with the fields set in the overrides applied.
+func (o *BlockOverrides) makeHeader(parent *types.Header) (*types.Header, error) {
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   parent.Coinbase,
+		Difficulty: new(big.Int).Set(parent.Difficulty),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + 1,
+	}
+	if o == nil {
+		return header, nil
+	}
+	if o.Number != nil {
+		if o.Number.ToInt().Cmp(parent.Number) <= 0 {
+			return nil, fmt.Errorf("block number %v not above parent %v", o.Number.ToInt(), parent.Number)
+		}
+		header.Number = new(big.Int).Set(o.Number.ToInt())
+	}
+	if o.Difficulty != nil {
+		header.Difficulty = new(big.Int).Set(o.Difficulty.ToInt())
+	}
+	if o.Time != nil {
+		if !o.Time.ToInt().IsUint64() || o.Time.ToInt().Uint64() < parent.Time {
+			return nil, fmt.Errorf("block timestamp %v before parent %d", o.Time.ToInt(), parent.Time)
+		}
+		header.Time = o.Time.ToInt().Uint64()
+	}
+	if o.GasLimit != nil {
+		header.GasLimit = uint64(*o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		header.Coinbase = *o.Coinbase
+	}
+	return header, nil
+}
+
+// simChain resolves the block hashes accessible to the simulated calls: the
+// ones of the simulated blocks and the ones of the chain they're built on.
+type simChain struct {
+	ctx    context.Context
+	b      Backend
+	oldest *types.Header          // Oldest chain header resolved so far
+	hashes map[uint64]common.Hash // Hashes of simulated and resolved chain blocks
+}
+
+// newSimChain creates a block hash resolver for blocks simulated on top of base.
+func newSimChain(ctx context.Context, b Backend, base *types.Header) *simChain {
+	return &simChain{
+		ctx:    ctx,
+		b:      b,
+		oldest: base,
+		hashes: map[uint64]common.Hash{base.Number.Uint64(): base.Hash()},
+	}
+}
+
+// getHash returns the hash of the n'th block, walking back the chain from the
+// simulation base if needed. It's used as the GetHash function of the EVM.
+func (c *simChain) getHash(n uint64) common.Hash {
+	if hash, ok := c.hashes[n]; ok {
+		return hash
+	}
+	for c.oldest.Number.Uint64() > n {
+		header, err := c.b.HeaderByHash(c.ctx, c.oldest.ParentHash)
+		if header == nil || err != nil {
+			return common.Hash{}
+		}
+		c.oldest = header
+		c.hashes[header.Number.Uint64()] = header.Hash()
+	}
+	return c.hashes[n]
+}
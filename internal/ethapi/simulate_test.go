@@ -0,0 +1,190 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simBackend implements the parts of Backend needed by the simulation on top
+// of a local chain, the rest panic if called.
+type simBackend struct {
+	Backend
+	chain *core.BlockChain
+}
+
+func (b *simBackend) RPCGasCap() uint64 { return 25000000 }
+
+func (b *simBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *simBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	header := b.chain.CurrentHeader()
+	if number, ok := blockNrOrHash.Number(); ok && number >= 0 {
+		header = b.chain.GetHeaderByNumber(uint64(number))
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *simBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	if vmConfig == nil {
+		vmConfig = b.chain.GetVMConfig()
+	}
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), *vmConfig), func() error { return nil }, nil
+}
+
+// Tests that simulated calls build on the state left behind by the previous
+// calls and blocks, and that they report their logs and failures.
+func TestSimulate(t *testing.T) {
+	var (
+		sender  = common.Address{0x1}
+		storage = common.Address{0xa} // Stores its input, logging it, or returns the stored value
+		reverts = common.Address{0xb} // Reverts with the reason "boom"
+		info    = common.Address{0xc} // Returns the block number, timestamp and coinbase
+
+		storageCode = []byte{
+			byte(vm.CALLDATASIZE), byte(vm.ISZERO), byte(vm.PUSH1), 18, byte(vm.JUMPI),
+			byte(vm.PUSH1), 0, byte(vm.CALLDATALOAD), byte(vm.DUP1), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+			byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG1), byte(vm.STOP),
+			byte(vm.JUMPDEST), byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 0, byte(vm.MSTORE),
+			byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+		}
+		infoCode = []byte{
+			byte(vm.NUMBER), byte(vm.PUSH1), 0, byte(vm.MSTORE),
+			byte(vm.TIMESTAMP), byte(vm.PUSH1), 32, byte(vm.MSTORE),
+			byte(vm.COINBASE), byte(vm.PUSH1), 64, byte(vm.MSTORE),
+			byte(vm.PUSH1), 96, byte(vm.PUSH1), 0, byte(vm.RETURN),
+		}
+		revertData = append(common.FromHex("08c379a0"), append(common.LeftPadBytes([]byte{32}, 32),
+			append(common.LeftPadBytes([]byte{4}, 32), common.RightPadBytes([]byte("boom"), 32)...)...)...)
+		revertCode = append([]byte{
+			byte(vm.PUSH1), byte(len(revertData)), byte(vm.PUSH1), 12, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+			byte(vm.PUSH1), byte(len(revertData)), byte(vm.PUSH1), 0, byte(vm.REVERT),
+		}, revertData...)
+
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc: core.GenesisAlloc{
+				sender:  {Balance: big.NewInt(1000)},
+				storage: {Balance: common.Big0, Code: storageCode},
+				reverts: {Balance: common.Big0, Code: revertCode},
+			},
+		}
+		genesis = gspec.MustCommit(db)
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2, func(i int, gen *core.BlockGen) {})
+	chain, _ := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	defer chain.Stop()
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	api := NewPublicBlockChainAPI(&simBackend{chain: chain})
+
+	var (
+		value    = common.Hash{0x42}
+		input    = hexutil.Bytes(value.Bytes())
+		coinbase = common.Address{0xcb}
+		number   = (*hexutil.Big)(big.NewInt(100))
+		time     = (*hexutil.Big)(big.NewInt(5000))
+		transfer = (*hexutil.Big)(big.NewInt(600))
+		code     = hexutil.Bytes(infoCode)
+	)
+	results, err := api.Simulate(context.Background(), []SimBlock{
+		{
+			// Store a value and transfer more than half of the funds of the sender
+			Calls: []CallArgs{
+				{From: &sender, To: &storage, Data: &input},
+				{From: &sender, To: &common.Address{0xff}, Value: transfer},
+			},
+		},
+		{
+			// Read the stored value, revert, and fail a transfer lacking funds
+			BlockOverrides: &BlockOverrides{Number: number, Time: time, Coinbase: &coinbase},
+			StateOverrides: &StateOverride{info: OverrideAccount{Code: &code}},
+			Calls: []CallArgs{
+				{From: &sender, To: &storage},
+				{From: &sender, To: &reverts},
+				{From: &sender, To: &common.Address{0xff}, Value: transfer},
+				{From: &sender, To: &info},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("block count mismatch: have %d, want 2", len(results))
+	}
+	// The first block should follow the head, with the stored value logged
+	first := results[0]
+	if first.Number != 3 || first.Timestamp != hexutil.Uint64(blocks[1].Time()+1) {
+		t.Errorf("block 0: number/time mismatch: have %d/%d, want %d/%d", first.Number, first.Timestamp, 3, blocks[1].Time()+1)
+	}
+	if len(first.Calls) != 2 {
+		t.Fatalf("block 0: call count mismatch: have %d, want 2", len(first.Calls))
+	}
+	for i, call := range first.Calls {
+		if call.Status != hexutil.Uint64(types.ReceiptStatusSuccessful) || call.Error != "" {
+			t.Errorf("block 0, call %d: failed: %s", i, call.Error)
+		}
+	}
+	if logs := first.Calls[0].Logs; len(logs) != 1 {
+		t.Errorf("block 0: log count mismatch: have %d, want 1", len(logs))
+	} else if l := logs[0]; l.Address != storage || l.Topics[0] != value || l.BlockNumber != 3 || l.BlockHash != first.Hash || l.Index != 0 {
+		t.Errorf("block 0: log mismatch: %+v", l)
+	}
+	// The second block should carry the state over and apply the overrides
+	second := results[1]
+	if second.Number != 100 || second.Timestamp != 5000 || second.Coinbase != coinbase {
+		t.Errorf("block 1: header mismatch: have %d/%d/%x, want %d/%d/%x", second.Number, second.Timestamp, second.Coinbase, 100, 5000, coinbase)
+	}
+	if len(second.Calls) != 4 {
+		t.Fatalf("block 1: call count mismatch: have %d, want 4", len(second.Calls))
+	}
+	if have := second.Calls[0].ReturnData; !bytes.Equal(have, value.Bytes()) {
+		t.Errorf("block 1: stored value mismatch: have %x, want %x", have, value)
+	}
+	if call := second.Calls[1]; call.Status != hexutil.Uint64(types.ReceiptStatusFailed) || call.RevertReason != "boom" || call.Error != "execution reverted: boom" {
+		t.Errorf("block 1: revert mismatch: status %d, reason %q, error %q", call.Status, call.RevertReason, call.Error)
+	}
+	if call := second.Calls[2]; call.Status != hexutil.Uint64(types.ReceiptStatusFailed) || !strings.Contains(call.Error, core.ErrInsufficientFundsForTransfer.Error()) || call.GasUsed != 0 {
+		t.Errorf("block 1: invalid call mismatch: status %d, gas %d, error %q", call.Status, call.GasUsed, call.Error)
+	}
+	want := append(common.LeftPadBytes([]byte{100}, 32), append(common.LeftPadBytes(big.NewInt(5000).Bytes(), 32), common.LeftPadBytes(coinbase.Bytes(), 32)...)...)
+	if call := second.Calls[3]; call.Status != hexutil.Uint64(types.ReceiptStatusSuccessful) || !bytes.Equal(call.ReturnData, want) {
+		t.Errorf("block 1: block info mismatch: have %x, want %x (error %q)", call.ReturnData, want, call.Error)
+	}
+}
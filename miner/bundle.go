@@ -0,0 +1,238 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// maxBundles is the maximum number of bundles retained in the bundle pool
+	// across all target blocks.
+	maxBundles = 1024
+)
+
+var (
+	errBundleEmpty    = errors.New("bundle has no transactions")
+	errBundleStale    = errors.New("bundle targets a past block")
+	errBundleKnown    = errors.New("bundle already known")
+	errBundlePoolFull = errors.New("bundle pool full")
+	errBundleReverted = errors.New("bundle transaction reverted")
+)
+
+// bundle is an ordered group of transactions to be included either all at the
+// top of the block with the target number, or not at all.
+type bundle struct {
+	hash   common.Hash
+	txs    types.Transactions
+	number uint64 // Number of the block to include the bundle in
+}
+
+// simulatedBundle is a bundle along with the result of executing it on top of
+// the state of the block being assembled.
+type simulatedBundle struct {
+	bundle  *bundle
+	profit  *big.Int // Balance gained by the coinbase, including direct payments
+	gasUsed uint64
+}
+
+// bundlePool retains the bundles submitted to the miner until their target
+// block is assembled.
+type bundlePool struct {
+	bundles map[common.Hash]*bundle
+	lock    sync.Mutex
+}
+
+// newBundlePool creates an empty bundle pool.
+func newBundlePool() *bundlePool {
+	return &bundlePool{
+		bundles: make(map[common.Hash]*bundle),
+	}
+}
+
+// add inserts a bundle targeting the given block number into the pool, returning
+// the bundle hash. The current head number is used to reject stale bundles.
+func (p *bundlePool) add(txs types.Transactions, number uint64, head uint64) (common.Hash, error) {
+	if len(txs) == 0 {
+		return common.Hash{}, errBundleEmpty
+	}
+	if number <= head {
+		return common.Hash{}, errBundleStale
+	}
+	hashes := make([][]byte, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash().Bytes()
+	}
+	b := &bundle{
+		hash:   crypto.Keccak256Hash(append(hashes, new(big.Int).SetUint64(number).Bytes())...),
+		txs:    txs,
+		number: number,
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if _, ok := p.bundles[b.hash]; ok {
+		return common.Hash{}, errBundleKnown
+	}
+	if len(p.bundles) >= maxBundles {
+		// Make room by dropping the bundles whose block has passed
+		for hash, old := range p.bundles {
+			if old.number <= head {
+				delete(p.bundles, hash)
+			}
+		}
+		if len(p.bundles) >= maxBundles {
+			return common.Hash{}, errBundlePoolFull
+		}
+	}
+	p.bundles[b.hash] = b
+	return b.hash, nil
+}
+
+// pending returns the bundles targeting the given block number, dropping the
+// ones targeting earlier blocks.
+func (p *bundlePool) pending(number uint64) []*bundle {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var bundles []*bundle
+	for hash, b := range p.bundles {
+		switch {
+		case b.number < number:
+			delete(p.bundles, hash)
+		case b.number == number:
+			bundles = append(bundles, b)
+		}
+	}
+	return bundles
+}
+
+// remove drops a bundle from the pool.
+func (p *bundlePool) remove(hash common.Hash) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.bundles, hash)
+}
+
+// simulateBundle executes a bundle on a copy of the state of the block being
+// assembled, returning the profit of the coinbase. A bundle fails if any of its
+// transactions is invalid or reverts.
+func (w *worker) simulateBundle(b *bundle, coinbase common.Address) (*simulatedBundle, error) {
+	var (
+		statedb = w.current.state.Copy()
+		gasPool = new(core.GasPool).AddGas(w.current.gasPool.Gas())
+		header  = types.CopyHeader(w.current.header)
+		before  = statedb.GetBalance(coinbase)
+	)
+	for i, tx := range b.txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, w.current.tcount+i)
+
+		receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, statedb, header, tx, &header.GasUsed, *w.chain.GetVMConfig())
+		if err != nil {
+			return nil, err
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return nil, errBundleReverted
+		}
+	}
+	return &simulatedBundle{
+		bundle:  b,
+		profit:  new(big.Int).Sub(statedb.GetBalance(coinbase), before),
+		gasUsed: header.GasUsed - w.current.header.GasUsed,
+	}, nil
+}
+
+// commitBundle applies all the transactions of a bundle to the block being
+// assembled, or none of them if any fails.
+func (w *worker) commitBundle(b *bundle, coinbase common.Address) ([]*types.Log, error) {
+	var (
+		snap    = w.current.state.Snapshot()
+		gas     = w.current.gasPool.Gas()
+		gasUsed = w.current.header.GasUsed
+		tcount  = w.current.tcount
+		txs     = len(w.current.txs)
+		logs    []*types.Log
+	)
+	for _, tx := range b.txs {
+		w.current.state.Prepare(tx.Hash(), common.Hash{}, w.current.tcount)
+
+		txLogs, err := w.commitTransaction(tx, coinbase)
+		if err == nil && w.current.receipts[len(w.current.receipts)-1].Status == types.ReceiptStatusFailed {
+			err = errBundleReverted
+		}
+		if err != nil {
+			w.current.state.RevertToSnapshot(snap)
+			*w.current.gasPool = core.GasPool(gas)
+			w.current.header.GasUsed = gasUsed
+			w.current.tcount = tcount
+			w.current.txs = w.current.txs[:txs]
+			w.current.receipts = w.current.receipts[:txs]
+			return nil, err
+		}
+		logs = append(logs, txLogs...)
+		w.current.tcount++
+	}
+	return logs, nil
+}
+
+// commitBundles simulates the bundles targeting the block being assembled,
+// discarding the failing ones, and applies the rest atomically at the top of
+// the block in decreasing order of profit. Bundles invalidated by a previously
+// applied one are skipped.
+func (w *worker) commitBundles(coinbase common.Address) {
+	bundles := w.bundles.pending(w.current.header.Number.Uint64())
+	if len(bundles) == 0 {
+		return
+	}
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	simulated := make([]*simulatedBundle, 0, len(bundles))
+	for _, b := range bundles {
+		sim, err := w.simulateBundle(b, coinbase)
+		if err != nil {
+			log.Debug("Discarding failed bundle", "hash", b.hash, "err", err)
+			w.bundles.remove(b.hash)
+			continue
+		}
+		simulated = append(simulated, sim)
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].profit.Cmp(simulated[j].profit) > 0
+	})
+	var coalescedLogs []*types.Log
+	for _, sim := range simulated {
+		logs, err := w.commitBundle(sim.bundle, coinbase)
+		if err != nil {
+			log.Trace("Skipping conflicting bundle", "hash", sim.bundle.hash, "err", err)
+			continue
+		}
+		log.Debug("Committed bundle", "hash", sim.bundle.hash, "txs", len(sim.bundle.txs), "gas", sim.gasUsed, "profit", sim.profit)
+		coalescedLogs = append(coalescedLogs, logs...)
+	}
+	w.sendPendingLogs(coalescedLogs)
+}
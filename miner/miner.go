@@ -215,6 +215,14 @@ func (miner *Miner) DisablePreseal() {
 	miner.worker.disablePreseal()
 }
 
+// AddBundle submits a bundle of transactions to be included atomically, in the
+// given order, at the top of the block with the given number. Bundles failing
+// or reverting on top of the parent state are discarded, and bundles targeting
+// the same block are prioritized by the profit of the coinbase.
+func (miner *Miner) AddBundle(txs types.Transactions, blockNumber uint64) (common.Hash, error) {
+	return miner.worker.bundles.add(txs, blockNumber, miner.worker.chain.CurrentBlock().NumberU64())
+}
+
 // SubscribePendingLogs starts delivering logs from pending transactions
 // to the given channel.
 func (miner *Miner) SubscribePendingLogs(ch chan<- []*types.Log) event.Subscription {
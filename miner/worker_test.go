@@ -17,6 +17,7 @@
 package miner
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -516,3 +517,97 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+func TestBundleInclusion(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var (
+		coinbase = common.Address{0xc0}
+		signer   = types.LatestSigner(ethashChainConfig)
+		transfer = func(key *ecdsa.PrivateKey, nonce uint64, gasPrice int64) *types.Transaction {
+			return types.MustSignNewTx(key, signer, &types.LegacyTx{
+				Nonce:    nonce,
+				To:       &testUserAddress,
+				Value:    big.NewInt(1000),
+				Gas:      params.TxGas,
+				GasPrice: big.NewInt(gasPrice),
+			})
+		}
+		// Bundles conflicting with each other on the nonce of the bank
+		cheap  = types.Transactions{transfer(testBankKey, 0, 1)}
+		costly = types.Transactions{transfer(testBankKey, 0, 2), transfer(testBankKey, 1, 2)}
+		// Bundles failing on top of the parent state
+		invalid  = types.Transactions{transfer(testUserKey, 0, 10)}
+		reverted = types.Transactions{types.MustSignNewTx(testBankKey, signer, &types.LegacyTx{
+			Nonce:    0,
+			Value:    big.NewInt(0),
+			Gas:      100000,
+			GasPrice: big.NewInt(10),
+			Data:     []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.REVERT)},
+		})}
+	)
+	w.setEtherbase(coinbase)
+
+	if _, err := w.bundles.add(nil, 1, 0); err != errBundleEmpty {
+		t.Fatalf("empty bundle error mismatch: have %v, want %v", err, errBundleEmpty)
+	}
+	if _, err := w.bundles.add(cheap, 0, 0); err != errBundleStale {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, errBundleStale)
+	}
+	hashes := make(map[common.Hash]types.Transactions)
+	for _, txs := range []types.Transactions{cheap, costly, invalid, reverted} {
+		hash, err := w.bundles.add(txs, 1, 0)
+		if err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+		hashes[hash] = txs
+	}
+	if _, err := w.bundles.add(cheap, 1, 0); err != errBundleKnown {
+		t.Fatalf("known bundle error mismatch: have %v, want %v", err, errBundleKnown)
+	}
+	taskCh := make(chan *task, 1)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 && len(task.block.Transactions()) > 0 {
+			select {
+			case taskCh <- task:
+			default:
+			}
+		}
+	}
+	w.skipSealHook = func(task *task) bool { return true }
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		// Only the most profitable of the conflicting bundles should be included,
+		// ahead of the pool transaction it invalidates
+		txs := task.block.Transactions()
+		if len(txs) != len(costly) {
+			t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), len(costly))
+		}
+		for i, tx := range txs {
+			if tx.Hash() != costly[i].Hash() {
+				t.Fatalf("transaction %d mismatch: have %x, want %x", i, tx.Hash(), costly[i].Hash())
+			}
+		}
+		if have, want := task.state.GetBalance(testUserAddress), big.NewInt(2000); have.Cmp(want) != 0 {
+			t.Fatalf("user balance mismatch: have %v, want %v", have, want)
+		}
+	case <-time.NewTimer(3 * time.Second).C:
+		t.Fatal("new task timeout")
+	}
+	// The failing bundles should have been discarded from the pool
+	w.bundles.lock.Lock()
+	defer w.bundles.lock.Unlock()
+
+	for hash, txs := range hashes {
+		_, ok := w.bundles.bundles[hash]
+		if failed := txs[0].Hash() == invalid[0].Hash() || txs[0].Hash() == reverted[0].Hash(); ok == failed {
+			t.Errorf("bundle %x retention mismatch: have %v, want %v", hash, ok, !failed)
+		}
+	}
+}
@@ -184,6 +184,7 @@ func (api *privateAdminAPI) StartRPC(host *string, port *int, cors *string, apis
 		CorsAllowedOrigins: api.node.config.HTTPCors,
 		Vhosts:             api.node.config.HTTPVirtualHosts,
 		Modules:            api.node.config.HTTPModules,
+		limits:             api.node.config.HTTPLimits,
 	}
 	if cors != nil {
 		config.CorsAllowedOrigins = nil
@@ -243,6 +244,7 @@ func (api *privateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 	config := wsConfig{
 		Modules: api.node.config.WSModules,
 		Origins: api.node.config.WSOrigins,
+		limits:  api.node.config.WSLimits,
 		// ExposeAll: api.node.config.WSExposeAll,
 	}
 	if apis != nil {
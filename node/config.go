@@ -32,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/scwallet"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -45,6 +46,7 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  // Path within the datadir to the static node list
 	datadirTrustedNodes    = "trusted-nodes.json" // Path within the datadir to the trusted node list
 	datadirNodeDatabase    = "nodes"              // Path within the datadir to store the node infos
+	datadirJWTSecret       = "jwtsecret"          // Path within the datadir to the RPC authentication secret
 )
 
 // Config represents a small collection of configuration values to fine tune the
@@ -107,6 +109,11 @@ type Config struct {
 	// relative), then that specific path is enforced. An empty path disables IPC.
 	IPCPath string
 
+	// IPCLimits configures the request budgets enforced on the clients of the IPC
+	// RPC interface, such as batch size, per connection concurrency and per method
+	// rate limits.
+	IPCLimits rpc.Limits `toml:",omitempty"`
+
 	// HTTPHost is the host interface on which to start the HTTP RPC server. If this
 	// field is empty, no HTTP API endpoint will be started.
 	HTTPHost string
@@ -139,6 +146,11 @@ type Config struct {
 	// interface.
 	HTTPTimeouts rpc.HTTPTimeouts
 
+	// HTTPLimits configures the request budgets enforced on the clients of the HTTP
+	// RPC interface. Since every HTTP request is served separately, the concurrency
+	// limit only restricts the execution of batches.
+	HTTPLimits rpc.Limits `toml:",omitempty"`
+
 	// HTTPPathPrefix specifies a path prefix on which http-rpc is to be served.
 	HTTPPathPrefix string `toml:",omitempty"`
 
@@ -171,6 +183,34 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// WSLimits configures the request budgets enforced on the clients of the
+	// websocket RPC interface.
+	WSLimits rpc.Limits `toml:",omitempty"`
+
+	// AuthAddr is the host interface on which to start the authenticated RPC
+	// server, serving both HTTP and websocket requests. If this field is empty,
+	// no authenticated API endpoint will be started.
+	AuthAddr string `toml:",omitempty"`
+
+	// AuthPort is the TCP port number on which to start the authenticated RPC
+	// server.
+	AuthPort int `toml:",omitempty"`
+
+	// AuthVirtualHosts is the list of virtual hostnames which are allowed on
+	// incoming requests to the authenticated RPC server.
+	AuthVirtualHosts []string `toml:",omitempty"`
+
+	// AuthModules is a list of API modules to expose via the authenticated RPC
+	// server. Unlike on the public interfaces, privileged modules such as admin,
+	// debug and personal are meant to be listed here.
+	AuthModules []string `toml:",omitempty"`
+
+	// JWTSecret is the path to the hex encoded 32 byte secret used to verify
+	// the HS256 JSON Web Tokens of the authenticated RPC server. If the path is
+	// empty, the secret is placed inside the data directory. A new secret is
+	// generated if the file doesn't exist yet.
+	JWTSecret string `toml:",omitempty"`
+
 	// GraphQLCors is the Cross-Origin Resource Sharing header to send to requesting
 	// clients. Please be aware that CORS is a browser enforced security, it's fully
 	// useless for custom HTTP clients.
@@ -192,6 +232,16 @@ type Config struct {
 	trustedNodesWarning    bool
 	oldGethResourceWarning bool
 
+	// DBEngine is the key-value engine backing the databases of the node, either
+	// "leveldb" or "pebble". If empty, existing databases are opened with the
+	// engine they were created with and new ones use leveldb.
+	DBEngine string `toml:",omitempty"`
+
+	// AncientCodecs overrides the compression codec ("none", "snappy" or "zstd")
+	// of the ancient tables by name. New tables are created with the configured
+	// codec, while opening existing ones compressed differently fails.
+	AncientCodecs map[string]string `toml:",omitempty"`
+
 	// AllowUnprotectedTxs allows non EIP-155 protected transactions to be send over RPC.
 	AllowUnprotectedTxs bool `toml:",omitempty"`
 }
@@ -265,6 +315,15 @@ func (c *Config) WSEndpoint() string {
 	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
+// AuthEndpoint resolves the authenticated RPC endpoint based on the configured
+// host interface and port parameters.
+func (c *Config) AuthEndpoint() string {
+	if c.AuthAddr == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AuthAddr, c.AuthPort)
+}
+
 // DefaultWSEndpoint returns the websocket endpoint used by default.
 func DefaultWSEndpoint() string {
 	config := &Config{WSHost: DefaultWSHost, WSPort: DefaultWSPort}
@@ -385,6 +444,44 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 
+// jwtSecret retrieves the secret used to authenticate RPC requests, loading it
+// from the configured file or the data folder. If no secret can be found, a new
+// one is generated and persisted.
+func (c *Config) jwtSecret() ([]byte, error) {
+	path := c.JWTSecret
+	if path == "" {
+		path = c.ResolvePath(datadirJWTSecret)
+	}
+	// Generate an ephemeral secret if no datadir is being used.
+	if path == "" {
+		log.Warn("Using ephemeral JWT secret, no authenticated requests can be made")
+		return randomJWTSecret()
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		secret := common.FromHex(strings.TrimSpace(string(data)))
+		if len(secret) != jwtSecretLength {
+			return nil, fmt.Errorf("invalid JWT secret in %s: have %d bytes, want %d", path, len(secret), jwtSecretLength)
+		}
+		log.Info("Loaded JWT secret file", "path", path)
+		return secret, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	// No persistent secret found, generate and store a new one.
+	secret, err := randomJWTSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hexutil.Encode(secret)), 0600); err != nil {
+		return nil, err
+	}
+	log.Info("Generated JWT secret", "path", path)
+	return secret, nil
+}
+
 // StaticNodes returns a list of node enode URLs configured as static nodes.
 func (c *Config) StaticNodes() []*enode.Node {
 	return c.parsePersistentNodes(&c.staticNodesWarning, c.ResolvePath(datadirStaticNodes))
@@ -160,3 +160,42 @@ func TestNodeKeyPersistency(t *testing.T) {
 		t.Fatalf("ephemeral node key persisted to disk")
 	}
 }
+
+// Tests that JWT secrets are generated on first use, persisted and reloaded.
+func TestJWTSecretPersistency(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Configure a node with no secret and ensure one is generated and persisted
+	config := &Config{Name: "unit-test", DataDir: dir}
+	secret1, err := config.jwtSecret()
+	if err != nil {
+		t.Fatalf("failed to generate JWT secret: %v", err)
+	}
+	if len(secret1) != jwtSecretLength {
+		t.Fatalf("generated JWT secret length mismatch: have %d, want %d", len(secret1), jwtSecretLength)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unit-test", datadirJWTSecret)); err != nil {
+		t.Fatalf("JWT secret not persisted to data directory: %v", err)
+	}
+	// Configure a new node and ensure the previously persisted secret is loaded
+	secret2, err := config.jwtSecret()
+	if err != nil {
+		t.Fatalf("failed to load JWT secret: %v", err)
+	}
+	if !bytes.Equal(secret1, secret2) {
+		t.Fatalf("persisted JWT secret mismatch: have %x, want %x", secret2, secret1)
+	}
+	// Configure a node with an explicit, malformed secret file and ensure it's rejected
+	path := filepath.Join(dir, "bad-secret")
+	if err := ioutil.WriteFile(path, []byte("0xdeadbeef"), 0600); err != nil {
+		t.Fatalf("failed to write JWT secret: %v", err)
+	}
+	config = &Config{Name: "unit-test", DataDir: dir, JWTSecret: path}
+	if _, err := config.jwtSecret(); err == nil {
+		t.Fatalf("malformed JWT secret accepted")
+	}
+}
@@ -54,6 +54,7 @@ type Node struct {
 	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
 	http          *httpServer //
 	ws            *httpServer //
+	auth          *httpServer // Authenticated HTTP and WebSocket server for privileged APIs
 	ipc           *ipcServer  // Stores information about the ipc http server
 	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
 
@@ -146,7 +147,8 @@ func New(conf *Config) (*Node, error) {
 	// Configure RPC servers.
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
-	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
+	node.auth = newHTTPServer(node.log, conf.HTTPTimeouts)
+	node.ipc = newIPCServer(node.log, conf.IPCEndpoint(), conf.IPCLimits)
 
 	return node, nil
 }
@@ -355,6 +357,7 @@ func (n *Node) startRPC() error {
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
 			prefix:             n.config.HTTPPathPrefix,
+			limits:             n.config.HTTPLimits,
 		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
 			return err
@@ -371,6 +374,7 @@ func (n *Node) startRPC() error {
 			Modules: n.config.WSModules,
 			Origins: n.config.WSOrigins,
 			prefix:  n.config.WSPathPrefix,
+			limits:  n.config.WSLimits,
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
@@ -380,10 +384,39 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Configure the authenticated endpoint, serving both HTTP and WebSocket.
+	if n.config.AuthAddr != "" {
+		secret, err := n.config.jwtSecret()
+		if err != nil {
+			return err
+		}
+		if err := n.auth.setListenAddr(n.config.AuthAddr, n.config.AuthPort); err != nil {
+			return err
+		}
+		if err := n.auth.enableRPC(n.rpcAPIs, httpConfig{
+			Vhosts:    n.config.AuthVirtualHosts,
+			Modules:   n.config.AuthModules,
+			limits:    n.config.HTTPLimits,
+			jwtSecret: secret,
+		}); err != nil {
+			return err
+		}
+		if err := n.auth.enableWS(n.rpcAPIs, wsConfig{
+			Modules:   n.config.AuthModules,
+			limits:    n.config.WSLimits,
+			jwtSecret: secret,
+		}); err != nil {
+			return err
+		}
+	}
+
 	if err := n.http.start(); err != nil {
 		return err
 	}
-	return n.ws.start()
+	if err := n.ws.start(); err != nil {
+		return err
+	}
+	return n.auth.start()
 }
 
 func (n *Node) wsServerForPort(port int) *httpServer {
@@ -396,6 +429,7 @@ func (n *Node) wsServerForPort(port int) *httpServer {
 func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
+	n.auth.stop()
 	n.ipc.stop()
 	n.stopInProc()
 }
@@ -530,6 +564,15 @@ func (n *Node) HTTPEndpoint() string {
 	return "http://" + n.http.listenAddr()
 }
 
+// AuthEndpoint returns the URL of the authenticated RPC server, which serves
+// both HTTP and WebSocket requests, or an empty string if it's disabled.
+func (n *Node) AuthEndpoint() string {
+	if !n.auth.rpcAllowed() {
+		return ""
+	}
+	return "http://" + n.auth.listenAddr()
+}
+
 // WSEndpoint returns the current JSON-RPC over WebSocket endpoint.
 func (n *Node) WSEndpoint() string {
 	if n.http.wsAllowed() {
@@ -559,7 +602,13 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace)
+		db, err = rawdb.Open(rawdb.OpenOptions{
+			Type:      n.config.DBEngine,
+			Directory: n.ResolvePath(name),
+			Namespace: namespace,
+			Cache:     cache,
+			Handles:   handles,
+		})
 	}
 
 	if err == nil {
@@ -592,7 +641,15 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
+		db, err = rawdb.Open(rawdb.OpenOptions{
+			Type:              n.config.DBEngine,
+			Directory:         root,
+			AncientsDirectory: freezer,
+			Namespace:         namespace,
+			Cache:             cache,
+			Handles:           handles,
+			AncientCodecs:     n.config.AncientCodecs,
+		})
 	}
 
 	if err == nil {
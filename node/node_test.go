@@ -27,11 +27,13 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang-jwt/jwt/v4"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -591,6 +593,69 @@ func (test rpcPrefixTest) check(t *testing.T, node *Node) {
 	}
 }
 
+// Tests that privileged modules are served on the authenticated endpoint only,
+// using the secret generated in the data directory.
+func TestNodeAuthEndpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-test")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	node, err := New(&Config{
+		DataDir:     dir,
+		HTTPHost:    "127.0.0.1",
+		HTTPModules: []string{"net", "web3"},
+		AuthAddr:    "127.0.0.1",
+		AuthModules: []string{"admin"},
+	})
+	if err != nil {
+		t.Fatalf("could not create a new node: %v", err)
+	}
+	if err := node.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	defer node.Close()
+
+	secret, err := node.config.jwtSecret()
+	if err != nil {
+		t.Fatalf("failed to load JWT secret: %v", err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		IssuedAt: jwt.NewNumericDate(time.Now()),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	modules := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("failed to read response: %v", err)
+		}
+		return string(body)
+	}
+	if resp := rpcRequest(t, node.AuthEndpoint(), "Authorization", "Bearer "+token); !strings.Contains(modules(resp), `"admin"`) {
+		t.Fatal("admin module missing from authenticated endpoint")
+	}
+	if resp := rpcRequest(t, node.AuthEndpoint()); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated request returned status %d", resp.StatusCode)
+	}
+	if resp := rpcRequest(t, node.HTTPEndpoint()); strings.Contains(modules(resp), `"admin"`) {
+		t.Fatal("admin module exposed on public endpoint")
+	}
+}
+
+// Tests that no authenticated endpoint is reported if the server is disabled.
+func TestNodeAuthEndpointDisabled(t *testing.T) {
+	node := startHTTP(t, 0, 0)
+	defer node.Close()
+
+	if endpoint := node.AuthEndpoint(); endpoint != "" {
+		t.Fatalf("endpoint of disabled authenticated server returned: %q", endpoint)
+	}
+}
+
 func createNode(t *testing.T, httpPort, wsPort int) *Node {
 	conf := &Config{
 		HTTPHost: "127.0.0.1",
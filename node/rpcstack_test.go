@@ -24,10 +24,12 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/internal/testlog"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
@@ -58,6 +60,61 @@ func TestVhosts(t *testing.T) {
 	assert.Equal(t, resp2.StatusCode, http.StatusForbidden)
 }
 
+// TestJWT makes sure requests to an authenticated server need a valid token.
+func TestJWT(t *testing.T) {
+	secret := bytes.Repeat([]byte{0x42}, jwtSecretLength)
+	issue := func(key []byte, method jwt.SigningMethod, claims jwt.Claims) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return "Bearer " + token
+	}
+	issuedAt := func(offset time.Duration) jwt.Claims {
+		return jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(time.Now().Add(offset))}
+	}
+	srv := createAndStartServer(t, &httpConfig{jwtSecret: secret}, true, &wsConfig{jwtSecret: secret})
+	defer srv.stop()
+	httpURL, wsURL := "http://"+srv.listenAddr(), "ws://"+srv.listenAddr()
+
+	valid := []string{
+		issue(secret, jwt.SigningMethodHS256, issuedAt(0)),
+		issue(secret, jwt.SigningMethodHS256, issuedAt(-jwtExpiryTimeout/2)),
+		issue(secret, jwt.SigningMethodHS256, issuedAt(jwtExpiryTimeout/2)),
+	}
+	invalid := []string{
+		"",
+		"Bearer ",
+		"Bearer garbage",
+		issue(secret, jwt.SigningMethodHS256, jwt.RegisteredClaims{}),
+		issue(secret, jwt.SigningMethodHS256, issuedAt(-2*jwtExpiryTimeout)),
+		issue(secret, jwt.SigningMethodHS256, issuedAt(2*jwtExpiryTimeout)),
+		issue(secret, jwt.SigningMethodHS512, issuedAt(0)),
+		issue(bytes.Repeat([]byte{0x43}, jwtSecretLength), jwt.SigningMethodHS256, issuedAt(0)),
+	}
+	for i, token := range valid {
+		if resp := rpcRequest(t, httpURL, "Authorization", token); resp.StatusCode != http.StatusOK {
+			t.Errorf("valid token %d: HTTP request failed with status %d", i, resp.StatusCode)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {token}})
+		if err != nil {
+			t.Errorf("valid token %d: WebSocket connection failed: %v", i, err)
+		} else {
+			conn.Close()
+		}
+	}
+	for i, token := range invalid {
+		if resp := rpcRequest(t, httpURL, "Authorization", token); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("invalid token %d: HTTP request returned status %d", i, resp.StatusCode)
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {token}})
+		if err == nil {
+			conn.Close()
+			t.Errorf("invalid token %d: WebSocket connection succeeded", i)
+		}
+	}
+}
+
 type originTest struct {
 	spec    string
 	expOk   []string
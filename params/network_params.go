@@ -32,6 +32,13 @@ const (
 	// considered probably final and its rotated bits are calculated.
 	BloomConfirms = 256
 
+	// LogIndexBlocks is the number of blocks a single log index section covers.
+	LogIndexBlocks uint64 = 4096
+
+	// LogIndexConfirms is the number of confirmation blocks before a log index
+	// section is considered probably final and its logs are indexed.
+	LogIndexConfirms = 256
+
 	// CHTFrequency is the block frequency for creating CHTs
 	CHTFrequency = 32768
 
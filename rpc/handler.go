@@ -61,6 +61,8 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	limits         *limiter      // request budgets of the server, nil if unlimited
+	slots          chan struct{} // semaphore of concurrently executing calls, nil if unlimited
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -69,9 +71,11 @@ type handler struct {
 type callProc struct {
 	ctx       context.Context
 	notifiers []*Notifier
+	respSize  int   // size of the results produced so far, counted against the response cap
+	respErr   error // set once the results grew above the response cap
 }
 
-func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
+func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, limits *limiter) *handler {
 	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	h := &handler{
 		reg:            reg,
@@ -84,6 +88,8 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		limits:         limits,
+		slots:          limits.newConnSlots(),
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -101,6 +107,11 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		})
 		return
 	}
+	// Reject all calls of batches exceeding the size limit:
+	if err := h.limits.checkBatch(len(msgs)); err != nil {
+		h.rejectCalls(msgs, true, err)
+		return
+	}
 
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
@@ -112,14 +123,28 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	if len(calls) == 0 {
 		return
 	}
+	if !h.acquireSlot() {
+		rpcLimitedMeter.Mark(1)
+		h.rejectCalls(calls, true, errTooManyConcurrent)
+		return
+	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
 		for _, msg := range calls {
+			// Once the results grew too large, reject the remaining calls
+			if cp.respErr != nil {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(cp.respErr))
+				}
+				continue
+			}
 			if answer := h.handleCallMsg(cp, msg); answer != nil {
 				answers = append(answers, answer)
 			}
 		}
+		// Free up the slot before responding, so the next request can be served
+		h.releaseSlot()
 		h.addSubscriptions(cp.notifiers)
 		if len(answers) > 0 {
 			h.conn.writeJSON(cp.ctx, answers)
@@ -135,8 +160,14 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	if ok := h.handleImmediate(msg); ok {
 		return
 	}
+	if !h.acquireSlot() {
+		rpcLimitedMeter.Mark(1)
+		h.rejectCalls([]*jsonrpcMessage{msg}, false, errTooManyConcurrent)
+		return
+	}
 	h.startCallProc(func(cp *callProc) {
 		answer := h.handleCallMsg(cp, msg)
+		h.releaseSlot()
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
 			h.conn.writeJSON(cp.ctx, answer)
@@ -147,6 +178,48 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 	})
 }
 
+// acquireSlot reserves an execution slot for a call or batch of calls of the
+// connection, returning false if all of them are taken.
+func (h *handler) acquireSlot() bool {
+	if h.slots == nil {
+		return true
+	}
+	select {
+	case h.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// releaseSlot frees an execution slot reserved by acquireSlot.
+func (h *handler) releaseSlot() {
+	if h.slots != nil {
+		<-h.slots
+	}
+}
+
+// rejectCalls responds to all the calls among the given messages with the
+// given error, without executing them.
+func (h *handler) rejectCalls(msgs []*jsonrpcMessage, batch bool, err error) {
+	answers := make([]*jsonrpcMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.isCall() {
+			answers = append(answers, msg.errorResponse(err))
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+	h.startCallProc(func(cp *callProc) {
+		if batch {
+			h.conn.writeJSON(cp.ctx, answers)
+		} else {
+			h.conn.writeJSON(cp.ctx, answers[0])
+		}
+	})
+}
+
 // close cancels all requests except for inflightReq and waits for
 // call goroutines to shut down.
 func (h *handler) close(err error, inflightReq *requestOp) {
@@ -317,6 +390,9 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 
 // handleCall processes method calls.
 func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+	if err := h.limits.checkMethod(msg.Method); err != nil {
+		return msg.errorResponse(err)
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -333,8 +409,20 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
+	// Cancel the call if it runs past its time allowance
+	ctx := cp.ctx
+	timeout := h.limits.callTimeout(msg.Method)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
+	answer := h.runMethod(ctx, cp, msg, callb, args)
+	if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		rpcLimitedMeter.Mark(1)
+		answer = msg.errorResponse(&timeoutError{method: msg.Method, timeout: timeout})
+	}
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
@@ -381,16 +469,26 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
-	return h.runMethod(ctx, msg, callb, args)
+	return h.runMethod(ctx, cp, msg, callb, args)
 }
 
-// runMethod runs the Go callback for an RPC method.
-func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+// runMethod runs the Go callback for an RPC method, encoding its result within
+// the response size budget left to the call.
+func (h *handler) runMethod(ctx context.Context, cp *callProc, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
 	result, err := callb.call(ctx, msg.Method, args)
 	if err != nil {
 		return msg.errorResponse(err)
 	}
-	return msg.response(result)
+	enc, err := h.limits.encodeResult(result, cp.respSize)
+	if err != nil {
+		if _, ok := err.(*responseTooLargeError); ok {
+			cp.respErr = err
+		}
+		// TODO: wrap with 'internal server error'
+		return msg.errorResponse(err)
+	}
+	cp.respSize += len(enc)
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
 }
 
 // unsubscribe is the callback function for all *_unsubscribe calls.
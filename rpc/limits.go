@@ -0,0 +1,214 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limits is the set of request budgets a Server enforces on its clients. The
+// zero value of any field means that the corresponding limit is disabled.
+type Limits struct {
+	// BatchItems is the maximum number of requests allowed in a single batch.
+	BatchItems int `toml:",omitempty"`
+
+	// ConnConcurrency is the maximum number of requests (or batches) a single
+	// connection may have executing concurrently. Requests above the limit are
+	// rejected, not queued.
+	ConnConcurrency int `toml:",omitempty"`
+
+	// MethodRates sets up a token bucket for the given methods, shared by all
+	// the clients of the server. Requests finding the bucket of their method
+	// empty are rejected.
+	MethodRates map[string]RateLimit `toml:",omitempty"`
+
+	// ResponseSize is the maximum size in bytes of the result of a call. For
+	// batches it caps the combined size of all the results, calls past the cap
+	// are not executed.
+	ResponseSize int `toml:",omitempty"`
+
+	// Timeout is the default execution time allowance of a call. The context of
+	// calls running longer is cancelled, and an error is returned in place of
+	// their result. Subscriptions are not affected.
+	Timeout time.Duration `toml:",omitempty"`
+
+	// MethodTimeouts overrides the execution time allowance of specific methods.
+	MethodTimeouts map[string]time.Duration `toml:",omitempty"`
+}
+
+// RateLimit configures a token bucket, refilled continuously at Rate tokens per
+// second, holding up to Burst tokens.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// errTooManyConcurrent is returned for calls above the concurrency limit of
+// their connection.
+var errTooManyConcurrent = &limitExceededError{"too many concurrent requests"}
+
+// limiter enforces the configured Limits of a server.
+type limiter struct {
+	batchItems      int
+	connConcurrency int
+	methods         map[string]*rate.Limiter
+	responseSize    int
+	timeout         time.Duration
+	methodTimeouts  map[string]time.Duration
+}
+
+// newLimiter creates the enforcer of the given limits, or nil if no limits
+// are configured at all.
+func newLimiter(limits Limits) *limiter {
+	l := &limiter{
+		batchItems:      limits.BatchItems,
+		connConcurrency: limits.ConnConcurrency,
+		methods:         make(map[string]*rate.Limiter),
+		responseSize:    limits.ResponseSize,
+		timeout:         limits.Timeout,
+		methodTimeouts:  make(map[string]time.Duration),
+	}
+	for method, limit := range limits.MethodRates {
+		l.methods[method] = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+	}
+	for method, timeout := range limits.MethodTimeouts {
+		l.methodTimeouts[method] = timeout
+	}
+	if l.batchItems <= 0 && l.connConcurrency <= 0 && len(l.methods) == 0 &&
+		l.responseSize <= 0 && l.timeout <= 0 && len(l.methodTimeouts) == 0 {
+		return nil
+	}
+	return l
+}
+
+// checkBatch returns an error if the batch of the given size is too large.
+func (l *limiter) checkBatch(size int) error {
+	if l == nil || l.batchItems <= 0 || size <= l.batchItems {
+		return nil
+	}
+	rpcLimitedMeter.Mark(1)
+	return &limitExceededError{"batch too large"}
+}
+
+// checkMethod takes a token from the bucket of the given method, returning an
+// error if it's empty.
+func (l *limiter) checkMethod(method string) error {
+	if l == nil {
+		return nil
+	}
+	if bucket := l.methods[method]; bucket != nil && !bucket.Allow() {
+		rpcLimitedMeter.Mark(1)
+		return &limitExceededError{"rate limit exceeded for " + method}
+	}
+	return nil
+}
+
+// checkResponse returns an error if a response of the given size is too large.
+func (l *limiter) checkResponse(size int) error {
+	if l == nil || l.responseSize <= 0 || size <= l.responseSize {
+		return nil
+	}
+	rpcLimitedMeter.Mark(1)
+	return &responseTooLargeError{limit: l.responseSize}
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// encodeResult marshals the result of a call, given the size of the results
+// already produced by the same batch, failing if the response grows too large.
+// Lists are encoded item by item, so that encoding stops as soon as the result
+// crosses the response cap.
+func (l *limiter) encodeResult(result interface{}, used int) (json.RawMessage, error) {
+	if l == nil || l.responseSize <= 0 {
+		return json.Marshal(result)
+	}
+	val := reflect.ValueOf(result)
+	if !streamable(val) {
+		enc, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.checkResponse(used + len(enc)); err != nil {
+			return nil, err
+		}
+		return enc, nil
+	}
+	enc := []byte{'['}
+	for i := 0; i < val.Len(); i++ {
+		if i > 0 {
+			enc = append(enc, ',')
+		}
+		// Encode through a pointer, as slice items are addressable and json
+		// would call the pointer receiver marshalers on them too
+		item, err := json.Marshal(val.Index(i).Addr().Interface())
+		if err != nil {
+			return nil, err
+		}
+		if err := l.checkResponse(used + len(enc) + len(item) + 1); err != nil {
+			return nil, err
+		}
+		enc = append(enc, item...)
+	}
+	return append(enc, ']'), nil
+}
+
+// streamable reports whether a value is a non-nil slice encoded by json as a
+// plain list of its items.
+func streamable(val reflect.Value) bool {
+	if val.Kind() != reflect.Slice || val.IsNil() {
+		return false
+	}
+	typ := val.Type()
+	if typ.Elem().Kind() == reflect.Uint8 {
+		return false // Encoded as base64 string
+	}
+	for _, t := range []reflect.Type{typ, reflect.PtrTo(typ)} {
+		if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) {
+			return false
+		}
+	}
+	return true
+}
+
+// callTimeout returns the execution time allowance of the given method, or
+// zero if it's unlimited.
+func (l *limiter) callTimeout(method string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	if timeout, ok := l.methodTimeouts[method]; ok {
+		return timeout
+	}
+	return l.timeout
+}
+
+// newConnSlots creates the semaphore tracking the executing requests of a
+// single connection, or nil if their number is not limited.
+func (l *limiter) newConnSlots() chan struct{} {
+	if l == nil || l.connConcurrency <= 0 {
+		return nil
+	}
+	return make(chan struct{}, l.connConcurrency)
+}
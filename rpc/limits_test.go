@@ -0,0 +1,102 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// countingItem counts how many times it was encoded.
+type countingItem struct {
+	count *int
+}
+
+func (c *countingItem) MarshalJSON() ([]byte, error) {
+	*c.count++
+	return []byte(`"item"`), nil
+}
+
+// Tests that results encoded within the response cap match plain json encoding.
+func TestEncodeResult(t *testing.T) {
+	limiter := newLimiter(Limits{ResponseSize: 1024})
+
+	type item struct {
+		A string
+		B *big.Int
+	}
+	results := []interface{}{
+		nil,
+		"string",
+		[]int(nil),
+		[]int{},
+		[]int{1, 2, 3},
+		[]byte{1, 2, 3},
+		hexutil.Bytes{1, 2, 3},
+		[]hexutil.Uint64{1, 2},
+		[]*item{{A: "<a>", B: big.NewInt(1)}, nil},
+		[]item{{A: "b"}},
+		[]interface{}{1, "x", nil},
+		[][]string{{"a"}, nil},
+		[3]int{1, 2, 3},
+		map[string][]int{"a": {1}},
+	}
+	for i, result := range results {
+		want, err := json.Marshal(result)
+		if err != nil {
+			t.Fatalf("result %d: failed to marshal: %v", i, err)
+		}
+		have, err := limiter.encodeResult(result, 0)
+		if err != nil {
+			t.Fatalf("result %d: failed to encode: %v", i, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("result %d: encoding mismatch: have %s, want %s", i, have, want)
+		}
+	}
+}
+
+// Tests that lists are encoded only until they cross the response cap.
+func TestEncodeResultLimit(t *testing.T) {
+	limiter := newLimiter(Limits{ResponseSize: 64})
+
+	var count int
+	items := make([]countingItem, 100)
+	for i := range items {
+		items[i].count = &count
+	}
+	if _, err := limiter.encodeResult(items, 0); err == nil {
+		t.Fatal("oversized result encoded")
+	} else if _, ok := err.(*responseTooLargeError); !ok {
+		t.Fatalf("error mismatch: have %v, want response too large", err)
+	}
+	// Nine items fit in the cap, the tenth crosses it
+	if count != 10 {
+		t.Fatalf("encoded item count mismatch: have %d, want 10", count)
+	}
+	// The size of the results already produced should count against the cap
+	if _, err := limiter.encodeResult(items[:2], 0); err != nil {
+		t.Fatalf("failed to encode result within cap: %v", err)
+	}
+	if _, err := limiter.encodeResult(items[:2], 60); err == nil {
+		t.Fatal("result above remaining cap encoded")
+	}
+}
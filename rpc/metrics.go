@@ -27,6 +27,7 @@ var (
 	successfulRequestGauge = metrics.NewRegisteredGauge("rpc/success", nil)
 	failedReqeustGauge     = metrics.NewRegisteredGauge("rpc/failure", nil)
 	rpcServingTimer        = metrics.NewRegisteredTimer("rpc/duration/all", nil)
+	rpcLimitedMeter        = metrics.NewRegisteredMeter("rpc/limited", nil)
 )
 
 func newRPCServingTimer(method string, valid bool) metrics.Timer {
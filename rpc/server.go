@@ -46,6 +46,7 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set
+	limits   *limiter
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -66,6 +67,13 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetLimits configures the request budgets enforced on the clients of the server.
+// Requests exceeding them are rejected with a dedicated error code. It must be
+// called before the server starts serving requests.
+func (s *Server) SetLimits(limits Limits) {
+	s.limits = newLimiter(limits)
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
@@ -83,7 +91,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, s.limits)
 	<-codec.closed()
 	c.Close()
 }
@@ -97,7 +105,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 		return
 	}
 
-	h := newHandler(ctx, codec, s.idgen, &s.services)
+	h := newHandler(ctx, codec, s.idgen, &s.services, s.limits)
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
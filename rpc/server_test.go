@@ -150,3 +150,118 @@ func TestServerShortLivedConn(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the request budgets configured on a server are enforced.
+func TestServerLimits(t *testing.T) {
+	server := newTestServer()
+	server.SetLimits(Limits{
+		BatchItems:      2,
+		ConnConcurrency: 1,
+		MethodRates: map[string]RateLimit{
+			"test_rets": {Rate: 1, Burst: 1},
+		},
+	})
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	checkLimited := func(err error) {
+		t.Helper()
+		if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != -32005 {
+			t.Fatalf("wrong error: %v", err)
+		}
+	}
+	// Batches above the size limit should be rejected as a whole
+	batch := make([]BatchElem, 3)
+	for i := range batch {
+		batch[i] = BatchElem{Method: "test_noArgsRets", Result: new(interface{})}
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch call failed: %v", err)
+	}
+	for _, elem := range batch {
+		checkLimited(elem.Error)
+	}
+	batch = batch[:2]
+	for i := range batch {
+		batch[i].Error = nil
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch call failed: %v", err)
+	}
+	for _, elem := range batch {
+		if elem.Error != nil {
+			t.Fatalf("batch within limit failed: %v", elem.Error)
+		}
+	}
+	// Calls above the rate limit of a method should be rejected
+	var result string
+	if err := client.Call(&result, "test_rets"); err != nil {
+		t.Fatalf("call within rate limit failed: %v", err)
+	}
+	checkLimited(client.Call(&result, "test_rets"))
+
+	// Calls above the concurrency limit of the connection should be rejected
+	errc := make(chan error, 1)
+	go func() { errc <- client.Call(nil, "test_sleep", 500*time.Millisecond) }()
+	time.Sleep(100 * time.Millisecond)
+	checkLimited(client.Call(nil, "test_noArgsRets"))
+	if err := <-errc; err != nil {
+		t.Fatalf("call within concurrency limit failed: %v", err)
+	}
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatalf("call after concurrency freed up failed: %v", err)
+	}
+}
+
+func TestServerResponseLimits(t *testing.T) {
+	server := newTestServer()
+	server.SetLimits(Limits{
+		ResponseSize: 40,
+		MethodTimeouts: map[string]time.Duration{
+			"test_block": 100 * time.Millisecond,
+		},
+	})
+	defer server.Stop()
+
+	client := DialInProc(server)
+	defer client.Close()
+
+	checkError := func(err error, code int) {
+		t.Helper()
+		if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != code {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if _, ok := err.(DataError); !ok {
+			t.Fatalf("error carries no data: %v", err)
+		}
+	}
+	// Calls running past their timeout should be cancelled
+	start := time.Now()
+	checkError(client.Call(nil, "test_block"), -32002)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("timed out call took too long: %v", elapsed)
+	}
+	// Results above the size limit should be replaced by an error
+	var result echoResult
+	if err := client.Call(&result, "test_echo", "x", 1); err != nil {
+		t.Fatalf("call within size limit failed: %v", err)
+	}
+	checkError(client.Call(&result, "test_echo", strings.Repeat("x", 40), 1), -32003)
+
+	// Batches should be cut off once their results grow above the size limit
+	batch := make([]BatchElem, 3)
+	for i := range batch {
+		batch[i] = BatchElem{Method: "test_echo", Args: []interface{}{"x", 1}, Result: new(echoResult)}
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch call failed: %v", err)
+	}
+	if batch[0].Error != nil {
+		t.Fatalf("batch call within size limit failed: %v", batch[0].Error)
+	}
+	for _, elem := range batch[1:] {
+		checkError(elem.Error, -32003)
+	}
+}
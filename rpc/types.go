@@ -109,6 +109,24 @@ func (bn *BlockNumber) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalText implements encoding.TextMarshaler, encoding the block number in
+// the form accepted by UnmarshalJSON, i.e. one of the block tags or the hex
+// encoded number.
+func (bn BlockNumber) MarshalText() ([]byte, error) {
+	switch bn {
+	case EarliestBlockNumber:
+		return []byte("earliest"), nil
+	case LatestBlockNumber:
+		return []byte("latest"), nil
+	case PendingBlockNumber:
+		return []byte("pending"), nil
+	}
+	if bn < 0 {
+		return nil, fmt.Errorf("invalid block number %d", bn)
+	}
+	return hexutil.Uint64(bn).MarshalText()
+}
+
 func (bn BlockNumber) Int64() int64 {
 	return (int64)(bn)
 }
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -269,3 +270,112 @@ func estimateSize(n node) int {
 		panic(fmt.Sprintf("node type %T", n))
 	}
 }
+
+// commitPath collects all the dirty nodes of the trie into a node set keyed by
+// path, along with the paths of the removed nodes. As opposed to the hash scheme,
+// the committed nodes are kept in memory, since they can only be resolved from
+// the database once the entire state is committed.
+func (t *Trie) commitPath(onleaf LeafCallback) (common.Hash, error) {
+	set := NewNodeSet(t.owner)
+	for _, path := range t.tracer.deleted() {
+		set.Nodes[path] = nil
+	}
+	t.tracer.reset()
+
+	if t.root == nil {
+		t.committed = set
+		return emptyRoot, nil
+	}
+	rootHash := t.Hash()
+
+	h := newHasher(false)
+	defer returnHasherToPool(h)
+
+	root, err := t.commitPathNode(h, t.root, nil, set, onleaf)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	t.root = root
+	t.committed = set
+	return rootHash, nil
+}
+
+// commitPathNode adds the dirty nodes of the subtrie at the given path into the
+// node set, returning the subtrie with the dirty flags cleared.
+func (t *Trie) commitPathNode(h *hasher, n node, path []byte, set *NodeSet, onleaf LeafCallback) (node, error) {
+	switch cn := n.(type) {
+	case *shortNode:
+		if !cn.flags.dirty {
+			return cn, nil
+		}
+		clean := cn.copy()
+		clean.flags.dirty = false
+
+		if _, ok := cn.Val.(*fullNode); ok {
+			child, err := t.commitPathNode(h, cn.Val, append(path, cn.Key...), set, onleaf)
+			if err != nil {
+				return nil, err
+			}
+			clean.Val = child
+		}
+		collapsed, _ := h.hashShortNodeChildren(clean)
+		storePathNode(clean.flags.hash, collapsed, path, set)
+
+		if val, ok := clean.Val.(valueNode); ok && onleaf != nil && clean.flags.hash != nil {
+			if err := onleaf(nil, val, common.BytesToHash(clean.flags.hash)); err != nil {
+				return nil, err
+			}
+		}
+		return clean, nil
+
+	case *fullNode:
+		if !cn.flags.dirty {
+			return cn, nil
+		}
+		clean := cn.copy()
+		clean.flags.dirty = false
+
+		for i := 0; i < 16; i++ {
+			child := cn.Children[i]
+			if child == nil {
+				continue
+			}
+			if _, ok := child.(hashNode); ok {
+				continue
+			}
+			committed, err := t.commitPathNode(h, child, append(path, byte(i)), set, onleaf)
+			if err != nil {
+				return nil, err
+			}
+			clean.Children[i] = committed
+		}
+		collapsed, _ := h.hashFullNodeChildren(clean)
+		storePathNode(clean.flags.hash, collapsed, path, set)
+
+		if val, ok := clean.Children[16].(valueNode); ok && onleaf != nil && clean.flags.hash != nil {
+			if err := onleaf(nil, val, common.BytesToHash(clean.flags.hash)); err != nil {
+				return nil, err
+			}
+		}
+		return clean, nil
+
+	default:
+		// Hash and value nodes are never dirty
+		return n, nil
+	}
+}
+
+// storePathNode adds a collapsed node into the node set at the given path. The
+// nodes embedded into their parent are not stored, so anything previously at
+// their path is deleted instead.
+func storePathNode(hash hashNode, collapsed node, path []byte, set *NodeSet) {
+	if hash == nil {
+		set.Nodes[string(path)] = nil
+		return
+	}
+	blob, err := rlp.EncodeToBytes(collapsed)
+	if err != nil {
+		panic("encode error: " + err.Error())
+	}
+	set.Nodes[string(path)] = blob
+}
@@ -88,6 +88,13 @@ type Database struct {
 	childrenSize  common.StorageSize // Storage size of the external children tracking
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
+	flushHook func(common.Hash) // Hook invoked for every node before it's flushed to disk
+
+	scheme           string                     // Scheme the trie nodes are stored in
+	layers           map[common.Hash]*pathLayer // In-memory state layers of the path scheme, keyed by root
+	diskRoot         common.Hash                // Root of the state persisted in the path scheme
+	reverseDiffLimit uint64                     // Number of reverse diffs retained in the path scheme
+
 	lock sync.RWMutex
 }
 
@@ -277,6 +284,9 @@ type Config struct {
 	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
 	Journal   string // Journal of clean cache to survive node restarts
 	Preimages bool   // Flag whether the preimage of trie key is recorded
+
+	Scheme           string // Scheme to store the trie nodes in, defaults to the one recorded in the database
+	ReverseDiffLimit uint64 // Number of reverse diffs retained in the path scheme (0 = default)
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -308,9 +318,29 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	db.scheme = rawdb.ReadStateScheme(diskdb)
+	if config != nil && config.Scheme != "" {
+		db.scheme = config.Scheme
+	}
+	if db.scheme == rawdb.PathScheme {
+		var limit uint64
+		if config != nil {
+			limit = config.ReverseDiffLimit
+		}
+		db.initPathScheme(diskdb, limit)
+	}
 	return db
 }
 
+// SetFlushHook installs a callback to be invoked with the hash of every dirty
+// node before it's flushed to disk, or removes it if nil is given.
+func (db *Database) SetFlushHook(hook func(common.Hash)) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.flushHook = hook
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
@@ -406,6 +436,10 @@ func (db *Database) node(hash common.Hash) node {
 // Node retrieves an encoded cached trie node from memory. If it cannot be found
 // cached, the method queries the persistent database for the content.
 func (db *Database) Node(hash common.Hash) ([]byte, error) {
+	// Nodes can't be located by hash alone in the path scheme
+	if db.scheme == rawdb.PathScheme {
+		return nil, errPathUnsupported
+	}
 	// It doesn't make sense to retrieve the metaroot
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
@@ -482,6 +516,9 @@ func (db *Database) Nodes() []common.Hash {
 // and external node(e.g. storage trie root), all internal trie nodes
 // are referenced together by database itself.
 func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	if db.scheme == rawdb.PathScheme {
+		return // Layers are retained by CapLayers
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -516,6 +553,9 @@ func (db *Database) Dereference(root common.Hash) {
 		log.Error("Attempted to dereference the trie cache meta root")
 		return
 	}
+	if db.scheme == rawdb.PathScheme {
+		return // Layers are discarded by CapLayers
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -590,6 +630,9 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Cap(limit common.StorageSize) error {
+	if db.scheme == rawdb.PathScheme {
+		return nil // Layers are persisted by CapLayers
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -597,6 +640,10 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	nodes, storage, start := len(db.dirties), db.dirtiesSize, time.Now()
 	batch := db.diskdb.NewBatch()
 
+	db.lock.RLock()
+	hook := db.flushHook
+	db.lock.RUnlock()
+
 	// db.dirtiesSize only contains the useful data in the cache, but when reporting
 	// the total memory consumption, the maintenance metadata is also needed to be
 	// counted.
@@ -624,6 +671,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 	for size > limit && oldest != (common.Hash{}) {
 		// Fetch the oldest referenced node and push into the batch
 		node := db.dirties[oldest]
+		if hook != nil {
+			hook(oldest)
+		}
 		rawdb.WriteTrieNode(batch, oldest, node.rlp())
 
 		// If we exceeded the ideal batch size, commit and reset
@@ -716,11 +766,24 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 		}
 		batch.Reset()
 	}
+	// Flatten all the layers of the state into the disk in the path scheme
+	if db.scheme == rawdb.PathScheme {
+		if db.preimages != nil {
+			db.lock.Lock()
+			db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+			db.lock.Unlock()
+		}
+		return db.CapLayers(node, 0)
+	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
 
+	db.lock.RLock()
+	hook := db.flushHook
+	db.lock.RUnlock()
+
 	uncacher := &cleaner{db}
-	if err := db.commit(node, batch, uncacher, callback); err != nil {
+	if err := db.commit(node, batch, uncacher, hook, callback); err != nil {
 		log.Error("Failed to commit trie from trie database", "err", err)
 		return err
 	}
@@ -759,7 +822,7 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 }
 
 // commit is the private locked version of Commit.
-func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner, callback func(common.Hash)) error {
+func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleaner, hook func(common.Hash), callback func(common.Hash)) error {
 	// If the node does not exist, it's a previously committed node
 	node, ok := db.dirties[hash]
 	if !ok {
@@ -768,13 +831,16 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 	var err error
 	node.forChilds(func(child common.Hash) {
 		if err == nil {
-			err = db.commit(child, batch, uncacher, callback)
+			err = db.commit(child, batch, uncacher, hook, callback)
 		}
 	})
 	if err != nil {
 		return err
 	}
 	// If we've reached an optimal batch size, commit and start over
+	if hook != nil {
+		hook(hash)
+	}
 	rawdb.WriteTrieNode(batch, hash, node.rlp())
 	if callback != nil {
 		callback(hash)
@@ -843,6 +909,13 @@ func (c *cleaner) Delete(key []byte) error {
 // Size returns the current storage size of the memory cache in front of the
 // persistent database layer.
 func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	if db.scheme == rawdb.PathScheme {
+		db.lock.RLock()
+		preimagesSize := db.preimagesSize
+		db.lock.RUnlock()
+
+		return db.layersSize(), preimagesSize
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -0,0 +1,537 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DefaultReverseDiffLimit is the number of reverse diffs retained on disk in the
+// path scheme, limiting how deep the persisted state can be rewound.
+const DefaultReverseDiffLimit = 90000
+
+var (
+	pathLayerPersistTimer = metrics.NewRegisteredResettingTimer("trie/path/persist/time", nil)
+	pathLayerPersistMeter = metrics.NewRegisteredMeter("trie/path/persist/nodes", nil)
+	pathReverseDiffMeter  = metrics.NewRegisteredMeter("trie/path/reversediff/size", nil)
+
+	// errPathUnsupported is returned by the hash based accessors of the database
+	// if the trie nodes are stored in the path scheme.
+	errPathUnsupported = errors.New("not supported in path scheme")
+
+	// errUnknownParent is returned if a state is added on top of a parent which
+	// is neither tracked in memory, nor persisted.
+	errUnknownParent = errors.New("unknown parent state")
+)
+
+// pathLayer is the set of trie nodes changed by a state transition, kept in
+// memory on top of its parent until it's persisted in the path scheme.
+type pathLayer struct {
+	root      common.Hash                       // Root of the state after the transition
+	parent    common.Hash                       // Root of the state the transition applies to
+	nodes     map[common.Hash]map[string][]byte // Changed nodes keyed by owner and path, nil if deleted
+	destructs map[common.Hash]struct{}          // Storage tries wiped out entirely before the changes
+	size      common.StorageSize                // Storage size of the changed nodes
+}
+
+// reverseDiff is the set of trie nodes overwritten by persisting a state on top
+// of its parent, used to rewind the persisted state.
+type reverseDiff struct {
+	Parent common.Hash       // Root of the state before the transition
+	Root   common.Hash       // Root of the state after the transition
+	Nodes  []reverseDiffNode // Previous values of the overwritten nodes
+}
+
+// reverseDiffNode is the previous value of a trie node, empty if it didn't exist.
+type reverseDiffNode struct {
+	Owner common.Hash
+	Path  []byte
+	Prev  []byte
+}
+
+// Scheme returns the scheme the trie nodes are stored in.
+func (db *Database) Scheme() string {
+	return db.scheme
+}
+
+// pathNode retrieves the trie node with the given hash at the given path of an
+// owner's trie in the specified state, or nil if it's unavailable.
+func (db *Database) pathNode(state common.Hash, owner common.Hash, path []byte, hash common.Hash) node {
+	// The clean cache is keyed by hash, only consult it for the available states
+	// to not resurrect the stale ones
+	db.lock.RLock()
+	_, ok := db.layers[state]
+	ok = ok || state == db.diskRoot
+	db.lock.RUnlock()
+
+	if db.cleans != nil && ok {
+		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(enc)))
+			return mustDecodeNode(hash[:], enc)
+		}
+	}
+	enc, err := db.pathNodeBlob(state, owner, path, hash)
+	if err != nil {
+		return nil
+	}
+	if db.cleans != nil {
+		db.cleans.Set(hash[:], enc)
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(enc)))
+	}
+	return mustDecodeNode(hash[:], enc)
+}
+
+// pathNodeBlob retrieves the encoded trie node with the given hash at the given
+// path of an owner's trie in the specified state. The in-memory layers of the
+// state are consulted first, falling back to the persisted state if the state
+// derives from it.
+func (db *Database) pathNodeBlob(state common.Hash, owner common.Hash, path []byte, hash common.Hash) ([]byte, error) {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var blob []byte
+	for {
+		if state == db.diskRoot {
+			if owner == (common.Hash{}) {
+				blob = rawdb.ReadAccountTrieNode(db.diskdb, path)
+			} else {
+				blob = rawdb.ReadStorageTrieNode(db.diskdb, owner, path)
+			}
+			break
+		}
+		layer := db.layers[state]
+		if layer == nil {
+			return nil, &MissingNodeError{NodeHash: hash, Path: path}
+		}
+		if n, ok := layer.nodes[owner][string(path)]; ok {
+			blob = n
+			break
+		}
+		if _, ok := layer.destructs[owner]; ok {
+			break
+		}
+		state = layer.parent
+	}
+	if len(blob) == 0 || crypto.Keccak256Hash(blob) != hash {
+		return nil, &MissingNodeError{NodeHash: hash, Path: path}
+	}
+	return blob, nil
+}
+
+// Update adds the nodes changed by a state transition from parent to root as a
+// new in-memory layer. The parent must either be tracked in memory already, or
+// be the persisted state.
+func (db *Database) Update(root common.Hash, parent common.Hash, nodes *MergedNodeSet) error {
+	if db.scheme != rawdb.PathScheme {
+		return errors.New("not supported in hash scheme")
+	}
+	if root == parent {
+		return nil
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if _, ok := db.layers[root]; ok || root == db.diskRoot {
+		return nil
+	}
+	if _, ok := db.layers[parent]; !ok && parent != db.diskRoot {
+		return fmt.Errorf("%w %#x of state %#x", errUnknownParent, parent, root)
+	}
+	layer := &pathLayer{
+		root:      root,
+		parent:    parent,
+		nodes:     make(map[common.Hash]map[string][]byte),
+		destructs: make(map[common.Hash]struct{}),
+	}
+	for owner := range nodes.Destructs {
+		layer.destructs[owner] = struct{}{}
+		layer.size += common.HashLength
+	}
+	for owner, set := range nodes.Sets {
+		if len(set.Nodes) == 0 {
+			continue
+		}
+		layer.nodes[owner] = set.Nodes
+		layer.size += common.HashLength + set.Size()
+	}
+	db.layers[root] = layer
+	return nil
+}
+
+// CapLayers persists the oldest in-memory layers of the given state, retaining
+// at most the given number of layers on top of the persisted state. Any layer
+// not deriving from the new persisted state is discarded.
+//
+// Note, this method is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) CapLayers(root common.Hash, layers int) error {
+	if db.scheme != rawdb.PathScheme {
+		return errors.New("not supported in hash scheme")
+	}
+	db.lock.RLock()
+	var chain []*pathLayer
+	for state := root; state != db.diskRoot; {
+		layer := db.layers[state]
+		if layer == nil {
+			db.lock.RUnlock()
+			return fmt.Errorf("state %#x not available", root)
+		}
+		chain = append(chain, layer)
+		state = layer.parent
+	}
+	db.lock.RUnlock()
+
+	// If the preimage cache got large enough, push to disk. There is no other
+	// periodic flush in the path scheme, so do it alongside the layer writes.
+	db.lock.Lock()
+	if db.preimages != nil && db.preimagesSize > 4*1024*1024 {
+		batch := db.diskdb.NewBatch()
+		rawdb.WritePreimages(batch, db.preimages)
+		if err := batch.Write(); err != nil {
+			db.lock.Unlock()
+			return err
+		}
+		db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+	}
+	db.lock.Unlock()
+
+	// Persist the layers beyond the limit, starting from the oldest one
+	for i := len(chain) - 1; i >= layers; i-- {
+		if err := db.persistLayer(chain[i]); err != nil {
+			return err
+		}
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for state := range db.layers {
+		if !db.derivesFromDisk(state) {
+			delete(db.layers, state)
+		}
+	}
+	return nil
+}
+
+// derivesFromDisk reports whether the in-memory layer of the given state is
+// built on top of the persisted state. The caller must hold the lock.
+func (db *Database) derivesFromDisk(state common.Hash) bool {
+	for state != db.diskRoot {
+		layer := db.layers[state]
+		if layer == nil {
+			return false
+		}
+		state = layer.parent
+	}
+	return true
+}
+
+// persistLayer writes the nodes of an in-memory layer built directly on top of
+// the persisted state out to disk, along with a reverse diff to undo it.
+func (db *Database) persistLayer(layer *pathLayer) error {
+	var (
+		start = time.Now()
+		batch = db.diskdb.NewBatch()
+		diff  = &reverseDiff{Parent: layer.parent, Root: layer.root}
+		seen  = make(map[common.Hash]map[string]struct{})
+	)
+	record := func(owner common.Hash, path []byte, prev []byte) {
+		if seen[owner] == nil {
+			seen[owner] = make(map[string]struct{})
+		}
+		seen[owner][string(path)] = struct{}{}
+		diff.Nodes = append(diff.Nodes, reverseDiffNode{Owner: owner, Path: common.CopyBytes(path), Prev: common.CopyBytes(prev)})
+	}
+	// Wipe out the destructed storage tries first, the new nodes of the same
+	// owners are written afterwards
+	owners := make([]common.Hash, 0, len(layer.destructs))
+	for owner := range layer.destructs {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return bytes.Compare(owners[i][:], owners[j][:]) < 0 })
+
+	for _, owner := range owners {
+		it := rawdb.IterateStorageTrieNodes(db.diskdb, owner)
+		for it.Next() {
+			path := it.Key()[len(rawdb.TrieNodeStoragePrefix)+common.HashLength:]
+			record(owner, path, it.Value())
+			rawdb.DeleteStorageTrieNode(batch, owner, path)
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return err
+		}
+	}
+	var nodes int
+	for owner, set := range layer.nodes {
+		for path, blob := range set {
+			if _, ok := seen[owner][path]; !ok {
+				var prev []byte
+				if owner == (common.Hash{}) {
+					prev = rawdb.ReadAccountTrieNode(db.diskdb, []byte(path))
+				} else {
+					prev = rawdb.ReadStorageTrieNode(db.diskdb, owner, []byte(path))
+				}
+				if bytes.Equal(prev, blob) {
+					continue
+				}
+				record(owner, []byte(path), prev)
+			}
+			switch {
+			case owner == (common.Hash{}) && len(blob) == 0:
+				rawdb.DeleteAccountTrieNode(batch, []byte(path))
+			case owner == (common.Hash{}):
+				rawdb.WriteAccountTrieNode(batch, []byte(path), blob)
+			case len(blob) == 0:
+				rawdb.DeleteStorageTrieNode(batch, owner, []byte(path))
+			default:
+				rawdb.WriteStorageTrieNode(batch, owner, []byte(path), blob)
+			}
+			nodes++
+		}
+	}
+	// Store the reverse diff and drop the ones beyond the retention limit
+	enc, err := rlp.EncodeToBytes(diff)
+	if err != nil {
+		return err
+	}
+	id := rawdb.ReadReverseDiffHead(db.diskdb) + 1
+	rawdb.WriteReverseDiff(batch, id, enc)
+	rawdb.WriteReverseDiffHead(batch, id)
+	rawdb.WriteReverseDiffLookup(batch, layer.parent, id)
+	if id > db.reverseDiffLimit {
+		stale := id - db.reverseDiffLimit
+		if diff, err := db.readReverseDiff(stale); err == nil {
+			db.deleteReverseDiffLookup(batch, diff.Parent, stale)
+		}
+		rawdb.DeleteReverseDiff(batch, stale)
+	}
+	rawdb.WritePersistentStateRoot(batch, layer.root)
+
+	// Write the batch while holding the lock, so that readers never see the
+	// persisted state and the in-memory layers out of sync
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.diskRoot = layer.root
+	delete(db.layers, layer.root)
+
+	pathLayerPersistTimer.Update(time.Since(start))
+	pathLayerPersistMeter.Mark(int64(nodes))
+	pathReverseDiffMeter.Mark(int64(len(enc)))
+
+	log.Debug("Persisted trie layer", "root", layer.root, "nodes", nodes, "diff", common.StorageSize(len(enc)), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// Recoverable reports whether the persisted state can be rewound to the given
+// state using the retained reverse diffs.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.scheme != rawdb.PathScheme {
+		return false
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	if root == db.diskRoot {
+		return true
+	}
+	_, ok := db.reverseDiffOf(root)
+	return ok
+}
+
+// reverseDiffOf returns the id of the latest retained reverse diff rewinding the
+// persisted state to the given state. The caller must hold the lock.
+func (db *Database) reverseDiffOf(root common.Hash) (uint64, bool) {
+	id, ok := rawdb.ReadReverseDiffLookup(db.diskdb, root)
+	if !ok || id == 0 || id > rawdb.ReadReverseDiffHead(db.diskdb) || !rawdb.HasReverseDiff(db.diskdb, id) {
+		return 0, false
+	}
+	return id, true
+}
+
+// deleteReverseDiffLookup deletes the lookup of the given state if it points to
+// the reverse diff being dropped, leaving the ones of later diffs in place.
+func (db *Database) deleteReverseDiffLookup(batch ethdb.KeyValueWriter, root common.Hash, id uint64) {
+	if lookup, ok := rawdb.ReadReverseDiffLookup(db.diskdb, root); ok && lookup == id {
+		rawdb.DeleteReverseDiffLookup(batch, root)
+	}
+}
+
+// Reconstruct rebuilds the given state from the reverse diffs as an in-memory
+// layer on top of the persisted state, so that new states can be built on it.
+// As opposed to Recover, neither the persisted state nor the other in-memory
+// layers are touched.
+//
+// Note, this method is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) Reconstruct(root common.Hash) error {
+	if db.scheme != rawdb.PathScheme {
+		return errors.New("not supported in hash scheme")
+	}
+	db.lock.RLock()
+	diskRoot := db.diskRoot
+	_, exists := db.layers[root]
+	id, ok := db.reverseDiffOf(root)
+	db.lock.RUnlock()
+
+	if exists || root == diskRoot {
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("state %#x is not recoverable", root)
+	}
+	// Merge the reverse diffs from the newest one, the older ones overwriting
+	// the nodes they share
+	layer := &pathLayer{
+		root:      root,
+		parent:    diskRoot,
+		nodes:     make(map[common.Hash]map[string][]byte),
+		destructs: make(map[common.Hash]struct{}),
+	}
+	start := time.Now()
+	for i := rawdb.ReadReverseDiffHead(db.diskdb); i >= id; i-- {
+		diff, err := db.readReverseDiff(i)
+		if err != nil {
+			return err
+		}
+		for _, n := range diff.Nodes {
+			set := layer.nodes[n.Owner]
+			if set == nil {
+				set = make(map[string][]byte)
+				layer.nodes[n.Owner] = set
+				layer.size += common.HashLength
+			}
+			if prev, ok := set[string(n.Path)]; ok {
+				layer.size -= common.StorageSize(len(n.Path) + len(prev))
+			}
+			set[string(n.Path)] = n.Prev
+			layer.size += common.StorageSize(len(n.Path) + len(n.Prev))
+		}
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.diskRoot != diskRoot {
+		return fmt.Errorf("persisted state changed during reconstruction of %#x", root)
+	}
+	db.layers[root] = layer
+	log.Info("Reconstructed trie layer", "root", root, "diffs", rawdb.ReadReverseDiffHead(db.diskdb)-id+1, "size", layer.size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// Recover rewinds the persisted state to the given state by applying the reverse
+// diffs, discarding all the in-memory layers.
+//
+// Note, this method is a non-synchronized mutator. It is unsafe to call this
+// concurrently with other mutators.
+func (db *Database) Recover(root common.Hash) error {
+	if !db.Recoverable(root) {
+		return fmt.Errorf("state %#x is not recoverable", root)
+	}
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.layers = make(map[common.Hash]*pathLayer)
+
+	start := time.Now()
+	for id := rawdb.ReadReverseDiffHead(db.diskdb); db.diskRoot != root; id-- {
+		diff, err := db.readReverseDiff(id)
+		if err != nil {
+			return err
+		}
+		batch := db.diskdb.NewBatch()
+		for _, n := range diff.Nodes {
+			switch {
+			case n.Owner == (common.Hash{}) && len(n.Prev) == 0:
+				rawdb.DeleteAccountTrieNode(batch, n.Path)
+			case n.Owner == (common.Hash{}):
+				rawdb.WriteAccountTrieNode(batch, n.Path, n.Prev)
+			case len(n.Prev) == 0:
+				rawdb.DeleteStorageTrieNode(batch, n.Owner, n.Path)
+			default:
+				rawdb.WriteStorageTrieNode(batch, n.Owner, n.Path, n.Prev)
+			}
+		}
+		db.deleteReverseDiffLookup(batch, diff.Parent, id)
+		rawdb.DeleteReverseDiff(batch, id)
+		rawdb.WriteReverseDiffHead(batch, id-1)
+		rawdb.WritePersistentStateRoot(batch, diff.Parent)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		db.diskRoot = diff.Parent
+	}
+	log.Info("Rewound persisted state", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// readReverseDiff loads and decodes the reverse diff of the given id.
+func (db *Database) readReverseDiff(id uint64) (*reverseDiff, error) {
+	blob := rawdb.ReadReverseDiff(db.diskdb, id)
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("reverse diff %d missing", id)
+	}
+	diff := new(reverseDiff)
+	if err := rlp.DecodeBytes(blob, diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// layersSize returns the total storage size of the in-memory layers.
+func (db *Database) layersSize() common.StorageSize {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+
+	var size common.StorageSize
+	for _, layer := range db.layers {
+		size += layer.size
+	}
+	return size
+}
+
+// initPathScheme initializes the path scheme fields of the database from the
+// persisted state.
+func (db *Database) initPathScheme(diskdb ethdb.KeyValueReader, limit uint64) {
+	db.layers = make(map[common.Hash]*pathLayer)
+	db.diskRoot = rawdb.ReadPersistentStateRoot(diskdb)
+	if db.diskRoot == (common.Hash{}) {
+		db.diskRoot = emptyRoot
+	}
+	db.reverseDiffLimit = limit
+	if db.reverseDiffLimit == 0 {
+		db.reverseDiffLimit = DefaultReverseDiffLimit
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// pathTester commits random state transitions into a path scheme database and
+// tracks the expected content of every state.
+type pathTester struct {
+	t      *testing.T
+	db     *Database
+	roots  []common.Hash
+	states map[common.Hash]map[string]string
+}
+
+func newPathTester(t *testing.T) *pathTester {
+	diskdb := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+
+	return &pathTester{
+		t:      t,
+		db:     NewDatabaseWithConfig(diskdb, &Config{ReverseDiffLimit: 8}),
+		roots:  []common.Hash{emptyRoot},
+		states: map[common.Hash]map[string]string{emptyRoot: {}},
+	}
+}
+
+// commit applies random updates and deletions on top of the last state.
+func (pt *pathTester) commit(rnd *rand.Rand) common.Hash {
+	parent := pt.roots[len(pt.roots)-1]
+
+	tr, err := NewWithID(StateTrieID(parent), pt.db)
+	if err != nil {
+		pt.t.Fatalf("failed to open state %x: %v", parent, err)
+	}
+	state := make(map[string]string)
+	for k, v := range pt.states[parent] {
+		state[k] = v
+	}
+	for i := 0; i < 32; i++ {
+		key := string(crypto.Keccak256([]byte{byte(rnd.Intn(64))}))
+		if _, ok := state[key]; ok && rnd.Intn(3) == 0 {
+			if err := tr.TryDelete([]byte(key)); err != nil {
+				pt.t.Fatalf("failed to delete: %v", err)
+			}
+			delete(state, key)
+			continue
+		}
+		// Mix embedded and standalone nodes with short and long values
+		val := fmt.Sprintf("value-%d-%d", len(pt.roots), i)
+		if rnd.Intn(2) == 0 {
+			val = string(crypto.Keccak256([]byte(val)))
+		}
+		if err := tr.TryUpdate([]byte(key), []byte(val)); err != nil {
+			pt.t.Fatalf("failed to update: %v", err)
+		}
+		state[key] = val
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		pt.t.Fatalf("failed to commit: %v", err)
+	}
+	nodes := NewMergedNodeSet()
+	nodes.Merge(tr.CommittedNodes())
+	if err := pt.db.Update(root, parent, nodes); err != nil {
+		pt.t.Fatalf("failed to update database: %v", err)
+	}
+	pt.roots = append(pt.roots, root)
+	pt.states[root] = state
+	return root
+}
+
+// verify checks that the given state is available with the expected content.
+func (pt *pathTester) verify(db *Database, root common.Hash) {
+	tr, err := NewWithID(StateTrieID(root), db)
+	if err != nil {
+		pt.t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	for k, v := range pt.states[root] {
+		have, err := tr.TryGet([]byte(k))
+		if err != nil {
+			pt.t.Fatalf("state %x: failed to read %x: %v", root, k, err)
+		}
+		if string(have) != v {
+			pt.t.Fatalf("state %x: value mismatch for %x: have %x, want %x", root, k, have, v)
+		}
+	}
+	it := NewIterator(tr.NodeIterator(nil))
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if it.Err != nil {
+		pt.t.Fatalf("state %x: iteration failed: %v", root, it.Err)
+	}
+	if count != len(pt.states[root]) {
+		pt.t.Fatalf("state %x: item count mismatch: have %d, want %d", root, count, len(pt.states[root]))
+	}
+}
+
+// Tests that states committed in the path scheme are readable from the in-memory
+// layers, persisted in place and rewound using the reverse diffs.
+func TestPathSchemeLayers(t *testing.T) {
+	var (
+		pt  = newPathTester(t)
+		rnd = rand.New(rand.NewSource(1))
+	)
+	for i := 0; i < 12; i++ {
+		pt.commit(rnd)
+	}
+	for _, root := range pt.roots {
+		pt.verify(pt.db, root)
+	}
+	// Persist all but the last two layers, the older states become unavailable
+	head := pt.roots[len(pt.roots)-1]
+	if err := pt.db.CapLayers(head, 2); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	for i, root := range pt.roots {
+		if i >= len(pt.roots)-3 {
+			pt.verify(pt.db, root)
+		} else if root == emptyRoot {
+			continue // Empty tries are always available
+		} else if _, err := NewWithID(StateTrieID(root), pt.db); err == nil {
+			t.Fatalf("stale state %d available", i)
+		}
+	}
+	// Flatten everything and ensure a fresh database reads the persisted state
+	if err := pt.db.Commit(head, false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	fresh := NewDatabase(pt.db.DiskDB())
+	if fresh.Scheme() != rawdb.PathScheme {
+		t.Fatalf("scheme mismatch: have %s, want %s", fresh.Scheme(), rawdb.PathScheme)
+	}
+	pt.verify(fresh, head)
+
+	// Rewind the persisted state, only the retained reverse diffs can be applied
+	if fresh.Recoverable(pt.roots[len(pt.roots)-10]) {
+		t.Fatal("state beyond the reverse diff limit recoverable")
+	}
+	target := pt.roots[len(pt.roots)-8]
+	if !fresh.Recoverable(target) {
+		t.Fatal("state within the reverse diff limit not recoverable")
+	}
+	if err := fresh.Recover(target); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	pt.verify(fresh, target)
+	pt.verify(NewDatabase(pt.db.DiskDB()), target)
+	if fresh.Recoverable(pt.roots[len(pt.roots)-2]) {
+		t.Fatal("rewound state still recoverable")
+	}
+
+	// Ensure new states can be built on top of the recovered one
+	pt.db, pt.roots = fresh, pt.roots[:len(pt.roots)-7]
+	root := pt.commit(rnd)
+	if err := pt.db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	pt.verify(NewDatabase(pt.db.DiskDB()), root)
+}
+
+// Tests that a state below the persisted one can be rebuilt in memory without
+// touching the persisted state, and that new states can be built on top of it.
+func TestPathSchemeReconstruct(t *testing.T) {
+	var (
+		pt  = newPathTester(t)
+		rnd = rand.New(rand.NewSource(3))
+	)
+	for i := 0; i < 6; i++ {
+		pt.commit(rnd)
+	}
+	head := pt.roots[len(pt.roots)-1]
+	if err := pt.db.CapLayers(head, 0); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if err := pt.db.Reconstruct(common.Hash{0x1}); err == nil {
+		t.Fatal("unknown state reconstructed")
+	}
+	target := pt.roots[2]
+	if err := pt.db.Reconstruct(target); err != nil {
+		t.Fatalf("failed to reconstruct state: %v", err)
+	}
+	pt.verify(pt.db, target)
+	pt.verify(pt.db, head)
+	pt.verify(NewDatabase(pt.db.DiskDB()), head)
+
+	// Build a new state on top of the rebuilt one and persist it
+	pt.roots = pt.roots[:3]
+	side := pt.commit(rnd)
+	pt.verify(pt.db, side)
+	pt.verify(pt.db, head)
+
+	if err := pt.db.CapLayers(side, 0); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	fresh := NewDatabase(pt.db.DiskDB())
+	pt.verify(fresh, side)
+
+	// The reverse diffs should lead back to the previously persisted state
+	if err := fresh.Recover(head); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	pt.verify(fresh, head)
+}
+
+// Tests that the layers not derived from the persisted state are discarded.
+func TestPathSchemeSideLayers(t *testing.T) {
+	var (
+		pt  = newPathTester(t)
+		rnd = rand.New(rand.NewSource(2))
+	)
+	base := pt.commit(rnd)
+	side := pt.commit(rnd)
+
+	pt.roots = pt.roots[:len(pt.roots)-1]
+	canon := pt.commit(rnd)
+
+	pt.verify(pt.db, side)
+	pt.verify(pt.db, canon)
+
+	if err := pt.db.CapLayers(canon, 0); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if _, err := NewWithID(StateTrieID(side), pt.db); err == nil {
+		t.Fatal("side state available after persisting the canonical one")
+	}
+	if _, err := NewWithID(StateTrieID(base), pt.db); err == nil {
+		t.Fatal("parent state available after persisting the child")
+	}
+	pt.verify(pt.db, canon)
+}
+
+// Tests that the preimages accumulated in the path scheme are flushed to disk
+// once they outgrow the cache allowance, even without a full commit.
+func TestPathSchemePreimages(t *testing.T) {
+	diskdb := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	db := NewDatabaseWithConfig(diskdb, &Config{Preimages: true})
+
+	var (
+		pt = &pathTester{
+			t:      t,
+			db:     db,
+			roots:  []common.Hash{emptyRoot},
+			states: map[common.Hash]map[string]string{emptyRoot: {}},
+		}
+		rnd  = rand.New(rand.NewSource(3))
+		blob = make([]byte, 1024)
+	)
+	root := pt.commit(rnd)
+
+	// Stay below the threshold first and make sure nothing is written yet
+	db.lock.Lock()
+	db.insertPreimage(crypto.Keccak256Hash([]byte("small")), []byte("small"))
+	db.lock.Unlock()
+	if err := db.CapLayers(root, 1); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if rawdb.ReadPreimage(diskdb, crypto.Keccak256Hash([]byte("small"))) != nil {
+		t.Fatal("preimage flushed below the threshold")
+	}
+	// Grow the cache beyond the threshold and ensure everything is flushed
+	db.lock.Lock()
+	for i := 0; i < 4*1024; i++ {
+		preimage := append([]byte(fmt.Sprintf("%d", i)), blob...)
+		db.insertPreimage(crypto.Keccak256Hash(preimage), preimage)
+	}
+	db.lock.Unlock()
+	if err := db.CapLayers(root, 1); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if blob := rawdb.ReadPreimage(diskdb, crypto.Keccak256Hash([]byte("small"))); string(blob) != "small" {
+		t.Fatalf("preimage not flushed: have %q", blob)
+	}
+	if _, size := db.Size(); size != 0 {
+		t.Fatalf("preimage cache not reset: %v", size)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// NodeSet contains the nodes of a single trie changed by a commit in the path
+// scheme, keyed by their path. Deleted nodes are represented by nil blobs.
+type NodeSet struct {
+	Owner common.Hash       // The hash of the account owning the trie, empty for the account trie
+	Nodes map[string][]byte // The RLP encoded nodes keyed by hex path, nil if deleted
+}
+
+// NewNodeSet initializes an empty node set for the trie of the given owner.
+func NewNodeSet(owner common.Hash) *NodeSet {
+	return &NodeSet{
+		Owner: owner,
+		Nodes: make(map[string][]byte),
+	}
+}
+
+// Size returns the storage size of the nodes in the set.
+func (set *NodeSet) Size() common.StorageSize {
+	var size common.StorageSize
+	for path, blob := range set.Nodes {
+		size += common.StorageSize(len(path) + len(blob))
+	}
+	return size
+}
+
+// MergedNodeSet is the collection of the node sets of all the tries changed by
+// a state transition, along with the storage tries wiped out entirely.
+type MergedNodeSet struct {
+	Sets      map[common.Hash]*NodeSet
+	Destructs map[common.Hash]struct{}
+}
+
+// NewMergedNodeSet initializes an empty merged node set.
+func NewMergedNodeSet() *MergedNodeSet {
+	return &MergedNodeSet{
+		Sets:      make(map[common.Hash]*NodeSet),
+		Destructs: make(map[common.Hash]struct{}),
+	}
+}
+
+// Merge adds the node set of a trie into the merged set. Each trie can only be
+// merged once.
+func (set *MergedNodeSet) Merge(other *NodeSet) error {
+	if _, ok := set.Sets[other.Owner]; ok {
+		return fmt.Errorf("duplicate trie for owner %#x", other.Owner)
+	}
+	set.Sets[other.Owner] = other
+	return nil
+}
+
+// Destruct marks the storage trie of the given owner as wiped out. The nodes of
+// the trie merged into the same set are written after the wipe.
+func (set *MergedNodeSet) Destruct(owner common.Hash) {
+	set.Destructs[owner] = struct{}{}
+}
@@ -52,10 +52,17 @@ type SecureTrie struct {
 // A new cache generation is created by each call to Commit.
 // cachelimit sets the number of past cache generations to keep.
 func NewSecure(root common.Hash, db *Database) (*SecureTrie, error) {
+	return NewSecureWithID(StateTrieID(root), db)
+}
+
+// NewSecureWithID creates a secure trie identified by the given id from a
+// backing database. Storage tries must be opened with their full id in the
+// path scheme.
+func NewSecureWithID(id *ID, db *Database) (*SecureTrie, error) {
 	if db == nil {
 		panic("trie.NewSecure called without a database")
 	}
-	trie, err := New(root, db)
+	trie, err := NewWithID(id, db)
 	if err != nil {
 		return nil, err
 	}
@@ -160,6 +167,12 @@ func (t *SecureTrie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	return t.trie.Commit(onleaf)
 }
 
+// CommittedNodes returns the nodes changed by the last commit in the path
+// scheme, or nil in the hash scheme.
+func (t *SecureTrie) CommittedNodes() *NodeSet {
+	return t.trie.CommittedNodes()
+}
+
 // Hash returns the root hash of SecureTrie. It does not write to the
 // database and can be used even if the trie doesn't have one.
 func (t *SecureTrie) Hash() common.Hash {
@@ -169,6 +182,7 @@ func (t *SecureTrie) Hash() common.Hash {
 // Copy returns a copy of SecureTrie.
 func (t *SecureTrie) Copy() *SecureTrie {
 	cpy := *t
+	cpy.trie = *t.trie.copy()
 	return &cpy
 }
 
@@ -0,0 +1,71 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+// tracer tracks the paths of the nodes removed from a trie since it was opened
+// or last committed. In the path scheme the nodes are keyed by their path, so
+// the ones which are not replaced by a new node need to be deleted explicitly.
+//
+// All methods are safe to call on a nil tracer, which tracks nothing.
+type tracer struct {
+	deletes map[string]struct{}
+}
+
+// newTracer initializes an empty tracer.
+func newTracer() *tracer {
+	return &tracer{deletes: make(map[string]struct{})}
+}
+
+// onDelete tracks the removal of the node at the given path.
+func (t *tracer) onDelete(path []byte) {
+	if t == nil {
+		return
+	}
+	t.deletes[string(path)] = struct{}{}
+}
+
+// deleted returns the paths of all the removed nodes.
+func (t *tracer) deleted() []string {
+	if t == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(t.deletes))
+	for path := range t.deletes {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// reset clears the tracked paths.
+func (t *tracer) reset() {
+	if t == nil {
+		return
+	}
+	t.deletes = make(map[string]struct{})
+}
+
+// copy returns a deep copied tracer.
+func (t *tracer) copy() *tracer {
+	if t == nil {
+		return nil
+	}
+	deletes := make(map[string]struct{}, len(t.deletes))
+	for path := range t.deletes {
+		deletes[path] = struct{}{}
+	}
+	return &tracer{deletes: deletes}
+}
@@ -24,6 +24,7 @@ import (
 	"sync"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 )
@@ -53,6 +54,12 @@ type Trie struct {
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
 	unhashed int
+
+	// Fields used to locate and track the nodes in the path scheme
+	owner     common.Hash // Hash of the account owning the trie, empty for the account trie
+	stateRoot common.Hash // Root of the state the trie was opened in
+	tracer    *tracer     // Tracer of the removed nodes, nil in the hash scheme
+	committed *NodeSet    // Nodes changed by the last commit, nil in the hash scheme
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -67,13 +74,25 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithID(StateTrieID(root), db)
+}
+
+// NewWithID creates a trie identified by the given id from db. Storage tries
+// must be opened with their full id in the path scheme, as their nodes are
+// located by the owner account and the state they belong to.
+func NewWithID(id *ID, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:        db,
+		owner:     id.Owner,
+		stateRoot: id.StateRoot,
 	}
-	if root != (common.Hash{}) && root != emptyRoot {
+	if db.scheme == rawdb.PathScheme {
+		trie.tracer = newTracer()
+	}
+	if root := id.Root; root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
 		if err != nil {
 			return nil, err
@@ -177,6 +196,10 @@ func (t *Trie) tryGetNode(origNode node, path []byte, pos int) (item []byte, new
 		if hash == nil {
 			return nil, origNode, 0, errors.New("non-consensus node")
 		}
+		if t.db.scheme == rawdb.PathScheme {
+			blob, err := t.db.pathNodeBlob(t.stateRoot, t.owner, path[:pos], common.BytesToHash(hash))
+			return blob, origNode, 1, err
+		}
 		blob, err := t.db.Node(common.BytesToHash(hash))
 		return blob, origNode, 1, err
 	}
@@ -362,6 +385,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			return false, n, nil // don't replace n on mismatch
 		}
 		if matchlen == len(key) {
+			t.tracer.onDelete(prefix)
 			return true, nil, nil // remove n entirely for whole matches
 		}
 		// The key is longer than n.Key. Remove the remaining suffix
@@ -380,6 +404,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 			// always creates a new slice) instead of append to
 			// avoid modifying n.Key since it might be shared with
 			// other nodes.
+			t.tracer.onDelete(append(prefix, n.Key...))
 			return true, &shortNode{concat(n.Key, child.Key...), child.Val, t.newFlag()}, nil
 		default:
 			return true, &shortNode{n.Key, child, t.newFlag()}, nil
@@ -422,11 +447,16 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], append(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
 				if cnode, ok := cnode.(*shortNode); ok {
+					// Replace the entire full node with the short node.
+					// Mark the original short node as deleted since the
+					// value is embedded into the parent now.
+					t.tracer.onDelete(append(prefix, byte(pos)))
+
 					k := append([]byte{byte(pos)}, cnode.Key...)
 					return true, &shortNode{k, cnode.Val, t.newFlag()}, nil
 				}
@@ -479,7 +509,11 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
-	if node := t.db.node(hash); node != nil {
+	if t.db.scheme == rawdb.PathScheme {
+		if node := t.db.pathNode(t.stateRoot, t.owner, prefix, hash); node != nil {
+			return node, nil
+		}
+	} else if node := t.db.node(hash); node != nil {
 		return node, nil
 	}
 	return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
@@ -499,6 +533,9 @@ func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	if t.db.scheme == rawdb.PathScheme {
+		return t.commitPath(onleaf)
+	}
 	if t.root == nil {
 		return emptyRoot, nil
 	}
@@ -558,4 +595,19 @@ func (t *Trie) hashRoot() (node, node, error) {
 func (t *Trie) Reset() {
 	t.root = nil
 	t.unhashed = 0
+	t.tracer.reset()
+	t.committed = nil
+}
+
+// CommittedNodes returns the nodes changed by the last commit in the path
+// scheme, or nil in the hash scheme.
+func (t *Trie) CommittedNodes() *NodeSet {
+	return t.committed
+}
+
+// copy returns a copy of the trie, sharing the immutable nodes.
+func (t *Trie) copy() *Trie {
+	cpy := *t
+	cpy.tracer = t.tracer.copy()
+	return &cpy
 }